@@ -11,10 +11,16 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/config"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Expense"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sale"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Supplier"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/StockTake"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sync"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Transfer"
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 	"gorm.io/gorm"
 )
@@ -50,9 +56,15 @@ func main() {
 	Company.InitializeService(db)
 	User.InitializeService(db) // This also initializes Branch service (moved to User package)
 	Notification.InitializeService(db)
+	Idempotency.InitializeService(db)
 	Product.InitializeService(db)
+	Customer.InitializeService(db)
+	Transfer.InitializeService(db)
+	StockTake.InitializeService(db)
+	Supplier.InitializeService(db)
 	Sale.InitializeService(db)
 	Expense.InitializeService(db)
+	Sync.InitializeService(db)
 
 	// Initialize Gin router
 	r := gin.Default()
@@ -66,7 +78,8 @@ func main() {
 		config.AllowOrigins = []string{corsOrigins}
 	}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "If-Match", "Idempotency-Key"}
+	config.ExposeHeaders = []string{"ETag", "Idempotent-Replayed"}
 	r.Use(cors.New(config))
 
 	// Health check endpoint
@@ -85,10 +98,17 @@ func main() {
 	protected.Use(User.AuthMiddleware())
 	{
 		User.RegisterBranchRoutes(protected)
+		User.RegisterCompanyRoutes(protected)
 		Notification.RegisterRoutes(protected)
 		Product.RegisterRoutes(protected)
+		Product.RegisterCategoryRoutes(protected)
+		Customer.RegisterRoutes(protected)
+		Transfer.RegisterRoutes(protected)
+		StockTake.RegisterRoutes(protected)
+		Supplier.RegisterRoutes(protected)
 		Sale.RegisterRoutes(protected)
 		Expense.RegisterRoutes(protected)
+		Sync.RegisterRoutes(protected)
 	}
 
 	// Get port from environment or use default
@@ -139,13 +159,78 @@ func migrateDatabase(db *gorm.DB) error {
 		return err
 	}
 
-	// 4. Product (depends on Company)
+	// 3.6.1. IdempotencyKey (depends on User)
+	if err := db.AutoMigrate(&Idempotency.IdempotencyKey{}); err != nil {
+		return err
+	}
+
+	// 3.7. Category (depends on Company)
+	if err := db.AutoMigrate(&Product.Category{}); err != nil {
+		return err
+	}
+
+	// 4. Product (depends on Company and Category)
 	if err := db.AutoMigrate(&Product.Product{}); err != nil {
 		return err
 	}
 
-	// 5. Sale (depends on User and Product)
-	if err := db.AutoMigrate(&Sale.Sale{}); err != nil {
+	// 4.1. StockMovement ledger (depends on Product)
+	if err := db.AutoMigrate(&Product.StockMovement{}); err != nil {
+		return err
+	}
+
+	// 4.1.1. CostLayer for FIFO costing (depends on Product)
+	if err := db.AutoMigrate(&Product.CostLayer{}); err != nil {
+		return err
+	}
+
+	// 4.1.2. ProductBarcode (depends on Product)
+	if err := db.AutoMigrate(&Product.ProductBarcode{}); err != nil {
+		return err
+	}
+
+	// 4.2. BranchStock (depends on Product and Branch)
+	if err := db.AutoMigrate(&Product.BranchStock{}); err != nil {
+		return err
+	}
+
+	// 4.3. Transfer (depends on Product and Branch)
+	if err := db.AutoMigrate(&Transfer.Transfer{}, &Transfer.TransferItem{}); err != nil {
+		return err
+	}
+
+	// 4.3.1. StockTake (depends on Product and Branch)
+	if err := db.AutoMigrate(&StockTake.StockTake{}, &StockTake.StockTakeItem{}); err != nil {
+		return err
+	}
+
+	// 4.4. Supplier and PurchaseOrder (depend on Product and Branch)
+	if err := db.AutoMigrate(&Supplier.Supplier{}, &Supplier.PurchaseOrder{}, &Supplier.PurchaseOrderItem{}); err != nil {
+		return err
+	}
+
+	// 4.5. Customer (depends on Company)
+	if err := db.AutoMigrate(&Customer.Customer{}); err != nil {
+		return err
+	}
+
+	// 5. Sale and Order (depend on User, Product and Customer)
+	if err := db.AutoMigrate(&Sale.Order{}, &Sale.Sale{}); err != nil {
+		return err
+	}
+
+	// 5.1. Payment (depends on Sale and Order)
+	if err := db.AutoMigrate(&Sale.Payment{}); err != nil {
+		return err
+	}
+
+	// 5.2. SaleReturn (depends on Sale and Payment)
+	if err := db.AutoMigrate(&Sale.SaleReturn{}); err != nil {
+		return err
+	}
+
+	// 5.3. ReceiptSequence (depends on Branch)
+	if err := db.AutoMigrate(&Sale.ReceiptSequence{}); err != nil {
 		return err
 	}
 
@@ -154,6 +239,11 @@ func migrateDatabase(db *gorm.DB) error {
 		return err
 	}
 
+	// 7. SyncRecord (depends on Company and User)
+	if err := db.AutoMigrate(&Sync.SyncRecord{}); err != nil {
+		return err
+	}
+
 	// Verify that all ID columns are integer type (not UUID)
 	if err := verifyIDTypes(db); err != nil {
 		log.Printf("Warning: ID type verification failed: %v", err)
@@ -4,12 +4,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// CostingMethod decides how the cost of goods sold is taken from a product's stock
+type CostingMethod string
+
+const (
+	WeightedAverage CostingMethod = "weighted_average" // Every unit costs the running average of everything bought
+	FIFO            CostingMethod = "fifo"             // Units are sold at the cost of the oldest stock still held
+)
+
 type Company struct {
 	gorm.Model
-	Name    string  `json:"name" gorm:"not null"`
-	Email   string  `json:"email" gorm:"uniqueIndex;not null"`
-	Phone   *string `json:"phone,omitempty"`
-	Address *string `json:"address,omitempty"`
+	Name          string        `json:"name" gorm:"not null"`
+	Email         string        `json:"email" gorm:"uniqueIndex;not null"`
+	Phone         *string       `json:"phone,omitempty"`
+	Address       *string       `json:"address,omitempty"`
+	CostingMethod CostingMethod `json:"costingMethod" gorm:"not null;default:'weighted_average'"`
 }
 
 type CreateCompanyRequest struct {
@@ -20,8 +29,9 @@ type CreateCompanyRequest struct {
 }
 
 type UpdateCompanyRequest struct {
-	Name    *string `json:"name,omitempty"`
-	Email   *string `json:"email,omitempty"`
-	Phone   *string `json:"phone,omitempty"`
-	Address *string `json:"address,omitempty"`
+	Name          *string        `json:"name,omitempty"`
+	Email         *string        `json:"email,omitempty"`
+	Phone         *string        `json:"phone,omitempty"`
+	Address       *string        `json:"address,omitempty"`
+	CostingMethod *CostingMethod `json:"costingMethod,omitempty"`
 }
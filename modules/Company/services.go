@@ -8,6 +8,9 @@ import (
 
 var companyService *CompanyService
 
+// ErrInvalidCostingMethod is returned for costing methods other than weighted_average and fifo
+var ErrInvalidCostingMethod = errors.New("costing method must be weighted_average or fifo")
+
 type CompanyService struct {
 	db *gorm.DB
 }
@@ -66,10 +69,11 @@ func (s *CompanyService) CreateCompany(req CreateCompanyRequest) (*Company, erro
 	}
 
 	company := &Company{
-		Name:    req.Name,
-		Email:   req.Email,
-		Phone:   req.Phone,
-		Address: req.Address,
+		Name:          req.Name,
+		Email:         req.Email,
+		Phone:         req.Phone,
+		Address:       req.Address,
+		CostingMethod: WeightedAverage,
 	}
 
 	if err := s.db.Create(company).Error; err != nil {
@@ -107,6 +111,12 @@ func (s *CompanyService) UpdateCompany(id uint, req UpdateCompanyRequest) (*Comp
 	if req.Address != nil {
 		company.Address = req.Address
 	}
+	if req.CostingMethod != nil {
+		if *req.CostingMethod != WeightedAverage && *req.CostingMethod != FIFO {
+			return nil, ErrInvalidCostingMethod
+		}
+		company.CostingMethod = *req.CostingMethod
+	}
 
 	if err := s.db.Save(&company).Error; err != nil {
 		return nil, err
@@ -0,0 +1,66 @@
+package Customer
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Customer is a buyer registered with a company. Contacts are unique per company
+// so the same buyer is not registered twice.
+type Customer struct {
+	gorm.Model
+	CompanyID   uint     `json:"companyId" gorm:"not null;uniqueIndex:idx_customer_company_contact,where:deleted_at IS NULL"`
+	Name        string   `json:"name" gorm:"not null"`
+	Contact     *string  `json:"contact,omitempty" gorm:"uniqueIndex:idx_customer_company_contact,where:deleted_at IS NULL"` // Normalized phone number or email
+	Email       *string  `json:"email,omitempty"`
+	Location    *string  `json:"location,omitempty"`
+	Notes       *string  `json:"notes,omitempty"`
+	CreditLimit *float64 `json:"creditLimit,omitempty"` // Maximum outstanding balance; nil means no limit
+
+	// Computed fields for JSON response (not stored in DB)
+	Balance float64 `json:"balance" gorm:"-"` // Outstanding balance across the customer's sales
+}
+
+type CreateCustomerRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Contact     *string  `json:"contact,omitempty"`
+	Email       *string  `json:"email,omitempty"`
+	Location    *string  `json:"location,omitempty"`
+	Notes       *string  `json:"notes,omitempty"`
+	CreditLimit *float64 `json:"creditLimit,omitempty"`
+	CompanyID   uint     `json:"companyId"` // Optional - set from token
+}
+
+type UpdateCustomerRequest struct {
+	Name        *string  `json:"name,omitempty"`
+	Contact     *string  `json:"contact,omitempty"`
+	Email       *string  `json:"email,omitempty"`
+	Location    *string  `json:"location,omitempty"`
+	Notes       *string  `json:"notes,omitempty"`
+	CreditLimit *float64 `json:"creditLimit,omitempty"`
+}
+
+// StatementEntry is one line of a customer statement. Sales, orders and refunds are
+// debits, payments and returns are credits, and Balance is the running balance after the entry.
+type StatementEntry struct {
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"` // "sale", "order", "payment", "return" or "refund"
+	ReferenceID uint      `json:"referenceId"`
+	Description string    `json:"description"`
+	Debit       float64   `json:"debit"`
+	Credit      float64   `json:"credit"`
+	Balance     float64   `json:"balance"`
+}
+
+// Statement lists a customer's sales, payments and returns with a running balance
+type Statement struct {
+	Customer       *Customer        `json:"customer"`
+	From           *time.Time       `json:"from,omitempty"`
+	To             *time.Time       `json:"to,omitempty"`
+	OpeningBalance float64          `json:"openingBalance"`
+	TotalDebits    float64          `json:"totalDebits"`
+	TotalCredits   float64          `json:"totalCredits"`
+	ClosingBalance float64          `json:"closingBalance"`
+	Entries        []StatementEntry `json:"entries"`
+}
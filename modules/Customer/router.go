@@ -0,0 +1,196 @@
+package Customer
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+func RegisterRoutes(rg *gin.RouterGroup) {
+	customers := rg.Group("/customers")
+	{
+		customers.GET("", User.RequirePermission(User.PermCustomersRead), getAllCustomersHandler)
+		customers.GET("/:id", User.RequirePermission(User.PermCustomersRead), getCustomerHandler)
+		customers.GET("/:id/statement", User.RequirePermission(User.PermCustomersRead), getCustomerStatementHandler)
+		customers.POST("", User.RequirePermission(User.PermCustomersWrite), createCustomerHandler)
+		customers.PUT("/:id", User.RequirePermission(User.PermCustomersWrite), updateCustomerHandler)
+		customers.DELETE("/:id", User.RequirePermission(User.PermCustomersDelete), deleteCustomerHandler)
+	}
+}
+
+// customerListSpec is what GET /customers sorts by. ?q= is matched by the service.
+var customerListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"name":      "name",
+		"createdAt": "created_at",
+	},
+	DefaultSort: "name",
+	DateColumn:  "created_at",
+}
+
+func getAllCustomersHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	params, ok := Query.FromContext(c, customerListSpec)
+	if !ok {
+		return
+	}
+
+	customers, page, err := GetCustomerService().ListCustomers(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"customers": customers, "page": page})
+}
+
+func getCustomerHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	customer, err := GetCustomerService().GetCustomerByID(uint(id), companyID)
+	if err != nil {
+		customerErrorResponse(c, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, customer)
+}
+
+// getCustomerStatementHandler returns the customer's sales and payments with a running balance.
+// Optional from/to query parameters (RFC3339) limit the period.
+func getCustomerStatementHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	var from, to *time.Time
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from format"})
+			return
+		}
+		from = &parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to format"})
+			return
+		}
+		to = &parsed
+	}
+
+	statement, err := GetCustomerService().GetStatement(uint(id), companyID, from, to)
+	if err != nil {
+		customerErrorResponse(c, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, statement)
+}
+
+func createCustomerHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreateCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.CompanyID = companyID
+
+	customer, err := GetCustomerService().CreateCustomer(req)
+	if err != nil {
+		customerErrorResponse(c, err, customer)
+		return
+	}
+	c.JSON(http.StatusCreated, customer)
+}
+
+func updateCustomerHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	var req UpdateCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := GetCustomerService().UpdateCustomer(uint(id), companyID, req)
+	if err != nil {
+		customerErrorResponse(c, err, customer)
+		return
+	}
+	c.JSON(http.StatusOK, customer)
+}
+
+func deleteCustomerHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	if err := GetCustomerService().DeleteCustomer(uint(id), companyID); err != nil {
+		customerErrorResponse(c, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "customer deleted successfully"})
+}
+
+// customerErrorResponse writes a service error with its status and code.
+// existing is the conflicting customer for duplicate contacts.
+func customerErrorResponse(c *gin.Context, err error, existing *Customer) {
+	switch {
+	case errors.Is(err, ErrCustomerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "CUSTOMER_NOT_FOUND"})
+	case errors.Is(err, ErrDuplicateContact):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "CUSTOMER_EXISTS", "customer": existing})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
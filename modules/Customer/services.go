@@ -0,0 +1,465 @@
+package Customer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var customerService *CustomerService
+
+var (
+	// ErrCustomerNotFound is returned when a customer does not exist in the caller's company
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrDuplicateContact is returned when another customer of the company already uses the contact
+	ErrDuplicateContact = errors.New("a customer with this contact already exists")
+	// ErrCreditLimitExceeded is returned when a credit sale would take a customer over their credit limit
+	ErrCreditLimitExceeded = errors.New("sale would exceed the customer's credit limit")
+)
+
+type CustomerService struct {
+	db *gorm.DB
+}
+
+func NewCustomerService() *CustomerService {
+	return &CustomerService{}
+}
+
+// InitializeService initializes the customer service with a database connection
+func InitializeService(db *gorm.DB) {
+	customerService = &CustomerService{db: db}
+}
+
+// GetCustomerService returns the initialized customer service
+func GetCustomerService() *CustomerService {
+	return customerService
+}
+
+// NormalizeContact strips formatting from a phone number or email so the same
+// contact written differently is recognised as one customer
+func NormalizeContact(contact string) string {
+	replacer := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+	return strings.ToLower(replacer.Replace(strings.TrimSpace(contact)))
+}
+
+func normalizeContactPtr(contact *string) *string {
+	if contact == nil {
+		return nil
+	}
+	normalized := NormalizeContact(*contact)
+	if normalized == "" {
+		return nil
+	}
+	return &normalized
+}
+
+func (s *CustomerService) GetCustomerByID(id uint, companyID uint) (*Customer, error) {
+	var customer Customer
+	if err := s.db.Where("id = ? AND company_id = ?", id, companyID).First(&customer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	s.populateBalances(s.db, &customer)
+	return &customer, nil
+}
+
+// ListCustomers returns one page of a company's customers matching params.
+// ?q= matches the name, or the contact after normalizing it like stored contacts.
+func (s *CustomerService) ListCustomers(companyID uint, params *Query.Params) ([]*Customer, *Query.Page, error) {
+	query := s.db.Model(&Customer{}).Where("company_id = ?", companyID)
+	if search := params.Search; search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR contact LIKE ?", like, "%"+NormalizeContact(search)+"%")
+	}
+
+	var customers []*Customer
+	page, err := Query.Paginate(query, params, &customers)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.populateBalances(s.db, customers...)
+	return customers, page, nil
+}
+
+func (s *CustomerService) CreateCustomer(req CreateCustomerRequest) (*Customer, error) {
+	customer := &Customer{
+		CompanyID:   req.CompanyID,
+		Name:        strings.TrimSpace(req.Name),
+		Contact:     normalizeContactPtr(req.Contact),
+		Email:       req.Email,
+		Location:    req.Location,
+		Notes:       req.Notes,
+		CreditLimit: req.CreditLimit,
+	}
+
+	if customer.Contact != nil {
+		if existing, err := s.findByContact(s.db, req.CompanyID, *customer.Contact); err == nil {
+			return existing, ErrDuplicateContact
+		} else if err != ErrCustomerNotFound {
+			return nil, err
+		}
+	}
+
+	if err := s.db.Create(customer).Error; err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (s *CustomerService) UpdateCustomer(id uint, companyID uint, req UpdateCustomerRequest) (*Customer, error) {
+	var customer Customer
+	if err := s.db.Where("id = ? AND company_id = ?", id, companyID).First(&customer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+
+	if req.Contact != nil {
+		contact := normalizeContactPtr(req.Contact)
+		if contact != nil {
+			if existing, err := s.findByContact(s.db, companyID, *contact); err == nil && existing.ID != customer.ID {
+				return existing, ErrDuplicateContact
+			} else if err != nil && err != ErrCustomerNotFound {
+				return nil, err
+			}
+		}
+		customer.Contact = contact
+	}
+	if req.Name != nil {
+		customer.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Email != nil {
+		customer.Email = req.Email
+	}
+	if req.Location != nil {
+		customer.Location = req.Location
+	}
+	if req.Notes != nil {
+		customer.Notes = req.Notes
+	}
+	if req.CreditLimit != nil {
+		customer.CreditLimit = req.CreditLimit
+	}
+
+	if err := s.db.Save(&customer).Error; err != nil {
+		return nil, err
+	}
+
+	s.populateBalances(s.db, &customer)
+	return &customer, nil
+}
+
+func (s *CustomerService) DeleteCustomer(id uint, companyID uint) error {
+	var customer Customer
+	if err := s.db.Where("id = ? AND company_id = ?", id, companyID).First(&customer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrCustomerNotFound
+		}
+		return err
+	}
+	return s.db.Delete(&customer).Error
+}
+
+// ResolveCustomerTx returns the customer a sale should be linked to and locks their row
+// until tx commits, so concurrent credit sales see each other's balances.
+// An explicit customerID wins; otherwise the buyer contact is matched against existing
+// customers and a new customer is registered when there is no match.
+// It returns nil when there is neither a customer ID nor a contact.
+func (s *CustomerService) ResolveCustomerTx(tx *gorm.DB, companyID uint, customerID *uint, name, contact, location *string) (*Customer, error) {
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+
+	if customerID != nil {
+		var customer Customer
+		if err := locked.Where("id = ? AND company_id = ?", *customerID, companyID).First(&customer).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, ErrCustomerNotFound
+			}
+			return nil, err
+		}
+		return &customer, nil
+	}
+
+	normalized := normalizeContactPtr(contact)
+	if normalized == nil {
+		return nil, nil
+	}
+
+	if customer, err := s.findByContact(locked, companyID, *normalized); err == nil {
+		return customer, nil
+	} else if err != ErrCustomerNotFound {
+		return nil, err
+	}
+
+	customerName := *normalized
+	if name != nil && strings.TrimSpace(*name) != "" {
+		customerName = strings.TrimSpace(*name)
+	}
+	customer := &Customer{
+		CompanyID: companyID,
+		Name:      customerName,
+		Contact:   normalized,
+		Location:  location,
+	}
+	// A concurrent first sale to the same contact waits here on the unique index and,
+	// once it commits, links to the customer registered by that sale
+	insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(customer)
+	if insert.Error != nil {
+		return nil, insert.Error
+	}
+	if insert.RowsAffected == 0 {
+		return s.findByContact(locked, companyID, *normalized)
+	}
+	return customer, nil
+}
+
+// CheckCreditLimitTx rejects additionalBalance when it would take the customer's
+// outstanding balance over their credit limit. Customers without a limit always pass.
+func (s *CustomerService) CheckCreditLimitTx(tx *gorm.DB, customer *Customer, additionalBalance float64) error {
+	if customer == nil || customer.CreditLimit == nil || additionalBalance <= 0 {
+		return nil
+	}
+	outstanding, err := s.outstandingBalance(tx, customer.ID)
+	if err != nil {
+		return err
+	}
+	if outstanding+additionalBalance > *customer.CreditLimit+0.005 {
+		return fmt.Errorf("%w (limit %.2f, outstanding %.2f)", ErrCreditLimitExceeded, *customer.CreditLimit, outstanding)
+	}
+	return nil
+}
+
+// GetStatement lists the customer's sales, orders, payments, returns and refunds with a
+// running balance. Sales and orders are shown at what was sold, and returns and voids
+// are credited when they were made. When from is set, earlier activity is folded into
+// the opening balance.
+func (s *CustomerService) GetStatement(id uint, companyID uint, from, to *time.Time) (*Statement, error) {
+	customer, err := s.GetCustomerByID(id, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sales []struct {
+		ID          uint
+		CreatedAt   time.Time
+		ProductName string
+		Quantity    int
+		TotalPrice  float64
+		Currency    string
+	}
+	// Sales keep only what is still sold; adding the returns back gives what was sold
+	if err := s.db.Table("sales").
+		Select("id, created_at, product_name, quantity + returned_quantity AS quantity, total_price + returned_amount AS total_price, currency").
+		Where("customer_id = ? AND order_id IS NULL AND deleted_at IS NULL", id).
+		Scan(&sales).Error; err != nil {
+		return nil, err
+	}
+
+	var orders []struct {
+		ID         uint
+		CreatedAt  time.Time
+		TotalPrice float64
+		Currency   string
+		ItemCount  int
+	}
+	if err := s.db.Table("orders").
+		Select("orders.id, orders.created_at, orders.total_price + (SELECT COALESCE(SUM(sales.returned_amount), 0) FROM sales WHERE sales.order_id = orders.id AND sales.deleted_at IS NULL) AS total_price, orders.currency, (SELECT COUNT(*) FROM sales WHERE sales.order_id = orders.id AND sales.deleted_at IS NULL) AS item_count").
+		Where("orders.customer_id = ? AND orders.deleted_at IS NULL", id).
+		Scan(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	var payments []struct {
+		ID       uint
+		PaidAt   time.Time
+		Amount   float64
+		Currency string
+		Method   string
+		SaleID   *uint
+		OrderID  *uint
+	}
+	if err := s.db.Table("payments").
+		Select("id, paid_at, amount, currency, method, sale_id, order_id").
+		Where("deleted_at IS NULL").
+		Where(s.db.Where("sale_id IN (?)", s.db.Table("sales").Select("id").Where("customer_id = ? AND deleted_at IS NULL", id)).
+			Or("order_id IN (?)", s.db.Table("orders").Select("id").Where("customer_id = ? AND deleted_at IS NULL", id))).
+		Scan(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	var returns []struct {
+		ID          uint
+		CreatedAt   time.Time
+		SaleID      uint
+		OrderID     *uint
+		Kind        string
+		ProductName string
+		Quantity    int
+		Amount      float64
+	}
+	if err := s.db.Table("sale_returns").
+		Select("sale_returns.id, sale_returns.created_at, sale_returns.sale_id, sale_returns.order_id, sale_returns.kind, sale_returns.product_name, sale_returns.quantity, sale_returns.amount").
+		Joins("JOIN sales ON sale_returns.sale_id = sales.id").
+		Where("sales.customer_id = ? AND sales.deleted_at IS NULL AND sale_returns.deleted_at IS NULL", id).
+		Scan(&returns).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make([]StatementEntry, 0, len(sales)+len(orders)+len(payments)+len(returns))
+	for _, sale := range sales {
+		entries = append(entries, StatementEntry{
+			Date:        sale.CreatedAt,
+			Type:        "sale",
+			ReferenceID: sale.ID,
+			Description: fmt.Sprintf("%d x %s", sale.Quantity, sale.ProductName),
+			Debit:       sale.TotalPrice,
+		})
+	}
+	for _, order := range orders {
+		entries = append(entries, StatementEntry{
+			Date:        order.CreatedAt,
+			Type:        "order",
+			ReferenceID: order.ID,
+			Description: fmt.Sprintf("Order #%d (%d items)", order.ID, order.ItemCount),
+			Debit:       order.TotalPrice,
+		})
+	}
+	for _, payment := range payments {
+		// Refunds are stored as negative payments and give money back to the customer
+		entry := StatementEntry{
+			Date:        payment.PaidAt,
+			Type:        "payment",
+			ReferenceID: payment.ID,
+			Credit:      payment.Amount,
+		}
+		description := fmt.Sprintf("Payment by %s", payment.Method)
+		if payment.Amount < 0 {
+			entry.Type = "refund"
+			entry.Credit = 0
+			entry.Debit = -payment.Amount
+			description = fmt.Sprintf("Refund by %s", payment.Method)
+		}
+		if payment.SaleID != nil {
+			description = fmt.Sprintf("%s for sale #%d", description, *payment.SaleID)
+		} else if payment.OrderID != nil {
+			description = fmt.Sprintf("%s for order #%d", description, *payment.OrderID)
+		}
+		entry.Description = description
+		entries = append(entries, entry)
+	}
+	for _, saleReturn := range returns {
+		description := fmt.Sprintf("Return of %d x %s from sale #%d", saleReturn.Quantity, saleReturn.ProductName, saleReturn.SaleID)
+		if saleReturn.Kind == "void" {
+			description = fmt.Sprintf("Void of %d x %s from sale #%d", saleReturn.Quantity, saleReturn.ProductName, saleReturn.SaleID)
+		}
+		if saleReturn.OrderID != nil {
+			description = fmt.Sprintf("%s (order #%d)", description, *saleReturn.OrderID)
+		}
+		entries = append(entries, StatementEntry{
+			Date:        saleReturn.CreatedAt,
+			Type:        "return",
+			ReferenceID: saleReturn.ID,
+			Description: description,
+			Credit:      saleReturn.Amount,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	statement := &Statement{Customer: customer, From: from, To: to, Entries: []StatementEntry{}}
+	balance := 0.0
+	for _, entry := range entries {
+		if to != nil && entry.Date.After(*to) {
+			break
+		}
+		balance += entry.Debit - entry.Credit
+		if from != nil && entry.Date.Before(*from) {
+			statement.OpeningBalance = balance
+			continue
+		}
+		entry.Balance = balance
+		statement.TotalDebits += entry.Debit
+		statement.TotalCredits += entry.Credit
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+func (s *CustomerService) findByContact(db *gorm.DB, companyID uint, contact string) (*Customer, error) {
+	var customer Customer
+	if err := db.Where("company_id = ? AND contact = ?", companyID, contact).First(&customer).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// outstandingBalance sums the unpaid balances of the customer's standalone sales and orders
+func (s *CustomerService) outstandingBalance(db *gorm.DB, customerID uint) (float64, error) {
+	balances, err := s.outstandingBalances(db, []uint{customerID})
+	if err != nil {
+		return 0, err
+	}
+	return balances[customerID], nil
+}
+
+// outstandingBalances is outstandingBalance for several customers, with one query each
+// for sales and orders. Customers who owe nothing are left out of the map.
+func (s *CustomerService) outstandingBalances(db *gorm.DB, customerIDs []uint) (map[uint]float64, error) {
+	balances := make(map[uint]float64, len(customerIDs))
+	if len(customerIDs) == 0 {
+		return balances, nil
+	}
+
+	type customerBalance struct {
+		CustomerID uint
+		Balance    float64
+	}
+	var sales, orders []customerBalance
+	if err := db.Table("sales").
+		Select("customer_id, COALESCE(SUM(total_price - amount_paid), 0) AS balance").
+		Where("customer_id IN ? AND order_id IS NULL AND deleted_at IS NULL", customerIDs).
+		Group("customer_id").
+		Scan(&sales).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Table("orders").
+		Select("customer_id, COALESCE(SUM(total_price - amount_paid), 0) AS balance").
+		Where("customer_id IN ? AND deleted_at IS NULL", customerIDs).
+		Group("customer_id").
+		Scan(&orders).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range append(sales, orders...) {
+		balances[row.CustomerID] += row.Balance
+	}
+	return balances, nil
+}
+
+// populateBalances fills the computed outstanding balances
+func (s *CustomerService) populateBalances(db *gorm.DB, customers ...*Customer) {
+	ids := make([]uint, 0, len(customers))
+	for _, customer := range customers {
+		ids = append(ids, customer.ID)
+	}
+	balances, err := s.outstandingBalances(db, ids)
+	if err != nil {
+		return
+	}
+	for _, customer := range customers {
+		customer.Balance = balances[customer.ID]
+	}
+}
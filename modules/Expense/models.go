@@ -4,14 +4,23 @@ import (
 	"gorm.io/gorm"
 )
 
+type SyncStatus string
+
+const (
+	Online  SyncStatus = "online"
+	Offline SyncStatus = "offline"
+	Synced  SyncStatus = "synced"
+)
+
 type Expense struct {
 	gorm.Model
-	Amount      float64 `json:"amount" gorm:"not null"`
-	Description string  `json:"description" gorm:"not null"`
-	Category    string  `json:"category"` // e.g. "Food", "Airtime", "Transport", "Other"
-	Currency    string  `json:"currency" gorm:"not null"`
-	UserID      uint    `json:"userId" gorm:"not null;index"`
-	BranchID    uint    `json:"branchId" gorm:"not null;index"`
+	Amount      float64     `json:"amount" gorm:"not null"`
+	Description string      `json:"description" gorm:"not null"`
+	Category    string      `json:"category"` // e.g. "Food", "Airtime", "Transport", "Other"
+	Currency    string      `json:"currency" gorm:"not null"`
+	UserID      uint        `json:"userId" gorm:"not null;index"`
+	BranchID    uint        `json:"branchId" gorm:"not null;index"`
+	SyncStatus  *SyncStatus `json:"syncStatus,omitempty"`
 
 	// Relationships (for JSON response - computed from FKs)
 	User   *UserResponse   `json:"user,omitempty" gorm:"-"`
@@ -6,78 +6,137 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 )
 
 func RegisterRoutes(rg *gin.RouterGroup) {
 	expenses := rg.Group("/expenses")
 	{
-		expenses.GET("", getAllExpensesHandler)
-		expenses.GET("/:id", getExpenseHandler)
-		expenses.GET("/user/:userId", getExpensesByUserHandler)
-		expenses.GET("/branch/:branchId", getExpensesByBranchHandler)
-		expenses.GET("/date-range", getExpensesByDateRangeHandler)
-		expenses.POST("", createExpenseHandler)
-		expenses.PUT("/:id", updateExpenseHandler)
-		expenses.DELETE("/:id", deleteExpenseHandler)
+		expenses.GET("", User.RequirePermission(User.PermExpensesRead), getAllExpensesHandler)
+		expenses.GET("/:id", User.RequirePermission(User.PermExpensesRead), getExpenseHandler)
+		expenses.GET("/user/:userId", User.RequirePermission(User.PermExpensesRead), getExpensesByUserHandler)
+		expenses.GET("/branch/:branchId", User.RequirePermission(User.PermExpensesRead), getExpensesByBranchHandler)
+		expenses.GET("/date-range", User.RequirePermission(User.PermExpensesRead), getExpensesByDateRangeHandler)
+		expenses.POST("", User.RequirePermission(User.PermExpensesWrite), Idempotency.Middleware(), createExpenseHandler)
+		expenses.PUT("/:id", User.RequirePermission(User.PermExpensesManage), updateExpenseHandler)
+		expenses.DELETE("/:id", User.RequirePermission(User.PermExpensesManage), deleteExpenseHandler)
 	}
 }
 
+// expenseListSpec is what GET /expenses and its per-user, per-branch and date-range variants sort and filter by
+var expenseListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"createdAt": "created_at",
+		"amount":    "amount",
+		"category":  "category",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId": {Column: "branch_id", Kind: Query.UintFilter},
+		"userId":   {Column: "user_id", Kind: Query.UintFilter},
+		"category": {Column: "category"},
+		"currency": {Column: "currency"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"description", "category"},
+}
+
 func getAllExpensesHandler(c *gin.Context) {
-	expenses, err := GetExpenseService().GetAllExpenses()
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, expenseListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	listExpenses(c, companyID, params)
+}
+
+func listExpenses(c *gin.Context, companyID uint, params *Query.Params) {
+	expenses, page, err := GetExpenseService().ListExpenses(companyID, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		Query.ErrorResponse(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	c.JSON(http.StatusOK, gin.H{"expenses": expenses, "page": page})
 }
 
 func getExpenseHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expense id"})
 		return
 	}
-	expense, err := GetExpenseService().GetExpenseByID(uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	expense, err := GetExpenseService().GetExpenseByID(uint(id), companyID)
+	if err != nil || !User.CanAccessBranch(c, expense.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "expense not found"})
 		return
 	}
 	c.JSON(http.StatusOK, expense)
 }
 
 func getExpensesByUserHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	userIDParam := c.Param("userId")
 	userID, err := strconv.ParseUint(userIDParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
 		return
 	}
-	expenses, err := GetExpenseService().GetExpensesByUser(uint(userID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	params, ok := Query.FromContext(c, expenseListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	params.Set("userId", uint(userID))
+
+	listExpenses(c, companyID, params)
 }
 
 func getExpensesByBranchHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	branchIDParam := c.Param("branchId")
 	branchID, err := strconv.ParseUint(branchIDParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
 		return
 	}
-	expenses, err := GetExpenseService().GetExpensesByBranch(uint(branchID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !User.CanAccessBranch(c, uint(branchID)) {
+		User.BranchAccessDenied(c)
+		return
+	}
+	params, ok := Query.FromContext(c, expenseListSpec)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	params.Set("branchId", uint(branchID))
+
+	listExpenses(c, companyID, params)
 }
 
 func getExpensesByDateRangeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	startDateStr := c.Query("startDate")
 	endDateStr := c.Query("endDate")
 
@@ -93,12 +152,14 @@ func getExpensesByDateRangeHandler(c *gin.Context) {
 		return
 	}
 
-	expenses, err := GetExpenseService().GetExpensesByDateRange(startDate, endDate)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	params, ok := Query.FromContext(c, expenseListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	params.From = &startDate
+	params.To = &endDate
+
+	listExpenses(c, companyID, params)
 }
 
 func createExpenseHandler(c *gin.Context) {
@@ -140,6 +201,11 @@ func createExpenseHandler(c *gin.Context) {
 }
 
 func updateExpenseHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
@@ -153,8 +219,17 @@ func updateExpenseHandler(c *gin.Context) {
 		return
 	}
 
-	expense, err := GetExpenseService().UpdateExpense(uint(id), req)
+	if existing, err := GetExpenseService().GetExpenseByID(uint(id), companyID); err != nil || !User.CanAccessBranch(c, existing.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "expense not found"})
+		return
+	}
+
+	expense, err := GetExpenseService().UpdateExpense(uint(id), companyID, req)
 	if err != nil {
+		if err.Error() == "expense not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -163,13 +238,23 @@ func updateExpenseHandler(c *gin.Context) {
 }
 
 func deleteExpenseHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expense id"})
 		return
 	}
-	if err := GetExpenseService().DeleteExpense(uint(id)); err != nil {
+	if existing, err := GetExpenseService().GetExpenseByID(uint(id), companyID); err != nil || !User.CanAccessBranch(c, existing.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "expense not found"})
+		return
+	}
+
+	if err := GetExpenseService().DeleteExpense(uint(id), companyID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,75 @@
+package Expense
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+)
+
+// A company's users can neither see nor change another company's expenses
+func TestExpensesAreScopedToCompany(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	r := Testutil.NewRouter(RegisterRoutes)
+	own := newExpense(t, db, a.Owner)
+	foreign := newExpense(t, db, b.Owner)
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/expenses/%d", ""},
+		{http.MethodPut, "/api/v1/expenses/%d", `{"amount": 500}`},
+		{http.MethodDelete, "/api/v1/expenses/%d", ""},
+	} {
+		path := fmt.Sprintf(tc.path, foreign.ID)
+		w := Testutil.Serve(r, tc.method, path, a.Token, tc.body)
+		if w.Code != http.StatusNotFound && w.Code != http.StatusForbidden {
+			t.Errorf("%s %s as company A: %d %s, want 404 or 403", tc.method, path, w.Code, w.Body)
+		}
+	}
+
+	var after Expense
+	if err := db.First(&after, foreign.ID).Error; err != nil {
+		t.Fatalf("company B's expense: %v", err)
+	}
+	if after.Amount != foreign.Amount {
+		t.Errorf("company B's expense amount changed to %v", after.Amount)
+	}
+
+	dates := url.Values{
+		"startDate": {time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		"endDate":   {time.Now().Add(time.Hour).Format(time.RFC3339)},
+	}
+	for _, path := range []string{
+		"/api/v1/expenses",
+		fmt.Sprintf("/api/v1/expenses?branchId=%d", b.Branch.ID),
+		fmt.Sprintf("/api/v1/expenses/user/%d", b.Owner.ID),
+		fmt.Sprintf("/api/v1/expenses/branch/%d", b.Branch.ID),
+		"/api/v1/expenses/date-range?" + dates.Encode(),
+	} {
+		w := Testutil.Serve(r, http.MethodGet, path, a.Token)
+		if w.Code == http.StatusNotFound || w.Code == http.StatusForbidden {
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s as company A: %d %s", path, w.Code, w.Body)
+			continue
+		}
+		var body struct{ Expenses []*Expense }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		for _, expense := range body.Expenses {
+			if expense.ID != own.ID {
+				t.Errorf("GET %s as company A listed expense %d of company B", path, expense.ID)
+			}
+		}
+		if path == "/api/v1/expenses" && len(body.Expenses) != 1 {
+			t.Errorf("GET %s as company A listed %d expenses, want its own one", path, len(body.Expenses))
+		}
+	}
+}
@@ -2,10 +2,9 @@ package Expense
 
 import (
 	"errors"
-	"time"
 
 	"gorm.io/gorm"
-	Branch "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Branch"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 )
 
@@ -27,9 +26,9 @@ func GetExpenseService() *ExpenseService {
 	return expenseService
 }
 
-func (s *ExpenseService) GetExpenseByID(id uint) (*Expense, error) {
+func (s *ExpenseService) GetExpenseByID(id uint, companyID uint) (*Expense, error) {
 	var expense Expense
-	if err := s.db.First(&expense, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(User.CompanyBranchScope("branch_id", companyID)).First(&expense, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("expense not found")
 		}
@@ -39,51 +38,31 @@ func (s *ExpenseService) GetExpenseByID(id uint) (*Expense, error) {
 	return &expense, nil
 }
 
-func (s *ExpenseService) GetAllExpenses() ([]*Expense, error) {
-	var expenses []*Expense
-	if err := s.db.Find(&expenses).Error; err != nil {
-		return nil, err
-	}
-	for i := range expenses {
-		s.populateRelations(expenses[i])
-	}
-	return expenses, nil
-}
+// ListExpenses returns one page of the company's expenses matching params
+func (s *ExpenseService) ListExpenses(companyID uint, params *Query.Params) ([]*Expense, *Query.Page, error) {
+	query := s.db.Model(&Expense{}).Scopes(User.CompanyBranchScope("branch_id", companyID))
 
-func (s *ExpenseService) GetExpensesByUser(userID uint) ([]*Expense, error) {
 	var expenses []*Expense
-	if err := s.db.Where("user_id = ?", userID).Find(&expenses).Error; err != nil {
-		return nil, err
-	}
-	for i := range expenses {
-		s.populateRelations(expenses[i])
+	page, err := Query.Paginate(query, params, &expenses)
+	if err != nil {
+		return nil, nil, err
 	}
-	return expenses, nil
+	s.PopulateExpenses(expenses)
+	return expenses, page, nil
 }
 
-func (s *ExpenseService) GetExpensesByBranch(branchID uint) ([]*Expense, error) {
-	var expenses []*Expense
-	if err := s.db.Where("branch_id = ?", branchID).Find(&expenses).Error; err != nil {
+func (s *ExpenseService) CreateExpense(req CreateExpenseRequest) (*Expense, error) {
+	expense, err := s.CreateExpenseTx(s.db, req)
+	if err != nil {
 		return nil, err
 	}
-	for i := range expenses {
-		s.populateRelations(expenses[i])
-	}
-	return expenses, nil
-}
 
-func (s *ExpenseService) GetExpensesByDateRange(startDate, endDate time.Time) ([]*Expense, error) {
-	var expenses []*Expense
-	if err := s.db.Where("created_at >= ? AND created_at <= ?", startDate, endDate).Find(&expenses).Error; err != nil {
-		return nil, err
-	}
-	for i := range expenses {
-		s.populateRelations(expenses[i])
-	}
-	return expenses, nil
+	s.populateRelations(expense)
+	return expense, nil
 }
 
-func (s *ExpenseService) CreateExpense(req CreateExpenseRequest) (*Expense, error) {
+// CreateExpenseTx records an expense inside tx. User and branch information is not populated.
+func (s *ExpenseService) CreateExpenseTx(tx *gorm.DB, req CreateExpenseRequest) (*Expense, error) {
 	expense := &Expense{
 		Amount:      req.Amount,
 		Description: req.Description,
@@ -93,17 +72,15 @@ func (s *ExpenseService) CreateExpense(req CreateExpenseRequest) (*Expense, erro
 		BranchID:    req.BranchID,
 	}
 
-	if err := s.db.Create(expense).Error; err != nil {
+	if err := tx.Create(expense).Error; err != nil {
 		return nil, err
 	}
-
-	s.populateRelations(expense)
 	return expense, nil
 }
 
-func (s *ExpenseService) UpdateExpense(id uint, req UpdateExpenseRequest) (*Expense, error) {
+func (s *ExpenseService) UpdateExpense(id uint, companyID uint, req UpdateExpenseRequest) (*Expense, error) {
 	var expense Expense
-	if err := s.db.First(&expense, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(User.CompanyBranchScope("branch_id", companyID)).First(&expense, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("expense not found")
 		}
@@ -131,9 +108,9 @@ func (s *ExpenseService) UpdateExpense(id uint, req UpdateExpenseRequest) (*Expe
 	return &expense, nil
 }
 
-func (s *ExpenseService) DeleteExpense(id uint) error {
+func (s *ExpenseService) DeleteExpense(id uint, companyID uint) error {
 	var expense Expense
-	if err := s.db.First(&expense, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(User.CompanyBranchScope("branch_id", companyID)).First(&expense, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return errors.New("expense not found")
 		}
@@ -143,21 +120,39 @@ func (s *ExpenseService) DeleteExpense(id uint) error {
 }
 
 func (s *ExpenseService) populateRelations(expense *Expense) {
-	if expense.UserID != 0 {
-		user, err := User.GetUserService().GetUserByID(expense.UserID)
-		if err == nil && user != nil {
+	s.PopulateExpenses([]*Expense{expense})
+}
+
+// PopulateExpenses populates user and branch information of many expenses with one query each
+func (s *ExpenseService) PopulateExpenses(expenses []*Expense) {
+	var userIDs, branchIDs []uint
+	seenUsers := make(map[uint]bool)
+	seenBranches := make(map[uint]bool)
+	for _, expense := range expenses {
+		if expense.UserID != 0 && !seenUsers[expense.UserID] {
+			seenUsers[expense.UserID] = true
+			userIDs = append(userIDs, expense.UserID)
+		}
+		if expense.BranchID != 0 && !seenBranches[expense.BranchID] {
+			seenBranches[expense.BranchID] = true
+			branchIDs = append(branchIDs, expense.BranchID)
+		}
+	}
+
+	// Relations that fail to load are left empty, like those of a deleted user or branch
+	users, _ := User.GetUserService().GetUserSummaries(userIDs)
+	branchNames, _ := User.GetBranchService().GetBranchNames(branchIDs)
+	for _, expense := range expenses {
+		if user, ok := users[expense.UserID]; ok {
 			expense.User = &UserResponse{
 				ID:   user.ID,
 				Name: user.Name,
 			}
 		}
-	}
-	if expense.BranchID != 0 {
-		var branch Branch.Branch
-		if err := s.db.First(&branch, "id = ?", expense.BranchID).Error; err == nil {
+		if name, ok := branchNames[expense.BranchID]; ok {
 			expense.Branch = &BranchResponse{
-				ID:   branch.ID,
-				Name: branch.Name,
+				ID:   expense.BranchID,
+				Name: name,
 			}
 		}
 	}
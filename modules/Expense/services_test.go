@@ -0,0 +1,85 @@
+package Expense
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a throwaway database with the expense tables and initializes the services on it
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t, &Idempotency.IdempotencyKey{}, &Expense{})
+	Idempotency.InitializeService(db)
+	InitializeService(db)
+	return db
+}
+
+func newExpense(t testing.TB, db *gorm.DB, user *User.UserModel) *Expense {
+	t.Helper()
+	expense := &Expense{Amount: 5, Description: "Airtime", Category: "Airtime", Currency: "UGX", UserID: user.ID, BranchID: *user.BranchID}
+	if err := db.Create(expense).Error; err != nil {
+		t.Fatal(err)
+	}
+	return expense
+}
+
+// Listing expenses loads their users and branches in one query each, so a page of many
+// expenses costs no more queries than a page of one
+func TestListExpensesQueryCount(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	r := Testutil.NewRouter(RegisterRoutes)
+
+	list := func() int {
+		return Testutil.CountQueries(t, db, func() {
+			if w := Testutil.Serve(r, http.MethodGet, "/api/v1/expenses", a.Token); w.Code != http.StatusOK {
+				t.Fatalf("GET /expenses: %d %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	newExpense(t, db, a.Owner)
+	one := list()
+	for i := 0; i < 10; i++ {
+		branch := Testutil.NewBranch(t, db, a.Company.ID, fmt.Sprintf("a Branch %d", i))
+		newExpense(t, db, Testutil.NewUser(t, db, branch, fmt.Sprintf("a-cashier-%d", i), User.Cashier))
+	}
+	if many := list(); many != one {
+		t.Errorf("listing 11 expenses ran %d queries, listing 1 ran %d", many, one)
+	}
+}
+
+// BenchmarkListExpenses lists a page of expenses from as many users and branches. The
+// queries per list, reported as queries/op, stay the same from 1 row to 100.
+func BenchmarkListExpenses(b *testing.B) {
+	for _, rows := range []int{1, 100} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			db := newTestDB(b)
+			a := Testutil.NewTenant(b, db, "a")
+			r := Testutil.NewRouter(RegisterRoutes)
+			newExpense(b, db, a.Owner)
+			for i := 1; i < rows; i++ {
+				branch := Testutil.NewBranch(b, db, a.Company.ID, fmt.Sprintf("a Branch %d", i))
+				newExpense(b, db, Testutil.NewUser(b, db, branch, fmt.Sprintf("a-cashier-%d", i), User.Cashier))
+			}
+			list := func() {
+				if w := Testutil.Serve(r, http.MethodGet, "/api/v1/expenses?limit=100", a.Token); w.Code != http.StatusOK {
+					b.Fatalf("GET /expenses: %d %s", w.Code, w.Body)
+				}
+			}
+
+			queries := Testutil.CountQueries(b, db, list)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				list()
+			}
+			b.ReportMetric(float64(queries), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package Idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderKey is the request header carrying the client's idempotency key
+const HeaderKey = "Idempotency-Key"
+
+// maxKeyLength is the longest key accepted
+const maxKeyLength = 255
+
+// responseRecorder keeps a copy of what the handler writes
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware makes a mutating endpoint safe to retry. The first request with an
+// Idempotency-Key header runs and its response is stored per user and key; retries
+// get that response back with Idempotent-Replayed: true instead of running again.
+// A retry while the first request is still running returns 409, and a key reused
+// for a different request returns 422. Requests without the header run as usual.
+// It must run after AuthMiddleware.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderKey)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key must be at most 255 characters", "code": "INVALID_IDEMPOTENCY_KEY"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		userIDUint, ok := userID.(uint)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user information not found"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		path := c.Request.URL.RequestURI()
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + path + "\n"))
+		hash.Write(body)
+
+		service := GetIdempotencyService()
+		stored, err := service.Begin(userIDUint, key, c.Request.Method, path, hex.EncodeToString(hash.Sum(nil)))
+		switch {
+		case errors.Is(err, ErrInProgress):
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "IDEMPOTENCY_IN_PROGRESS"})
+			c.Abort()
+			return
+		case errors.Is(err, ErrKeyReused):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "IDEMPOTENCY_KEY_REUSED"})
+			c.Abort()
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if stored != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.StatusCode, stored.ContentType, stored.Response)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not stored, so a retry can succeed once the cause is fixed
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			_ = service.Release(userIDUint, key)
+			return
+		}
+		if err := service.Complete(userIDUint, key, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			_ = service.Release(userIDUint, key)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package Idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t, &IdempotencyKey{})
+	InitializeService(db)
+	return db
+}
+
+// newRouter mounts POST /things behind Middleware. The handler counts its runs in runs
+// and answers with the run number and the body it was sent.
+func newRouter(runs *int) *gin.Engine {
+	return Testutil.NewRouter(func(rg *gin.RouterGroup) {
+		rg.POST("/things", Middleware(), func(c *gin.Context) {
+			*runs++
+			body, _ := io.ReadAll(c.Request.Body)
+			c.JSON(http.StatusCreated, gin.H{"run": *runs, "body": string(body)})
+		})
+	})
+}
+
+func post(r http.Handler, token, key, body string) *httptest.ResponseRecorder {
+	req := Testutil.NewRequest(http.MethodPost, "/api/v1/things", token, body)
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct{ Code string }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return body.Code
+}
+
+// A retry with the same key and body gets the stored response back without running again
+func TestReplayReturnsStoredResponse(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	runs := 0
+	r := newRouter(&runs)
+
+	first := post(r, a.Token, "key-1", `{"amount": 5}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: %d replayed=%q %s", first.Code, first.Header().Get("Idempotent-Replayed"), first.Body)
+	}
+	retry := post(r, a.Token, "key-1", `{"amount": 5}`)
+	if retry.Code != http.StatusCreated {
+		t.Errorf("retry: %d %s, want 201", retry.Code, retry.Body)
+	}
+	if got := retry.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Errorf("retry Idempotent-Replayed = %q, want true", got)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body %s, want the stored %s", retry.Body, first.Body)
+	}
+	if runs != 1 {
+		t.Errorf("handler ran %d times, want 1", runs)
+	}
+
+	post(r, a.Token, "", `{"amount": 5}`)
+	if runs != 2 {
+		t.Errorf("a request without a key ran the handler %d times in total, want 2", runs)
+	}
+}
+
+// A key sent again with a different body is rejected instead of replaying the first response
+func TestKeyReusedForDifferentRequest(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	runs := 0
+	r := newRouter(&runs)
+
+	post(r, a.Token, "key-1", `{"amount": 5}`)
+	w := post(r, a.Token, "key-1", `{"amount": 50}`)
+	if w.Code != http.StatusUnprocessableEntity || errorCode(t, w) != "IDEMPOTENCY_KEY_REUSED" {
+		t.Errorf("reused key: %d %s, want 422 IDEMPOTENCY_KEY_REUSED", w.Code, w.Body)
+	}
+	if runs != 1 {
+		t.Errorf("handler ran %d times, want 1", runs)
+	}
+}
+
+// A retry while the first request still holds the key is told to wait
+func TestKeyInProgress(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	runs := 0
+	r := newRouter(&runs)
+
+	// Claim the key the way the middleware does, as if that request were still running
+	hash := sha256.Sum256([]byte("POST /api/v1/things\n" + `{"amount": 5}`))
+	if _, err := GetIdempotencyService().Begin(a.Owner.ID, "key-1", http.MethodPost, "/api/v1/things", hex.EncodeToString(hash[:])); err != nil {
+		t.Fatal(err)
+	}
+
+	w := post(r, a.Token, "key-1", `{"amount": 5}`)
+	if w.Code != http.StatusConflict || errorCode(t, w) != "IDEMPOTENCY_IN_PROGRESS" {
+		t.Errorf("retry in progress: %d %s, want 409 IDEMPOTENCY_IN_PROGRESS", w.Code, w.Body)
+	}
+	if runs != 0 {
+		t.Errorf("handler ran %d times, want 0", runs)
+	}
+}
+
+// Keys belong to the user who sent them, so another company's user with the same key
+// runs their own request and never sees the first company's response
+func TestKeyIsNotReplayedAcrossCompanies(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	runs := 0
+	r := newRouter(&runs)
+
+	first := post(r, a.Token, "key-1", `{"amount": 5}`)
+	other := post(r, b.Token, "key-1", `{"amount": 5}`)
+	if other.Code != http.StatusCreated || other.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("company B with company A's key: %d replayed=%q, want a fresh 201", other.Code, other.Header().Get("Idempotent-Replayed"))
+	}
+	if other.Body.String() == first.Body.String() {
+		t.Errorf("company B got company A's response %s", other.Body)
+	}
+	if runs != 2 {
+		t.Errorf("handler ran %d times, want 2", runs)
+	}
+
+	if retry := post(r, b.Token, "key-1", `{"amount": 5}`); retry.Body.String() != other.Body.String() {
+		t.Errorf("company B's retry got %s, want its own %s", retry.Body, other.Body)
+	}
+}
@@ -0,0 +1,20 @@
+package Idempotency
+
+import "time"
+
+// IdempotencyKey is the first response to a request sent with an Idempotency-Key header.
+// Retries with the same key get this response back instead of running the request again.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time // When the request started, while it is in progress
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `gorm:"not null;size:255;uniqueIndex:idx_idempotency_user_key"`
+	Method      string    `gorm:"not null"`
+	Path        string    `gorm:"not null"`           // Request URI, including the query
+	RequestHash string    `gorm:"not null"`           // SHA-256 of method, URI and body
+	StatusCode  int       `gorm:"not null;default:0"` // 0 while the first request is in progress
+	ContentType string
+	Response    []byte
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
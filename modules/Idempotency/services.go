@@ -0,0 +1,117 @@
+package Idempotency
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var idempotencyService *IdempotencyService
+
+const (
+	// DefaultRetention is how long a response is kept for retries unless
+	// IDEMPOTENCY_RETENTION_HOURS says otherwise
+	DefaultRetention = 24 * time.Hour
+	// LockTimeout is how long a request may hold its key before a retry takes it over,
+	// in case the server stopped before it finished
+	LockTimeout = time.Minute
+)
+
+var (
+	// ErrKeyReused is returned when a key is sent again with a different request
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+	// ErrInProgress is returned while the first request with a key is still running
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+type IdempotencyService struct {
+	db        *gorm.DB
+	retention time.Duration
+}
+
+// InitializeService initializes the idempotency service with a database connection
+func InitializeService(db *gorm.DB) {
+	retention := DefaultRetention
+	if hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_RETENTION_HOURS")); err == nil && hours > 0 {
+		retention = time.Duration(hours) * time.Hour
+	}
+	idempotencyService = &IdempotencyService{db: db, retention: retention}
+}
+
+// GetIdempotencyService returns the initialized idempotency service
+func GetIdempotencyService() *IdempotencyService {
+	return idempotencyService
+}
+
+// Begin claims key for the user's request. It returns nil when the caller should run
+// the request and Complete or Release the key afterwards, and the stored response when
+// the request already ran. A key that expired, or whose request was abandoned for
+// longer than LockTimeout, is claimed again.
+func (s *IdempotencyService) Begin(userID uint, key, method, path, hash string) (*IdempotencyKey, error) {
+	now := time.Now()
+	record := &IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Method:      method,
+		Path:        path,
+		RequestHash: hash,
+		ExpiresAt:   now.Add(s.retention),
+	}
+
+	var stored *IdempotencyKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND expires_at < ?", userID, now).Delete(&IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		// A concurrent request with the same key waits here on the unique index
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		if insert.RowsAffected == 1 {
+			return nil
+		}
+
+		var existing IdempotencyKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+			return err
+		}
+		if existing.RequestHash != hash {
+			return ErrKeyReused
+		}
+		if existing.StatusCode != 0 {
+			stored = &existing
+			return nil
+		}
+		if existing.UpdatedAt.After(now.Add(-LockTimeout)) {
+			return ErrInProgress
+		}
+		// The first request was abandoned; run it again under the same key
+		return tx.Model(&existing).Update("updated_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// Complete stores the response of the request that claimed key, for replaying to retries
+func (s *IdempotencyService) Complete(userID uint, key string, status int, contentType string, body []byte) error {
+	return s.db.Model(&IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", userID, key).
+		Updates(map[string]interface{}{
+			"status_code":  status,
+			"content_type": contentType,
+			"response":     body,
+			"expires_at":   time.Now().Add(s.retention),
+		}).Error
+}
+
+// Release gives up the claim on key without storing a response, so a retry runs the request again
+func (s *IdempotencyService) Release(userID uint, key string) error {
+	return s.db.Where("user_id = ? AND key = ? AND status_code = 0", userID, key).Delete(&IdempotencyKey{}).Error
+}
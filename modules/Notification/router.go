@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 	"github.com/gin-gonic/gin"
 )
@@ -27,6 +28,20 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 	}
 }
 
+// notificationListSpec is what GET /notifications and GET /notifications/unread sort and filter by
+var notificationListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"createdAt": "created_at",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"read": {Column: "read", Kind: Query.BoolFilter},
+		"type": {Column: "type"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"title", "message"},
+}
+
 func getNotificationsHandler(c *gin.Context) {
 	// Get user ID from JWT token (set by AuthMiddleware)
 	userID, exists := c.Get("user_id")
@@ -41,13 +56,17 @@ func getNotificationsHandler(c *gin.Context) {
 		return
 	}
 
-	notifications, err := GetNotificationService().GetNotificationsByUser(userIDUint)
+	params, ok := Query.FromContext(c, notificationListSpec)
+	if !ok {
+		return
+	}
+	notifications, page, err := GetNotificationService().ListNotifications(userIDUint, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		Query.ErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "page": page})
 }
 
 func getUnreadNotificationsHandler(c *gin.Context) {
@@ -64,13 +83,18 @@ func getUnreadNotificationsHandler(c *gin.Context) {
 		return
 	}
 
-	notifications, err := GetNotificationService().GetUnreadNotificationsByUser(userIDUint)
+	params, ok := Query.FromContext(c, notificationListSpec)
+	if !ok {
+		return
+	}
+	params.Set("read", false)
+	notifications, page, err := GetNotificationService().ListNotifications(userIDUint, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		Query.ErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "page": page})
 }
 
 func getUnreadCountHandler(c *gin.Context) {
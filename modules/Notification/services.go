@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 	"gorm.io/gorm"
 )
@@ -31,6 +32,12 @@ func GetNotificationService() *NotificationService {
 // CreateNotification creates a new notification for a user
 // It checks the user's notification preferences before creating
 func (s *NotificationService) CreateNotification(req CreateNotificationRequest) (*Notification, error) {
+	return s.CreateNotificationTx(s.db, req)
+}
+
+// CreateNotificationTx is CreateNotification within tx, so the notification is only kept
+// if the change it reports is committed
+func (s *NotificationService) CreateNotificationTx(tx *gorm.DB, req CreateNotificationRequest) (*Notification, error) {
 	// Get user's notification preferences
 	userService := User.GetUserService()
 	if userService == nil {
@@ -73,7 +80,7 @@ func (s *NotificationService) CreateNotification(req CreateNotificationRequest)
 		RelatedID: req.RelatedID,
 	}
 
-	if err := s.db.Create(notification).Error; err != nil {
+	if err := tx.Create(notification).Error; err != nil {
 		return nil, err
 	}
 
@@ -99,26 +106,16 @@ func (s *NotificationService) CreateNotificationForUsers(userIDs []uint, req Cre
 	return notifications, nil
 }
 
-// GetNotificationsByUser retrieves all notifications for a user
-func (s *NotificationService) GetNotificationsByUser(userID uint) ([]*Notification, error) {
-	var notifications []*Notification
-	if err := s.db.Where("user_id = ?", userID).
-		Order("created_at DESC").
-		Find(&notifications).Error; err != nil {
-		return nil, err
-	}
-	return notifications, nil
-}
+// ListNotifications retrieves one page of a user's notifications matching params
+func (s *NotificationService) ListNotifications(userID uint, params *Query.Params) ([]*Notification, *Query.Page, error) {
+	query := s.db.Model(&Notification{}).Where("user_id = ?", userID)
 
-// GetUnreadNotificationsByUser retrieves unread notifications for a user
-func (s *NotificationService) GetUnreadNotificationsByUser(userID uint) ([]*Notification, error) {
 	var notifications []*Notification
-	if err := s.db.Where("user_id = ? AND read = ?", userID, false).
-		Order("created_at DESC").
-		Find(&notifications).Error; err != nil {
-		return nil, err
+	page, err := Query.Paginate(query, params, &notifications)
+	if err != nil {
+		return nil, nil, err
 	}
-	return notifications, nil
+	return notifications, page, nil
 }
 
 // GetNotificationByID retrieves a notification by ID
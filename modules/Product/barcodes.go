@@ -0,0 +1,140 @@
+package Product
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDuplicateBarcode is returned when another product of the company already has the code
+	ErrDuplicateBarcode = errors.New("another product already uses this barcode")
+	// ErrBarcodeNotFound is returned when a barcode does not exist on the product
+	ErrBarcodeNotFound = errors.New("barcode not found")
+	// ErrInvalidSymbology is returned for symbologies other than ean13, code128 and custom
+	ErrInvalidSymbology = errors.New("symbology must be ean13, code128 or custom")
+	// ErrBarcodeRequired is returned when a code128 or custom barcode is added without a code
+	ErrBarcodeRequired = errors.New("code is required for code128 and custom barcodes")
+)
+
+// AddBarcode validates and stores a barcode of a product of the company
+func (s *ProductService) AddBarcode(productID uint, companyID uint, req CreateBarcodeRequest) (*ProductBarcode, error) {
+	barcode := &ProductBarcode{ProductID: productID, CompanyID: companyID, Symbology: req.Symbology}
+	if req.Code != nil {
+		barcode.Code = strings.TrimSpace(*req.Code)
+	}
+
+	switch req.Symbology {
+	case EAN13:
+		if barcode.Code == "" {
+			// In-store numbers (prefix 20) are free for internal use; product IDs keep them unique
+			barcode.Code = fmt.Sprintf("20%010d", productID)
+		}
+		code, err := normalizeEAN13(barcode.Code)
+		if err != nil {
+			return nil, err
+		}
+		barcode.Code = code
+	case Code128:
+		if barcode.Code == "" {
+			return nil, ErrBarcodeRequired
+		}
+		if !validCode128(barcode.Code) {
+			return nil, ErrInvalidCode128
+		}
+	case Custom:
+		if barcode.Code == "" {
+			return nil, ErrBarcodeRequired
+		}
+	default:
+		return nil, ErrInvalidSymbology
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := s.LockProductTx(tx, productID, &companyID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&ProductBarcode{}).Where("company_id = ? AND code = ?", companyID, barcode.Code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateBarcode
+		}
+		return tx.Create(barcode).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return barcode, nil
+}
+
+// GetBarcode returns one barcode of a product of the company
+func (s *ProductService) GetBarcode(productID uint, barcodeID uint, companyID uint) (*ProductBarcode, error) {
+	var barcode ProductBarcode
+	if err := s.db.Where("product_id = ? AND company_id = ?", productID, companyID).First(&barcode, "id = ?", barcodeID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrBarcodeNotFound
+		}
+		return nil, err
+	}
+	return &barcode, nil
+}
+
+func (s *ProductService) DeleteBarcode(productID uint, barcodeID uint, companyID uint) error {
+	barcode, err := s.GetBarcode(productID, barcodeID, companyID)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(barcode).Error
+}
+
+// LookupProduct finds the company's product with code as one of its barcodes or, failing
+// that, as its SKU (ignoring case). It is meant for scanners at the point of sale.
+func (s *ProductService) LookupProduct(companyID uint, code string) (*Product, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, ErrProductNotFound
+	}
+
+	var product Product
+	err := s.db.Joins("JOIN product_barcodes ON product_barcodes.product_id = products.id").
+		Where("product_barcodes.company_id = ? AND product_barcodes.code = ?", companyID, code).
+		First(&product).Error
+	if err == gorm.ErrRecordNotFound {
+		err = s.db.Where("company_id = ? AND LOWER(sku) = LOWER(?)", companyID, code).First(&product).Error
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// PopulateBarcodes sets the barcodes of each product, in one query
+func (s *ProductService) PopulateBarcodes(products ...*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	var barcodes []*ProductBarcode
+	if err := s.db.Where("product_id IN ?", ids).Order("id").Find(&barcodes).Error; err != nil {
+		return err
+	}
+	byProduct := make(map[uint][]*ProductBarcode)
+	for _, barcode := range barcodes {
+		byProduct[barcode.ProductID] = append(byProduct[barcode.ProductID], barcode)
+	}
+	for _, product := range products {
+		product.Barcodes = byProduct[product.ID]
+	}
+	return nil
+}
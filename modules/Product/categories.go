@@ -0,0 +1,205 @@
+package Product
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCategoryNotFound is returned when a category does not exist in the caller's company
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrCategoryCycle is returned when a category would be moved under itself or one of its subcategories
+	ErrCategoryCycle = errors.New("a category cannot be moved under itself or its subcategories")
+	// ErrCategoryInUse is returned when a category that still has subcategories or products is deleted
+	ErrCategoryInUse = errors.New("category still has subcategories or products")
+	// ErrCategoryNameRequired is returned for blank category names
+	ErrCategoryNameRequired = errors.New("category name is required")
+)
+
+// GetCategories returns the company's categories as a flat list, by name
+func (s *ProductService) GetCategories(companyID uint) ([]*Category, error) {
+	categories := []*Category{}
+	if err := s.db.Where("company_id = ?", companyID).Order("name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetCategoryTree returns the company's top-level categories with their subcategories nested
+func (s *ProductService) GetCategoryTree(companyID uint) ([]*Category, error) {
+	categories, err := s.GetCategories(companyID)
+	if err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(categories), nil
+}
+
+func buildCategoryTree(categories []*Category) []*Category {
+	byID := make(map[uint]*Category, len(categories))
+	for _, category := range categories {
+		category.Children = nil
+		byID[category.ID] = category
+	}
+	roots := []*Category{}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			if parent, ok := byID[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, category)
+				continue
+			}
+		}
+		roots = append(roots, category)
+	}
+	return roots
+}
+
+// GetCategoryByID returns a category of the company with its subcategories nested
+func (s *ProductService) GetCategoryByID(id uint, companyID uint) (*Category, error) {
+	categories, err := s.GetCategories(companyID)
+	if err != nil {
+		return nil, err
+	}
+	buildCategoryTree(categories)
+	for _, category := range categories {
+		if category.ID == id {
+			return category, nil
+		}
+	}
+	return nil, ErrCategoryNotFound
+}
+
+func (s *ProductService) CreateCategory(companyID uint, req CreateCategoryRequest) (*Category, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrCategoryNameRequired
+	}
+	if err := s.checkCategoryTx(s.db, companyID, req.ParentID); err != nil {
+		return nil, err
+	}
+
+	category := &Category{
+		CompanyID:   companyID,
+		ParentID:    req.ParentID,
+		Name:        name,
+		Description: req.Description,
+	}
+	if err := s.db.Create(category).Error; err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// UpdateCategory renames or moves a category. Moving it under one of its own descendants is refused.
+func (s *ProductService) UpdateCategory(id uint, companyID uint, req UpdateCategoryRequest) (*Category, error) {
+	var category Category
+	if err := s.db.Where("company_id = ?", companyID).First(&category, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, ErrCategoryNameRequired
+		}
+		category.Name = name
+	}
+	if req.Description != nil {
+		category.Description = req.Description
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			category.ParentID = nil
+		} else {
+			descendants, err := s.CategoryDescendants(companyID, category.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, descendant := range descendants {
+				if descendant == *req.ParentID {
+					return nil, ErrCategoryCycle
+				}
+			}
+			if err := s.checkCategoryTx(s.db, companyID, req.ParentID); err != nil {
+				return nil, err
+			}
+			category.ParentID = req.ParentID
+		}
+	}
+
+	if err := s.db.Save(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// DeleteCategory removes an empty category
+func (s *ProductService) DeleteCategory(id uint, companyID uint) error {
+	var category Category
+	if err := s.db.Where("company_id = ?", companyID).First(&category, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrCategoryNotFound
+		}
+		return err
+	}
+
+	var children, products int64
+	if err := s.db.Model(&Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&Product{}).Where("category_id = ?", category.ID).Count(&products).Error; err != nil {
+		return err
+	}
+	if children > 0 || products > 0 {
+		return ErrCategoryInUse
+	}
+	return s.db.Delete(&category).Error
+}
+
+// CategoryDescendants returns id and the ids of all its subcategories, at any depth
+func (s *ProductService) CategoryDescendants(companyID uint, id uint) ([]uint, error) {
+	categories, err := s.GetCategories(companyID)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[uint][]uint)
+	found := false
+	for _, category := range categories {
+		if category.ID == id {
+			found = true
+		}
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+	if !found {
+		return nil, ErrCategoryNotFound
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// checkCategoryTx returns ErrCategoryNotFound unless categoryID is nil or a category of the company
+func (s *ProductService) checkCategoryTx(tx *gorm.DB, companyID uint, categoryID *uint) error {
+	if categoryID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&Category{}).Where("company_id = ? AND id = ?", companyID, *categoryID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
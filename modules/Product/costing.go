@@ -0,0 +1,106 @@
+package Product
+
+import (
+	Company "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Costing. Product.UnitCost is kept as the weighted average cost of the stock held, and
+// every purchase also opens a CostLayer that sales use up oldest first. The company's
+// costing method picks which of the two prices stock leaving as cost of goods sold.
+// Transfers move stock between branches of the same company, so they leave both alone;
+// units lost on the way are written off at the destination as damage, which does not.
+
+// applyCostTx updates product's average cost and cost layers for a change of delta units
+// (before product.Quantity is updated) and returns the unit cost of the units moved
+func (s *ProductService) applyCostTx(tx *gorm.DB, product *Product, delta int, change StockChange) (float64, error) {
+	if change.Reason == MovementTransfer {
+		return product.UnitCost, nil
+	}
+
+	if delta > 0 {
+		unitCost := product.UnitCost
+		if change.UnitCost != nil {
+			if *change.UnitCost < 0 {
+				return 0, ErrInvalidUnitCost
+			}
+			unitCost = *change.UnitCost
+		}
+		if product.Quantity > 0 {
+			product.UnitCost = (float64(product.Quantity)*product.UnitCost + float64(delta)*unitCost) / float64(product.Quantity+delta)
+		} else {
+			product.UnitCost = unitCost
+		}
+		layer := &CostLayer{
+			ProductID:         product.ID,
+			CompanyID:         product.CompanyID,
+			UnitCost:          unitCost,
+			Quantity:          delta,
+			QuantityRemaining: delta,
+		}
+		if err := tx.Create(layer).Error; err != nil {
+			return 0, err
+		}
+		return unitCost, nil
+	}
+
+	fifoCost, err := s.consumeLayersTx(tx, product, -delta)
+	if err != nil {
+		return 0, err
+	}
+	if s.costingMethodTx(tx, product.CompanyID) == Company.FIFO {
+		return fifoCost, nil
+	}
+	// The average does not change when stock leaves at the average
+	return product.UnitCost, nil
+}
+
+// consumeLayersTx uses up quantity units of product's cost layers, oldest first, and
+// returns their average unit cost. Stock held before layers were kept is older than any
+// layer, so it goes first, at the product's average cost.
+func (s *ProductService) consumeLayersTx(tx *gorm.DB, product *Product, quantity int) (float64, error) {
+	var layers []*CostLayer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND quantity_remaining > 0", product.ID).
+		Order("id").
+		Find(&layers).Error; err != nil {
+		return 0, err
+	}
+
+	layered := 0
+	for _, layer := range layers {
+		layered += layer.QuantityRemaining
+	}
+
+	remaining := quantity
+	total := 0.0
+	if unlayered := product.Quantity - layered; unlayered > 0 {
+		taken := min(unlayered, remaining)
+		total += float64(taken) * product.UnitCost
+		remaining -= taken
+	}
+	for _, layer := range layers {
+		if remaining == 0 {
+			break
+		}
+		taken := min(layer.QuantityRemaining, remaining)
+		total += float64(taken) * layer.UnitCost
+		remaining -= taken
+		if err := tx.Model(layer).Update("quantity_remaining", layer.QuantityRemaining-taken).Error; err != nil {
+			return 0, err
+		}
+	}
+	// Should the layers run short, the rest is costed at the average
+	total += float64(remaining) * product.UnitCost
+
+	return total / float64(quantity), nil
+}
+
+func (s *ProductService) costingMethodTx(tx *gorm.DB, companyID uint) Company.CostingMethod {
+	var methods []Company.CostingMethod
+	if err := tx.Model(&Company.Company{}).Where("id = ?", companyID).Pluck("costing_method", &methods).Error; err != nil || len(methods) == 0 {
+		return Company.WeightedAverage
+	}
+	return methods[0]
+}
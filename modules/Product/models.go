@@ -3,6 +3,7 @@ package Product
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -43,19 +44,175 @@ func (j *JSONB) Scan(value interface{}) error {
 
 type Product struct {
 	gorm.Model
-	Name       string      `json:"name" gorm:"not null"`
-	Price      float64     `json:"price" gorm:"not null"`
-	Currency   string      `json:"currency" gorm:"not null"`
-	Quantity   int         `json:"quantity" gorm:"not null"`
-	ImageURI   *string     `json:"imageUri,omitempty"`
-	SyncStatus *SyncStatus `json:"syncStatus,omitempty"`
-	Attributes JSONB       `json:"attributes" gorm:"type:jsonb"`
+	ParentID   *uint   `json:"parentId,omitempty" gorm:"index"` // Set on variants; the parent's stock is held by its variants
+	Name       string  `json:"name" gorm:"not null"`
+	SKU        *string `json:"sku,omitempty" gorm:"index"` // Unique within the company
+	CategoryID *uint   `json:"categoryId,omitempty" gorm:"index"`
+	Price      float64 `json:"price" gorm:"not null"`
+	Currency   string  `json:"currency" gorm:"not null"`
+	Quantity   int     `json:"quantity" gorm:"not null"`  // Company total, the sum of every branch's stock
+	UnitCost   float64 `json:"unitCost" gorm:"default:0"` // Weighted average cost of the stock held
+	// Default low-stock threshold and restock size for every branch; branches can override them
+	ReorderPoint    *int        `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int        `json:"reorderQuantity,omitempty"`
+	ImageURI        *string     `json:"imageUri,omitempty"`
+	SyncStatus      *SyncStatus `json:"syncStatus,omitempty"`
+	Attributes      JSONB       `json:"attributes" gorm:"type:jsonb"`
+	// Version counts edits of the product; updates made against an older version are rejected
+	Version uint `json:"version" gorm:"not null;default:1"`
 
 	// Foreign Key - Products belong to Company only
 	CompanyID uint `json:"companyId" gorm:"not null;index"`
 
-	// Relationship (for JSON response - computed from FK)
-	Company *CompanyResponse `json:"company,omitempty" gorm:"-"`
+	// Relationships (for JSON response - computed from FKs)
+	Company  *CompanyResponse  `json:"company,omitempty" gorm:"-"`
+	Variants []*Product        `json:"variants,omitempty" gorm:"-"`
+	Barcodes []*ProductBarcode `json:"barcodes,omitempty" gorm:"-"`
+
+	// Stock levels (for JSON response - computed from branch_stocks)
+	BranchQuantity *int                `json:"branchQuantity,omitempty" gorm:"-"` // Stock at the caller's branch
+	BranchStock    []*BranchStockLevel `json:"branchStock,omitempty" gorm:"-"`    // Per-branch breakdown, for company-wide roles
+}
+
+type BarcodeSymbology string
+
+const (
+	EAN13   BarcodeSymbology = "ean13"
+	Code128 BarcodeSymbology = "code128"
+	Custom  BarcodeSymbology = "custom" // Any other code; stored for lookup but not rendered
+)
+
+// ProductBarcode is one scannable code of a product. Codes are unique within a company.
+type ProductBarcode struct {
+	ID        uint             `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time        `json:"createdAt"`
+	ProductID uint             `json:"productId" gorm:"not null;index"`
+	CompanyID uint             `json:"companyId" gorm:"not null;uniqueIndex:idx_barcode_company_code"`
+	Code      string           `json:"code" gorm:"not null;uniqueIndex:idx_barcode_company_code"`
+	Symbology BarcodeSymbology `json:"symbology" gorm:"not null"`
+}
+
+// Category groups products in a company's catalog. Categories nest through ParentID.
+type Category struct {
+	gorm.Model
+	CompanyID   uint    `json:"companyId" gorm:"not null;index"`
+	ParentID    *uint   `json:"parentId,omitempty" gorm:"index"`
+	Name        string  `json:"name" gorm:"not null"`
+	Description *string `json:"description,omitempty"`
+
+	// Subcategories (for JSON response - computed from ParentID)
+	Children []*Category `json:"children,omitempty" gorm:"-"`
+}
+
+// BranchStock is the quantity of a product held by one branch
+type BranchStock struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ProductID uint      `json:"productId" gorm:"not null;uniqueIndex:idx_branch_stock_product_branch"`
+	BranchID  uint      `json:"branchId" gorm:"not null;uniqueIndex:idx_branch_stock_product_branch;index"`
+	CompanyID uint      `json:"companyId" gorm:"not null;index"`
+	Quantity  int       `json:"quantity" gorm:"not null;default:0"`
+
+	// Branch overrides of the product's reorder point and quantity
+	ReorderPoint    *int `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int `json:"reorderQuantity,omitempty"`
+	// Set when a low-stock alert was sent, cleared once stock is back above the reorder point
+	LowStockAlertedAt *time.Time `json:"lowStockAlertedAt,omitempty"`
+}
+
+// CostLayer is a batch of stock bought in at one unit cost. Layers are used up oldest
+// first as stock leaves, which gives the FIFO cost of goods sold.
+type CostLayer struct {
+	ID                uint      `json:"id" gorm:"primarykey"`
+	CreatedAt         time.Time `json:"createdAt"`
+	ProductID         uint      `json:"productId" gorm:"not null;index"`
+	CompanyID         uint      `json:"companyId" gorm:"not null;index"`
+	UnitCost          float64   `json:"unitCost" gorm:"not null"`
+	Quantity          int       `json:"quantity" gorm:"not null"`
+	QuantityRemaining int       `json:"quantityRemaining" gorm:"not null;index"`
+}
+
+// BranchStockLevel is one line of a product's per-branch breakdown
+type BranchStockLevel struct {
+	ProductID  uint   `json:"-"`
+	BranchID   uint   `json:"branchId"`
+	BranchName string `json:"branchName"`
+	Quantity   int    `json:"quantity"`
+	// Effective thresholds: the branch override, otherwise the product default
+	ReorderPoint    *int `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int `json:"reorderQuantity,omitempty"`
+	LowStock        bool `json:"lowStock"`
+}
+
+// LowStockItem is a product at or below its reorder point at one branch
+type LowStockItem struct {
+	ProductID         uint       `json:"productId"`
+	ProductName       string     `json:"productName"`
+	BranchID          uint       `json:"branchId"`
+	BranchName        string     `json:"branchName"`
+	Quantity          int        `json:"quantity"`
+	ReorderPoint      int        `json:"reorderPoint"`
+	ReorderQuantity   *int       `json:"reorderQuantity,omitempty"`
+	LowStockAlertedAt *time.Time `json:"lowStockAlertedAt,omitempty"`
+}
+
+type MovementReason string
+
+const (
+	MovementSale       MovementReason = "sale"
+	MovementRestock    MovementReason = "restock"
+	MovementAdjustment MovementReason = "adjustment"
+	MovementTransfer   MovementReason = "transfer"
+	MovementReturn     MovementReason = "return"
+	MovementDamage     MovementReason = "damage"
+)
+
+// ValidMovementReason reports whether reason is one of the ledger reasons
+func ValidMovementReason(reason MovementReason) bool {
+	switch reason {
+	case MovementSale, MovementRestock, MovementAdjustment, MovementTransfer, MovementReturn, MovementDamage:
+		return true
+	}
+	return false
+}
+
+// StockMovement is one entry of the append-only stock ledger. Every change to
+// Product.Quantity writes a movement in the same transaction, so the sum of a
+// product's deltas is its quantity.
+type StockMovement struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time      `json:"createdAt" gorm:"index"`
+	ProductID     uint           `json:"productId" gorm:"not null;index"`
+	CompanyID     uint           `json:"companyId" gorm:"not null;index"`
+	BranchID      *uint          `json:"branchId,omitempty" gorm:"index"`
+	Delta         int            `json:"delta" gorm:"not null"`         // Positive for stock in, negative for stock out
+	QuantityAfter int            `json:"quantityAfter" gorm:"not null"` // Product quantity once the movement was applied
+	Reason        MovementReason `json:"reason" gorm:"not null;index"`
+	ReferenceID   *uint          `json:"referenceId,omitempty" gorm:"index"` // e.g. the sale for "sale" movements
+	UserID        *uint          `json:"userId,omitempty"`
+	UnitCost      *float64       `json:"unitCost,omitempty"` // Cost per unit moved: paid for stock in, cost of goods for stock out
+	Notes         *string        `json:"notes,omitempty"`
+}
+
+// StockChange describes who changes a product's quantity and why, for the movement ledger
+type StockChange struct {
+	Reason      MovementReason
+	ReferenceID *uint
+	UserID      *uint
+	BranchID    *uint
+	UnitCost    *float64 // Cost of stock coming in; defaults to the product's current unit cost
+	Notes       *string
+}
+
+// StockReconciliation compares a product's stored quantity with its ledger
+type StockReconciliation struct {
+	ProductID        uint `json:"productId"`
+	PreviousQuantity int  `json:"previousQuantity"`
+	LedgerQuantity   int  `json:"ledgerQuantity"`
+	Difference       int  `json:"difference"`      // LedgerQuantity - PreviousQuantity
+	BranchesDrifted  int  `json:"branchesDrifted"` // Branches whose stock differs from their movements
+	Corrected        bool `json:"corrected"`
 }
 
 // CompanyResponse is used for JSON serialization
@@ -65,21 +222,92 @@ type CompanyResponse struct {
 }
 
 type CreateProductRequest struct {
-	Name       string                 `json:"name" binding:"required"`
-	Price      float64                `json:"price" binding:"required"`
-	Currency   string                 `json:"currency" binding:"required"`
-	CompanyID  uint                   `json:"companyId" binding:"required"`
-	Quantity   int                    `json:"quantity" binding:"required"`
-	ImageURI   *string                `json:"imageUri,omitempty"`
-	Attributes map[string]interface{} `json:"attributes"`
+	Name            string                 `json:"name" binding:"required"`
+	SKU             *string                `json:"sku,omitempty"`
+	CategoryID      *uint                  `json:"categoryId,omitempty"`
+	Price           float64                `json:"price" binding:"required"`
+	Currency        string                 `json:"currency" binding:"required"`
+	CompanyID       uint                   `json:"companyId" binding:"required"`
+	Quantity        int                    `json:"quantity" binding:"required"`
+	UnitCost        float64                `json:"unitCost"` // Cost of the opening stock
+	ReorderPoint    *int                   `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int                   `json:"reorderQuantity,omitempty"`
+	ImageURI        *string                `json:"imageUri,omitempty"`
+	Attributes      map[string]interface{} `json:"attributes"`
+	UserID          *uint                  `json:"-"` // Creator, for the opening stock movement
+	ParentID        *uint                  `json:"-"` // Set by CreateVariant
+	// Branch receiving the opening stock; defaults to the creator's branch
+	BranchID *uint `json:"branchId,omitempty"`
 }
 
 type UpdateProductRequest struct {
-	Name       *string                `json:"name,omitempty"`
-	Price      *float64               `json:"price,omitempty"`
-	Currency   *string                `json:"currency,omitempty"`
-	CompanyID  *uint                  `json:"companyId,omitempty"`
-	Quantity   *int                   `json:"quantity,omitempty"`
-	ImageURI   *string                `json:"imageUri,omitempty"`
-	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Name            *string                `json:"name,omitempty"`
+	SKU             *string                `json:"sku,omitempty"`
+	CategoryID      *uint                  `json:"categoryId,omitempty"` // 0 removes the product from its category
+	Price           *float64               `json:"price,omitempty"`
+	Currency        *string                `json:"currency,omitempty"`
+	CompanyID       *uint                  `json:"companyId,omitempty"`
+	Quantity        *int                   `json:"quantity,omitempty"`
+	QuantityDelta   *int                   `json:"quantityDelta,omitempty"` // Adds to the branch's stock instead of setting it
+	UnitCost        *float64               `json:"unitCost,omitempty"`      // Sets the average cost, e.g. for stock recorded before costs were tracked
+	ReorderPoint    *int                   `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int                   `json:"reorderQuantity,omitempty"`
+	ImageURI        *string                `json:"imageUri,omitempty"`
+	Attributes      map[string]interface{} `json:"attributes,omitempty"`
+	// Branch whose stock Quantity sets; defaults to the caller's branch
+	BranchID *uint `json:"branchId,omitempty"`
+	// Ledger details for a quantity change; the reason defaults to restock for increases and adjustment for decreases
+	StockReason *MovementReason `json:"stockReason,omitempty"`
+	StockNotes  *string         `json:"stockNotes,omitempty"`
+	// Version the edit was made against (or the If-Match header); a stale version is a conflict
+	Version *uint `json:"version,omitempty"`
+}
+
+// ChangesProduct reports whether the request edits the product for every branch, rather
+// than only setting one branch's stock
+func (r UpdateProductRequest) ChangesProduct() bool {
+	return r.Name != nil || r.SKU != nil || r.CategoryID != nil || r.Price != nil || r.Currency != nil ||
+		r.CompanyID != nil || r.UnitCost != nil || r.ReorderPoint != nil || r.ReorderQuantity != nil ||
+		r.ImageURI != nil || r.Attributes != nil
+}
+
+// SetBranchReorderRequest sets a branch's override of the product's reorder point and
+// quantity. A field left out clears the override, so the product default applies again.
+type SetBranchReorderRequest struct {
+	ReorderPoint    *int `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int `json:"reorderQuantity,omitempty"`
+}
+
+// CreateVariantRequest adds a variant under a parent product. Name, price and image default
+// to the parent's; attributes tell the variant apart from its siblings.
+type CreateVariantRequest struct {
+	Name            *string                `json:"name,omitempty"`
+	SKU             *string                `json:"sku,omitempty"`
+	Price           *float64               `json:"price,omitempty"`
+	Quantity        int                    `json:"quantity"`
+	UnitCost        float64                `json:"unitCost"`
+	ImageURI        *string                `json:"imageUri,omitempty"`
+	Attributes      map[string]interface{} `json:"attributes" binding:"required"`
+	ReorderPoint    *int                   `json:"reorderPoint,omitempty"`
+	ReorderQuantity *int                   `json:"reorderQuantity,omitempty"`
+	BranchID        *uint                  `json:"branchId,omitempty"` // Branch receiving the opening stock
+}
+
+// CreateBarcodeRequest adds a barcode to a product. An ean13 without a code gets a generated
+// in-store number (prefix 20).
+type CreateBarcodeRequest struct {
+	Code      *string          `json:"code,omitempty"`
+	Symbology BarcodeSymbology `json:"symbology" binding:"required"`
+}
+
+type CreateCategoryRequest struct {
+	Name        string  `json:"name" binding:"required"`
+	ParentID    *uint   `json:"parentId,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+type UpdateCategoryRequest struct {
+	Name        *string `json:"name,omitempty"`
+	ParentID    *uint   `json:"parentId,omitempty"` // 0 makes the category top-level
+	Description *string `json:"description,omitempty"`
 }
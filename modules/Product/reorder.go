@@ -0,0 +1,183 @@
+package Product
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// Reorder points. A product's reorder point applies to each branch's stock, unless the
+// branch has its own. When a branch's stock falls to its reorder point the branch admin
+// and the company owners get one "Low Stock" alert; the branch is alerted again only after
+// its stock has been back above the reorder point.
+
+// effectiveReorderSQL selects a branch_stocks row's reorder point and quantity, falling back to the product's
+const effectiveReorderSQL = "COALESCE(branch_stocks.reorder_point, products.reorder_point) AS reorder_point, COALESCE(branch_stocks.reorder_quantity, products.reorder_quantity) AS reorder_quantity"
+
+func validReorder(values ...*int) bool {
+	for _, value := range values {
+		if value != nil && *value < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLowStockTx alerts on, or re-arms, stock's low-stock alert after its quantity changed
+func (s *ProductService) checkLowStockTx(tx *gorm.DB, product *Product, stock *BranchStock) error {
+	reorderPoint, reorderQuantity := stock.ReorderPoint, stock.ReorderQuantity
+	if reorderPoint == nil {
+		reorderPoint = product.ReorderPoint
+	}
+	if reorderQuantity == nil {
+		reorderQuantity = product.ReorderQuantity
+	}
+
+	switch {
+	case reorderPoint != nil && stock.Quantity <= *reorderPoint && stock.LowStockAlertedAt == nil:
+		now := time.Now()
+		stock.LowStockAlertedAt = &now
+		if err := tx.Model(stock).Update("low_stock_alerted_at", now).Error; err != nil {
+			return err
+		}
+		return s.notifyLowStockTx(tx, product, stock, *reorderPoint, reorderQuantity)
+	case stock.LowStockAlertedAt != nil && (reorderPoint == nil || stock.Quantity > *reorderPoint):
+		stock.LowStockAlertedAt = nil
+		return tx.Model(stock).Update("low_stock_alerted_at", nil).Error
+	}
+	return nil
+}
+
+// checkProductLowStockTx re-evaluates every branch's alert after the product's reorder point changed
+func (s *ProductService) checkProductLowStockTx(tx *gorm.DB, product *Product) error {
+	var stocks []*BranchStock
+	if err := tx.Where("product_id = ?", product.ID).Order("branch_id").Find(&stocks).Error; err != nil {
+		return err
+	}
+	for _, stock := range stocks {
+		if err := s.checkLowStockTx(tx, product, stock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyLowStockTx alerts the branch admin and the company owners. The notifications are
+// part of tx, so a rolled back sale does not leave an alert behind. Each one is created
+// under its own savepoint, so a failed insert is undone without aborting tx.
+func (s *ProductService) notifyLowStockTx(tx *gorm.DB, product *Product, stock *BranchStock, reorderPoint int, reorderQuantity *int) error {
+	notificationService := Notification.GetNotificationService()
+	if notificationService == nil {
+		return nil
+	}
+
+	var branch User.Branch
+	if err := tx.First(&branch, "id = ?", stock.BranchID).Error; err != nil {
+		return err
+	}
+	var userIDs []uint
+	if err := tx.Table("user_models").
+		Joins("JOIN branches ON user_models.branch_id = branches.id").
+		Where("branches.company_id = ? AND user_models.role = ? AND user_models.deleted_at IS NULL", product.CompanyID, User.SuperAdmin).
+		Order("user_models.id").
+		Pluck("user_models.id", &userIDs).Error; err != nil {
+		return err
+	}
+	if branch.AdminUserID != nil {
+		userIDs = appendUnique(userIDs, *branch.AdminUserID)
+	}
+
+	message := fmt.Sprintf("%s is down to %d at %s (reorder point %d).", product.Name, stock.Quantity, branch.Name, reorderPoint)
+	if reorderQuantity != nil {
+		message += fmt.Sprintf(" Reorder %d units.", *reorderQuantity)
+	}
+	productID := product.ID
+	for _, userID := range userIDs {
+		// A nested transaction is a savepoint within tx
+		if err := tx.Transaction(func(savepoint *gorm.DB) error {
+			_, err := notificationService.CreateNotificationTx(savepoint, Notification.CreateNotificationRequest{
+				UserID:    userID,
+				Type:      Notification.NotificationTypeInventory,
+				Title:     "Low Stock",
+				Message:   message,
+				RelatedID: &productID,
+			})
+			return err
+		}); err != nil {
+			// A recipient without preferences should not fail the sale
+			log.Printf("Failed to create low stock notification for user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func appendUnique(ids []uint, id uint) []uint {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// SetBranchReorder sets branchID's override of the product's reorder point and quantity
+func (s *ProductService) SetBranchReorder(id uint, branchID uint, companyID uint, req SetBranchReorderRequest) (*BranchStock, error) {
+	if !validReorder(req.ReorderPoint, req.ReorderQuantity) {
+		return nil, ErrInvalidReorder
+	}
+
+	var stock *BranchStock
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		product, err := s.LockProductTx(tx, id, &companyID)
+		if err != nil {
+			return err
+		}
+		resolved, err := s.resolveBranchTx(tx, companyID, &branchID)
+		if err != nil {
+			return err
+		}
+		stock, err = s.lockBranchStockTx(tx, product, *resolved)
+		if err != nil {
+			return err
+		}
+
+		stock.ReorderPoint = req.ReorderPoint
+		stock.ReorderQuantity = req.ReorderQuantity
+		if err := tx.Model(stock).Updates(map[string]interface{}{
+			"reorder_point":    req.ReorderPoint,
+			"reorder_quantity": req.ReorderQuantity,
+		}).Error; err != nil {
+			return err
+		}
+		return s.checkLowStockTx(tx, product, stock)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// GetLowStock lists the company's products at or below their reorder point, per branch.
+// With branchID only that branch is listed. Lowest stock relative to the reorder point comes first.
+func (s *ProductService) GetLowStock(companyID uint, branchID *uint) ([]*LowStockItem, error) {
+	query := s.db.Table("branch_stocks").
+		Select("branch_stocks.product_id, products.name AS product_name, branch_stocks.branch_id, branches.name AS branch_name, branch_stocks.quantity, branch_stocks.low_stock_alerted_at, "+effectiveReorderSQL).
+		Joins("JOIN products ON products.id = branch_stocks.product_id AND products.deleted_at IS NULL").
+		Joins("JOIN branches ON branches.id = branch_stocks.branch_id AND branches.deleted_at IS NULL").
+		Where("branch_stocks.company_id = ?", companyID).
+		Where("branch_stocks.quantity <= COALESCE(branch_stocks.reorder_point, products.reorder_point)").
+		Order("branch_stocks.quantity - COALESCE(branch_stocks.reorder_point, products.reorder_point), products.name, branches.id")
+	if branchID != nil {
+		query = query.Where("branch_stocks.branch_id = ?", *branchID)
+	}
+
+	items := []*LowStockItem{}
+	if err := query.Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -1,11 +1,15 @@
 package Product
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
 	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,15 +21,56 @@ func GetProductService() *ProductService {
 func RegisterRoutes(rg *gin.RouterGroup) {
 	products := rg.Group("/products")
 	{
-		products.GET("", getAllProductsHandler) // Returns products for user's company
-		products.GET("/:id", getProductHandler)
-		products.POST("", createProductHandler) // Company ID from middleware
-		products.PUT("/:id", updateProductHandler)
-		products.DELETE("/:id", deleteProductHandler)
-		products.POST("/:id/reduce", reduceProductQuantityHandler)
+		products.GET("", User.RequirePermission(User.PermProductsRead), getAllProductsHandler) // Returns products for user's company
+		products.GET("/low-stock", User.RequirePermission(User.PermProductsRead), getLowStockHandler)
+		products.GET("/lookup", User.RequirePermission(User.PermProductsRead), lookupProductHandler)
+		products.GET("/:id", User.RequirePermission(User.PermProductsRead), getProductHandler)
+		products.POST("", User.RequirePermission(User.PermProductsWrite), createProductHandler) // Company ID from middleware
+		products.PUT("/:id", User.RequirePermission(User.PermProductsWrite), updateProductHandler)
+		products.DELETE("/:id", User.RequirePermission(User.PermProductsWrite), User.RequireCompanyWideAccess(), deleteProductHandler)
+		products.POST("/:id/reduce", User.RequirePermission(User.PermProductsWrite), Idempotency.Middleware(), reduceProductQuantityHandler)
+		products.GET("/:id/movements", User.RequirePermission(User.PermProductsRead), getStockMovementsHandler)
+		products.POST("/:id/movements/recompute", User.RequirePermission(User.PermProductsWrite), User.RequireCompanyWideAccess(), recomputeQuantityHandler)
+		products.GET("/:id/variants", User.RequirePermission(User.PermProductsRead), getVariantsHandler)
+		products.POST("/:id/variants", User.RequirePermission(User.PermProductsWrite), createVariantHandler)
+		products.POST("/:id/barcodes", User.RequirePermission(User.PermProductsWrite), addBarcodeHandler)
+		products.DELETE("/:id/barcodes/:barcodeId", User.RequirePermission(User.PermProductsWrite), deleteBarcodeHandler)
+		products.GET("/:id/barcodes/:barcodeId/image", User.RequirePermission(User.PermProductsRead), barcodeImageHandler)
+		products.PUT("/:id/branches/:branchId/reorder", User.RequirePermission(User.PermProductsWrite), setBranchReorderHandler)
 	}
 }
 
+// RegisterCategoryRoutes registers the company's product category routes
+func RegisterCategoryRoutes(rg *gin.RouterGroup) {
+	categories := rg.Group("/categories")
+	{
+		categories.GET("", User.RequirePermission(User.PermProductsRead), getCategoriesHandler) // Nested tree, ?flat=true for a flat list
+		categories.GET("/:id", User.RequirePermission(User.PermProductsRead), getCategoryHandler)
+		categories.POST("", User.RequirePermission(User.PermProductsWrite), createCategoryHandler)
+		categories.PUT("/:id", User.RequirePermission(User.PermProductsWrite), updateCategoryHandler)
+		categories.DELETE("/:id", User.RequirePermission(User.PermProductsWrite), deleteCategoryHandler)
+	}
+}
+
+// productListSpec is what GET /products sorts and filters by. ?branchId= is not a filter here:
+// it picks the branch whose stock is shown.
+var productListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"name":      "name",
+		"price":     "price",
+		"quantity":  "quantity",
+		"createdAt": "created_at",
+	},
+	DefaultSort: "name",
+	Filters: map[string]Query.Filter{
+		"categoryId": {Kind: Query.UintFilter}, // Includes subcategories
+		"parentId":   {Column: "parent_id", Kind: Query.UintFilter},
+		"currency":   {Column: "currency"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"name", "sku"},
+}
+
 func getAllProductsHandler(c *gin.Context) {
 	// Get company ID from middleware context
 	companyID, exists := c.Get("company_id")
@@ -40,13 +85,25 @@ func getAllProductsHandler(c *gin.Context) {
 		return
 	}
 
-	products, err := GetProductService().GetAllProductsByCompany(*companyIDPtr)
+	params, ok := Query.FromContext(c, productListSpec)
+	if !ok {
+		return
+	}
+	products, page, err := GetProductService().ListProducts(*companyIDPtr, params)
+	if errors.Is(err, ErrCategoryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	if err := populateStock(c, products...); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"products": products})
+	c.JSON(http.StatusOK, gin.H{"products": products, "page": page})
 }
 
 func getProductHandler(c *gin.Context) {
@@ -73,7 +130,24 @@ func getProductHandler(c *gin.Context) {
 			}
 		}
 	}
+	if err := populateStock(c, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := GetProductService().PopulateVariants(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := GetProductService().PopulateBarcodes(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := populateStock(c, product.Variants...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	Query.SetETag(c, product.Version)
 	c.JSON(http.StatusOK, product)
 }
 
@@ -100,12 +174,28 @@ func createProductHandler(c *gin.Context) {
 
 	// Override company ID from request with the one from middleware for security
 	req.CompanyID = *companyIDPtr
+	change := stockChangeFromContext(c, MovementRestock)
+	req.UserID = change.UserID
+	if req.BranchID == nil {
+		req.BranchID = change.BranchID
+	} else if !User.CanAccessBranch(c, *req.BranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
 
 	product, err := GetProductService().CreateProduct(req)
 	if err != nil {
+		if productConflict(c, err) {
+			return
+		}
+		if errors.Is(err, ErrBranchNotFound) || errors.Is(err, ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	_ = populateStock(c, product)
 
 	// Create notification for stock addition
 	userID, exists := c.Get("user_id")
@@ -140,6 +230,26 @@ func updateProductHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.StockReason != nil && !ValidMovementReason(*req.StockReason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stock reason"})
+		return
+	}
+	if req.BranchID != nil && !User.CanAccessBranch(c, *req.BranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+	// Branch-limited roles only set their own branch's stock
+	if User.BranchLimitFromContext(c) != nil && req.ChangesProduct() {
+		User.CompanyAccessRequired(c)
+		return
+	}
+	if req.Version == nil {
+		version, ok := Query.IfMatchVersion(c)
+		if !ok {
+			return
+		}
+		req.Version = version
+	}
 
 	// Get company ID from middleware and verify product belongs to user's company
 	companyID, exists := c.Get("company_id")
@@ -161,43 +271,45 @@ func updateProductHandler(c *gin.Context) {
 		}
 	}
 
-	// Get product before update to check quantity change
-	var oldQuantity int
-	oldProduct, _ := GetProductService().GetProductByID(uint(id))
-	if oldProduct != nil {
-		oldQuantity = oldProduct.Quantity
-	}
-
-	product, err := GetProductService().UpdateProduct(uint(id), req)
+	product, err := GetProductService().UpdateProduct(uint(id), req, stockChangeFromContext(c, ""))
 	if err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			versionConflict(c, uint(id), err)
+			return
+		}
+		if productConflict(c, err) {
+			return
+		}
+		if errors.Is(err, ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity cannot be negative"})
+			return
+		}
+		if errors.Is(err, ErrBranchNotFound) || errors.Is(err, ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	_ = populateStock(c, product)
 
-	// Create notification if quantity increased (stock reorder)
-	if req.Quantity != nil && *req.Quantity > oldQuantity {
-		userID, exists := c.Get("user_id")
-		if exists {
-			if userIDUint, ok := userID.(uint); ok {
-				notificationService := Notification.GetNotificationService()
-				if notificationService != nil {
-					productID := product.ID
-					quantityAdded := *req.Quantity - oldQuantity
-					_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
-						UserID:    userIDUint,
-						Type:      Notification.NotificationTypeInventory,
-						Title:     "Stock Reordered",
-						Message:   fmt.Sprintf("Reordered %d units of %s. New total: %d units", quantityAdded, product.Name, product.Quantity),
-						RelatedID: &productID,
-					})
-				}
-			}
-		}
-	}
-
+	Query.SetETag(c, product.Version)
 	c.JSON(http.StatusOK, product)
 }
 
+// versionConflict writes a 409 carrying the product as it is now, so the client can
+// merge its edit and retry against the current version
+func versionConflict(c *gin.Context, id uint, err error) {
+	current, loadErr := GetProductService().GetProductByID(id)
+	if loadErr != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "VERSION_CONFLICT"})
+		return
+	}
+	_ = populateStock(c, current)
+	Query.SetETag(c, current.Version)
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "VERSION_CONFLICT", "current": current})
+}
+
 func deleteProductHandler(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
@@ -223,7 +335,10 @@ func deleteProductHandler(c *gin.Context) {
 		}
 	}
 
-	if err := GetProductService().DeleteProduct(uint(id)); err != nil {
+	if err := GetProductService().DeleteProduct(uint(id), stockChangeFromContext(c, MovementAdjustment)); err != nil {
+		if productConflict(c, err) {
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -244,6 +359,16 @@ func reduceProductQuantityHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid quantity"})
 		return
 	}
+	// Optional ledger reason, e.g. ?reason=damage; defaults to adjustment
+	reason := MovementReason(c.DefaultQuery("reason", string(MovementAdjustment)))
+	if !ValidMovementReason(reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reason"})
+		return
+	}
+	change := stockChangeFromContext(c, reason)
+	if notes := c.Query("notes"); notes != "" {
+		change.Notes = &notes
+	}
 
 	// Verify product belongs to user's company
 	companyID, exists := c.Get("company_id")
@@ -262,11 +387,542 @@ func reduceProductQuantityHandler(c *gin.Context) {
 		}
 	}
 
-	if err := GetProductService().ReduceProductQuantity(uint(id), quantity); err != nil {
+	if err := GetProductService().ReduceProductQuantity(uint(id), quantity, change); err != nil {
+		if errors.Is(err, ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INSUFFICIENT_STOCK"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	product, _ := GetProductService().GetProductByID(uint(id))
+	if product != nil {
+		_ = populateStock(c, product)
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// getStockMovementsHandler returns the product's stock ledger, newest first
+func getStockMovementsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	product, err := GetProductService().GetProductByID(uint(id))
+	if err != nil || product.CompanyID != companyID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	movements, err := GetProductService().GetStockMovements(uint(id), companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"movements": movements, "quantity": product.Quantity})
+}
+
+// recomputeQuantityHandler compares the stored quantity with the sum of the ledger.
+// With ?apply=true a drifted quantity and branch stock are corrected to the ledger.
+func recomputeQuantityHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	apply := c.Query("apply") == "true"
+
+	result, err := GetProductService().RecomputeQuantity(uint(id), companyID, apply, stockChangeFromContext(c, MovementAdjustment))
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getLowStockHandler lists products at or below their reorder point. Branch-limited roles
+// only see their own branch; company-wide roles see every branch or pick one with ?branchId=.
+func getLowStockHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var branchID *uint
+	if branchParam := c.Query("branchId"); branchParam != "" {
+		parsed, err := strconv.ParseUint(branchParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
+			return
+		}
+		id := uint(parsed)
+		branchID = &id
+	}
+	if limit := User.BranchLimitFromContext(c); limit != nil {
+		if branchID != nil && *branchID != *limit {
+			User.BranchAccessDenied(c)
+			return
+		}
+		branchID = limit
+	}
+
+	items, err := GetProductService().GetLowStock(companyID, branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"products": items})
+}
+
+// setBranchReorderHandler overrides the product's reorder point and quantity at one branch
+func setBranchReorderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	branchID, err := strconv.ParseUint(c.Param("branchId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
+		return
+	}
+	if !User.CanAccessBranch(c, uint(branchID)) {
+		User.BranchAccessDenied(c)
+		return
+	}
+	var req SetBranchReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stock, err := GetProductService().SetBranchReorder(uint(id), uint(branchID), companyID, req)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) || errors.Is(err, ErrBranchNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+func getVariantsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	variants, err := GetProductService().GetVariants(uint(id), companyID)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := populateStock(c, variants...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"variants": variants})
+}
+
+// createVariantHandler adds a variant under the product; its opening stock goes to the
+// caller's branch, or to branchId
+func createVariantHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	var req CreateVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change := stockChangeFromContext(c, MovementRestock)
+	if req.BranchID == nil {
+		req.BranchID = change.BranchID
+	} else if !User.CanAccessBranch(c, *req.BranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	variant, err := GetProductService().CreateVariant(uint(id), companyID, change.UserID, req)
+	if err != nil {
+		if productConflict(c, err) {
+			return
+		}
+		if errors.Is(err, ErrProductNotFound) || errors.Is(err, ErrBranchNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_ = populateStock(c, variant)
+
+	c.JSON(http.StatusCreated, variant)
+}
+
+// lookupProductHandler finds a product by a scanned barcode or its SKU (?code=)
+func lookupProductHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	product, err := GetProductService().LookupProduct(companyID, code)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PRODUCT_NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := populateStock(c, product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := GetProductService().PopulateBarcodes(product); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, product)
 }
+
+func addBarcodeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	var req CreateBarcodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	barcode, err := GetProductService().AddBarcode(uint(id), companyID, req)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateBarcode) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "DUPLICATE_BARCODE"})
+			return
+		}
+		if errors.Is(err, ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, barcode)
+}
+
+func deleteBarcodeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	productID, barcodeID, ok := barcodeParams(c)
+	if !ok {
+		return
+	}
+
+	if err := GetProductService().DeleteBarcode(productID, barcodeID, companyID); err != nil {
+		if errors.Is(err, ErrBarcodeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "barcode deleted successfully"})
+}
+
+// barcodeImageHandler renders a barcode for label printing. ?format=svg (default) or png,
+// ?scale= is the width in pixels of the narrowest bar (1-10, default 2) and ?height= the
+// bar height in pixels (20-600, default 80).
+func barcodeImageHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	productID, barcodeID, ok := barcodeParams(c)
+	if !ok {
+		return
+	}
+	scale, err := strconv.Atoi(c.DefaultQuery("scale", "2"))
+	if err != nil || scale < 1 || scale > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scale must be between 1 and 10"})
+		return
+	}
+	height, err := strconv.Atoi(c.DefaultQuery("height", "80"))
+	if err != nil || height < 20 || height > 600 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "height must be between 20 and 600"})
+		return
+	}
+
+	barcode, err := GetProductService().GetBarcode(productID, barcodeID, companyID)
+	if err != nil {
+		if errors.Is(err, ErrBarcodeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var image []byte
+	contentType := "image/svg+xml"
+	switch c.DefaultQuery("format", "svg") {
+	case "svg":
+		image, err = RenderBarcodeSVG(barcode, scale, height)
+	case "png":
+		contentType = "image/png"
+		image, err = RenderBarcodePNG(barcode, scale, height)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be svg or png"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, image)
+}
+
+func barcodeParams(c *gin.Context) (uint, uint, bool) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return 0, 0, false
+	}
+	barcodeID, err := strconv.ParseUint(c.Param("barcodeId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid barcode id"})
+		return 0, 0, false
+	}
+	return uint(productID), uint(barcodeID), true
+}
+
+// productConflict writes a 409 for errors caused by the state of other products and reports whether it did
+func productConflict(c *gin.Context, err error) bool {
+	var code string
+	switch {
+	case errors.Is(err, ErrDuplicateSKU):
+		code = "DUPLICATE_SKU"
+	case errors.Is(err, ErrDuplicateVariant):
+		code = "DUPLICATE_VARIANT"
+	case errors.Is(err, ErrHasVariants):
+		code = "HAS_VARIANTS"
+	case errors.Is(err, ErrParentHasStock):
+		code = "PARENT_HAS_STOCK"
+	default:
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": code})
+	return true
+}
+
+// stockChangeFromContext attributes a stock movement to the authenticated user and their branch
+func stockChangeFromContext(c *gin.Context, reason MovementReason) StockChange {
+	change := StockChange{Reason: reason}
+	if userID, exists := c.Get("user_id"); exists {
+		if userIDUint, ok := userID.(uint); ok {
+			change.UserID = &userIDUint
+		}
+	}
+	if branchID, exists := c.Get("branch_id"); exists {
+		if branchIDPtr, ok := branchID.(*uint); ok {
+			change.BranchID = branchIDPtr
+		}
+	}
+	return change
+}
+
+// populateStock adds the stock at the caller's branch to products and, for company-wide
+// roles, the per-branch breakdown. Company-wide roles can pick the branch with ?branchId=.
+func populateStock(c *gin.Context, products ...*Product) error {
+	branchID := User.BranchLimitFromContext(c)
+	breakdown := branchID == nil
+	if breakdown {
+		if branchIDParam := c.Query("branchId"); branchIDParam != "" {
+			if parsed, err := strconv.ParseUint(branchIDParam, 10, 32); err == nil {
+				id := uint(parsed)
+				branchID = &id
+			}
+		} else {
+			branchID = stockChangeFromContext(c, "").BranchID
+		}
+	}
+	return GetProductService().PopulateStock(products, branchID, breakdown)
+}
+
+func getCategoriesHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var categories []*Category
+	var err error
+	if c.Query("flat") == "true" {
+		categories, err = GetProductService().GetCategories(companyID)
+	} else {
+		categories, err = GetProductService().GetCategoryTree(companyID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+func getCategoryHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+
+	category, err := GetProductService().GetCategoryByID(uint(id), companyID)
+	if err != nil {
+		categoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func createCategoryHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	var req CreateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := GetProductService().CreateCategory(companyID, req)
+	if err != nil {
+		categoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+func updateCategoryHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+	var req UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := GetProductService().UpdateCategory(uint(id), companyID, req)
+	if err != nil {
+		categoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func deleteCategoryHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+
+	if err := GetProductService().DeleteCategory(uint(id), companyID); err != nil {
+		categoryErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "category deleted successfully"})
+}
+
+func categoryErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "CATEGORY_NOT_FOUND"})
+	case errors.Is(err, ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "CATEGORY_IN_USE"})
+	case errors.Is(err, ErrCategoryCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "CATEGORY_CYCLE"})
+	case errors.Is(err, ErrCategoryNameRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "CATEGORY_NAME_REQUIRED"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
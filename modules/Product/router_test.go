@@ -0,0 +1,73 @@
+package Product
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+// A branch manager can set their own branch's stock but cannot make changes that reach
+// every branch: editing the product, deleting it or recomputing its stock
+func TestBranchManagerCannotChangeProductForEveryBranch(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	other := Testutil.NewBranch(t, db, a.Company.ID, "a Other")
+	manager := Testutil.NewUser(t, db, a.Branch, "a-manager", User.BranchManager)
+	token := Testutil.Token(t, manager)
+	r := Testutil.NewRouter(RegisterRoutes)
+
+	product := newProduct(t, other, 5, 4)
+	if _, err := GetProductService().UpdateProduct(product.ID, UpdateProductRequest{Quantity: intPtr(3), BranchID: &a.Branch.ID}, StockChange{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPut, "/api/v1/products/%d", `{"price": 1}`},
+		{http.MethodPut, "/api/v1/products/%d", `{"name": "Renamed", "quantity": 4}`},
+		{http.MethodDelete, "/api/v1/products/%d", ""},
+		{http.MethodPost, "/api/v1/products/%d/movements/recompute?apply=true", ""},
+	} {
+		path := fmt.Sprintf(tc.path, product.ID)
+		w := Testutil.Serve(r, tc.method, path, token, tc.body)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s %s as branch manager: %d %s, want 403", tc.method, path, tc.body, w.Code, w.Body)
+		}
+	}
+
+	after, err := GetProductService().GetProductByID(product.ID)
+	if err != nil {
+		t.Fatalf("product after the branch manager's requests: %v", err)
+	}
+	if after.Price != product.Price || after.Name != product.Name {
+		t.Errorf("product changed to %q at %v", after.Name, after.Price)
+	}
+	if got := branchQuantity(t, db, product.ID, other.ID); got != 5 {
+		t.Errorf("other branch holds %d, want 5", got)
+	}
+
+	path := fmt.Sprintf("/api/v1/products/%d", product.ID)
+	if w := Testutil.Serve(r, http.MethodPut, path, token, `{"quantity": 4}`); w.Code != http.StatusOK {
+		t.Errorf("PUT %s quantity as branch manager: %d %s, want 200", path, w.Code, w.Body)
+	}
+	if got := branchQuantity(t, db, product.ID, a.Branch.ID); got != 4 {
+		t.Errorf("manager's branch holds %d, want 4", got)
+	}
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPut, "/api/v1/products/%d", `{"price": 12}`},
+		{http.MethodPost, "/api/v1/products/%d/movements/recompute?apply=true", ""},
+		{http.MethodDelete, "/api/v1/products/%d", ""},
+	} {
+		path := fmt.Sprintf(tc.path, product.ID)
+		if w := Testutil.Serve(r, tc.method, path, a.Token, tc.body); w.Code != http.StatusOK {
+			t.Errorf("%s %s as owner: %d %s, want 200", tc.method, path, w.Code, w.Body)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -2,14 +2,51 @@ package Product
 
 import (
 	"errors"
+	"fmt"
+	"log"
 
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // productsDB removed - using database now
 
 var productService *ProductService
 
+var (
+	// ErrProductNotFound is returned when a product does not exist or belongs to another company
+	ErrProductNotFound = errors.New("product not found")
+	// ErrInsufficientStock is returned when a reduction would take a product's quantity below zero
+	ErrInsufficientStock = errors.New("insufficient quantity")
+	// ErrBranchNotFound is returned when stock is moved at a branch outside the product's company
+	ErrBranchNotFound = errors.New("branch not found")
+	// ErrInvalidUnitCost is returned for negative unit costs
+	ErrInvalidUnitCost = errors.New("unit cost cannot be negative")
+	// ErrInvalidReorder is returned for negative reorder points or quantities
+	ErrInvalidReorder = errors.New("reorder point and quantity cannot be negative")
+	// ErrDuplicateSKU is returned when another product of the company already has the SKU
+	ErrDuplicateSKU = errors.New("another product already uses this SKU")
+	// ErrHasVariants is returned when stock is added to, or a sale made of, a product whose stock is held by its variants
+	ErrHasVariants = errors.New("product has variants; use one of its variants")
+	// ErrParentHasStock is returned when variants are added to a product that still holds stock of its own
+	ErrParentHasStock = errors.New("move the product's stock into a variant before adding variants")
+	// ErrNestedVariant is returned when a variant is added under another variant
+	ErrNestedVariant = errors.New("variants cannot have variants")
+	// ErrDuplicateVariant is returned when a sibling variant already has the same attributes
+	ErrDuplicateVariant = errors.New("a variant with these attributes already exists")
+	// ErrVariantAttributesRequired is returned for variants without attributes
+	ErrVariantAttributesRequired = errors.New("variants need at least one attribute")
+	// ErrVariantNotFound is returned when no variant of the product matches the sale's variant or attributes
+	ErrVariantNotFound = errors.New("no variant of the product matches the sale attributes")
+	// ErrVariantRequired is returned when a sale of a product with variants does not identify exactly one variant
+	ErrVariantRequired = errors.New("product has several matching variants; pass variantId or more attributes")
+	// ErrVersionConflict is returned when a product is updated against a version that someone else has since changed
+	ErrVersionConflict = errors.New("product was changed by someone else; reload it and try again")
+	// ErrQuantityAndDelta is returned when an update sets both quantity and quantityDelta
+	ErrQuantityAndDelta = errors.New("set quantity or quantityDelta, not both")
+)
+
 type ProductService struct {
 	db *gorm.DB
 }
@@ -22,13 +59,20 @@ func NewProductService() *ProductService {
 func InitializeService(db *gorm.DB) {
 	productService = &ProductService{db: db}
 	// TODO: Update all methods to use database instead of in-memory storage
+
+	if err := productService.backfillOpeningMovements(); err != nil {
+		log.Printf("Warning: failed to backfill opening stock movements: %v", err)
+	}
+	if err := productService.backfillBranchStock(); err != nil {
+		log.Printf("Warning: failed to backfill branch stock: %v", err)
+	}
 }
 
 func (s *ProductService) GetProductByID(id uint) (*Product, error) {
 	var product Product
 	if err := s.db.First(&product, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, err
 	}
@@ -43,12 +87,24 @@ func (s *ProductService) GetAllProducts() ([]*Product, error) {
 	return products, nil
 }
 
-func (s *ProductService) GetAllProductsByCompany(companyID uint) ([]*Product, error) {
+// ListProducts returns one page of the company's products matching params.
+// The categoryId filter includes the category's subcategories.
+func (s *ProductService) ListProducts(companyID uint, params *Query.Params) ([]*Product, *Query.Page, error) {
+	query := s.db.Model(&Product{}).Where("company_id = ?", companyID)
+	if categoryID := params.Uint("categoryId"); categoryID != nil {
+		ids, err := s.CategoryDescendants(companyID, *categoryID)
+		if err != nil {
+			return nil, nil, err
+		}
+		query = query.Where("category_id IN ?", ids)
+	}
+
 	var products []*Product
-	if err := s.db.Where("company_id = ?", companyID).Find(&products).Error; err != nil {
-		return nil, err
+	page, err := Query.Paginate(query, params, &products)
+	if err != nil {
+		return nil, nil, err
 	}
-	return products, nil
+	return products, page, nil
 }
 
 func (s *ProductService) GetProductsByCompany(companyID uint) ([]*Product, error) {
@@ -60,40 +116,143 @@ func (s *ProductService) GetProductsByCompany(companyID uint) ([]*Product, error
 }
 
 func (s *ProductService) CreateProduct(req CreateProductRequest) (*Product, error) {
+	var product *Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = s.CreateProductTx(tx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// CreateProductTx creates a product and books its opening stock inside tx
+func (s *ProductService) CreateProductTx(tx *gorm.DB, req CreateProductRequest) (*Product, error) {
+	if req.UnitCost < 0 {
+		return nil, ErrInvalidUnitCost
+	}
+	if !validReorder(req.ReorderPoint, req.ReorderQuantity) {
+		return nil, ErrInvalidReorder
+	}
+
 	product := &Product{
-		Name:       req.Name,
-		Price:      req.Price,
-		Currency:   req.Currency,
-		CompanyID:  req.CompanyID,
-		Quantity:   req.Quantity,
-		ImageURI:   req.ImageURI,
-		Attributes: JSONB(req.Attributes),
-		SyncStatus: nil,
+		Name:            req.Name,
+		Price:           req.Price,
+		Currency:        req.Currency,
+		CompanyID:       req.CompanyID,
+		UnitCost:        req.UnitCost,
+		ReorderPoint:    req.ReorderPoint,
+		ReorderQuantity: req.ReorderQuantity,
+		ImageURI:        req.ImageURI,
+		Attributes:      JSONB(req.Attributes),
+		SyncStatus:      nil,
 	}
 
 	if product.Attributes == nil {
 		product.Attributes = make(JSONB)
 	}
 
-	if err := s.db.Create(product).Error; err != nil {
+	if err := s.createProductTx(tx, product, req); err != nil {
 		return nil, err
 	}
 
 	return product, nil
 }
 
-func (s *ProductService) UpdateProduct(id uint, req UpdateProductRequest) (*Product, error) {
-	var product Product
-	if err := s.db.First(&product, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("product not found")
+// createProductTx inserts product and books req.Quantity as its opening stock
+func (s *ProductService) createProductTx(tx *gorm.DB, product *Product, req CreateProductRequest) error {
+	product.SKU = normalizeSKU(req.SKU)
+	product.ParentID = req.ParentID
+	if err := s.checkSKUTx(tx, product.CompanyID, product.SKU, 0); err != nil {
+		return err
+	}
+	if req.CategoryID != nil {
+		if err := s.checkCategoryTx(tx, product.CompanyID, req.CategoryID); err != nil {
+			return err
 		}
+		product.CategoryID = req.CategoryID
+	}
+	if err := tx.Create(product).Error; err != nil {
+		return err
+	}
+
+	// The opening stock goes through the ledger like any other restock
+	notes := "Opening stock"
+	unitCost := req.UnitCost
+	stocked, err := s.AdjustQuantityTx(tx, product.ID, nil, req.Quantity, StockChange{
+		Reason:   MovementRestock,
+		UserID:   req.UserID,
+		BranchID: req.BranchID,
+		UnitCost: &unitCost,
+		Notes:    &notes,
+	})
+	if err != nil {
+		return err
+	}
+	product.Quantity = stocked.Quantity
+	return nil
+}
+
+// UpdateProduct applies req to the product. A new quantity is recorded in the stock
+// ledger as the difference from the current quantity; change carries who made it.
+// An update made against an older req.Version returns ErrVersionConflict.
+func (s *ProductService) UpdateProduct(id uint, req UpdateProductRequest, change StockChange) (*Product, error) {
+	var product *Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		product, err = s.UpdateProductTx(tx, id, nil, req, change)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// UpdateProductTx applies req to a product inside tx. With companyID set, products of
+// other companies are not found.
+func (s *ProductService) UpdateProductTx(tx *gorm.DB, id uint, companyID *uint, req UpdateProductRequest, change StockChange) (*Product, error) {
+	if req.Quantity != nil && *req.Quantity < 0 {
+		return nil, ErrInsufficientStock
+	}
+	if req.Quantity != nil && req.QuantityDelta != nil {
+		return nil, ErrQuantityAndDelta
+	}
+	if !validReorder(req.ReorderPoint, req.ReorderQuantity) {
+		return nil, ErrInvalidReorder
+	}
+
+	product, err := s.LockProductTx(tx, id, companyID)
+	if err != nil {
 		return nil, err
 	}
+	if req.Version != nil && *req.Version != product.Version {
+		return nil, ErrVersionConflict
+	}
+	product.Version++
 
 	if req.Name != nil {
 		product.Name = *req.Name
 	}
+	if req.SKU != nil {
+		product.SKU = normalizeSKU(req.SKU)
+		if err := s.checkSKUTx(tx, product.CompanyID, product.SKU, product.ID); err != nil {
+			return nil, err
+		}
+	}
+	if req.CategoryID != nil {
+		if *req.CategoryID == 0 {
+			product.CategoryID = nil
+		} else {
+			if err := s.checkCategoryTx(tx, product.CompanyID, req.CategoryID); err != nil {
+				return nil, err
+			}
+			product.CategoryID = req.CategoryID
+		}
+	}
 	if req.Price != nil {
 		product.Price = *req.Price
 	}
@@ -103,8 +262,17 @@ func (s *ProductService) UpdateProduct(id uint, req UpdateProductRequest) (*Prod
 	if req.CompanyID != nil {
 		product.CompanyID = *req.CompanyID
 	}
-	if req.Quantity != nil {
-		product.Quantity = *req.Quantity
+	if req.UnitCost != nil {
+		if *req.UnitCost < 0 {
+			return nil, ErrInvalidUnitCost
+		}
+		product.UnitCost = *req.UnitCost
+	}
+	if req.ReorderPoint != nil {
+		product.ReorderPoint = req.ReorderPoint
+	}
+	if req.ReorderQuantity != nil {
+		product.ReorderQuantity = req.ReorderQuantity
 	}
 	if req.ImageURI != nil {
 		product.ImageURI = req.ImageURI
@@ -113,44 +281,465 @@ func (s *ProductService) UpdateProduct(id uint, req UpdateProductRequest) (*Prod
 		product.Attributes = JSONB(req.Attributes)
 	}
 
-	if err := s.db.Save(&product).Error; err != nil {
+	if err := tx.Save(product).Error; err != nil {
 		return nil, err
 	}
+	if req.CategoryID != nil {
+		// Variants stay in their parent's category
+		if err := tx.Model(&Product{}).Where("parent_id = ?", product.ID).Update("category_id", product.CategoryID).Error; err != nil {
+			return nil, err
+		}
+	}
+	if req.ReorderPoint != nil {
+		if err := s.checkProductLowStockTx(tx, product); err != nil {
+			return nil, err
+		}
+	}
 
-	return &product, nil
+	if req.BranchID != nil {
+		change.BranchID = req.BranchID
+	}
+	if req.Quantity == nil && req.QuantityDelta == nil {
+		return product, nil
+	}
+
+	// Quantity is the new stock level of one branch
+	branchID, err := s.resolveBranchTx(tx, product.CompanyID, change.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	current := product.Quantity
+	if branchID != nil {
+		stock, err := s.lockBranchStockTx(tx, product, *branchID)
+		if err != nil {
+			return nil, err
+		}
+		current = stock.Quantity
+	}
+	change.BranchID = branchID
+
+	quantity := current
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	} else {
+		quantity += *req.QuantityDelta
+		if quantity < 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+	if quantity != current {
+		delta := quantity - current
+		if req.StockReason != nil {
+			change.Reason = *req.StockReason
+		} else if delta > 0 {
+			change.Reason = MovementRestock
+		} else {
+			change.Reason = MovementAdjustment
+		}
+		if req.StockNotes != nil {
+			change.Notes = req.StockNotes
+		}
+		return s.AdjustQuantityTx(tx, id, nil, delta, change)
+	}
+
+	return product, nil
+}
+
+// DeleteProduct removes a product. Stock still held is written off to zero first, with
+// an "adjustment" movement per branch recorded by change, in the same transaction.
+func (s *ProductService) DeleteProduct(id uint, change StockChange) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		product, err := s.LockProductTx(tx, id, nil)
+		if err != nil {
+			return err
+		}
+		if hasVariants, err := s.hasVariantsTx(tx, product.ID); err != nil {
+			return err
+		} else if hasVariants {
+			return ErrHasVariants
+		}
+
+		notes := "Product deleted"
+		change.Reason = MovementAdjustment
+		change.Notes = &notes
+		var stocks []*BranchStock
+		if err := tx.Where("product_id = ? AND quantity <> 0", product.ID).Order("branch_id").Find(&stocks).Error; err != nil {
+			return err
+		}
+		for _, stock := range stocks {
+			branchID := stock.BranchID
+			change.BranchID = &branchID
+			if product, err = s.AdjustQuantityTx(tx, product.ID, nil, -stock.Quantity, change); err != nil {
+				return err
+			}
+		}
+		// Companies without branches only keep the total
+		if len(stocks) == 0 && product.Quantity != 0 {
+			change.BranchID = nil
+			if product, err = s.AdjustQuantityTx(tx, product.ID, nil, -product.Quantity, change); err != nil {
+				return err
+			}
+		}
+
+		// Free the product's barcodes for reuse
+		if err := tx.Where("product_id = ?", product.ID).Delete(&ProductBarcode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(product).Error
+	})
 }
 
-func (s *ProductService) DeleteProduct(id uint) error {
+// ReduceProductQuantity takes quantity out of stock, recording change in the ledger
+func (s *ProductService) ReduceProductQuantity(id uint, quantity int, change StockChange) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		_, err := s.AdjustQuantityTx(tx, id, nil, -quantity, change)
+		return err
+	})
+}
+
+// LockProductTx loads the product with a row lock held until tx ends.
+// When companyID is set, the product must belong to that company.
+func (s *ProductService) LockProductTx(tx *gorm.DB, id uint, companyID *uint) (*Product, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id)
+	if companyID != nil {
+		query = query.Where("company_id = ?", *companyID)
+	}
+
 	var product Product
-	if err := s.db.First(&product, "id = ?", id).Error; err != nil {
+	if err := query.First(&product).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return errors.New("product not found")
+			return nil, ErrProductNotFound
 		}
-		return err
+		return nil, err
 	}
-	if err := s.db.Delete(&product).Error; err != nil {
-		return err
+	return &product, nil
+}
+
+// AdjustQuantityTx locks the product row, applies delta to its quantity and records
+// the stock movement described by change, all inside tx.
+// When companyID is set, the product must belong to that company.
+// Callers are expected to run this inside a transaction so the row lock is held until commit.
+func (s *ProductService) AdjustQuantityTx(tx *gorm.DB, id uint, companyID *uint, delta int, change StockChange) (*Product, error) {
+	product, _, err := s.AdjustStockTx(tx, id, companyID, delta, change)
+	return product, err
+}
+
+// AdjustStockTx is AdjustQuantityTx that also returns the recorded movement, whose
+// UnitCost is the cost of the units moved. It returns a nil movement when delta is zero.
+func (s *ProductService) AdjustStockTx(tx *gorm.DB, id uint, companyID *uint, delta int, change StockChange) (*Product, *StockMovement, error) {
+	product, err := s.LockProductTx(tx, id, companyID)
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil
+
+	if delta == 0 {
+		return product, nil, nil
+	}
+	if product.Quantity+delta < 0 {
+		return nil, nil, ErrInsufficientStock
+	}
+	if delta > 0 {
+		hasVariants, err := s.hasVariantsTx(tx, product.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hasVariants {
+			return nil, nil, ErrHasVariants
+		}
+	}
+
+	// Stock is held by a branch: the given one, otherwise the company's main branch
+	branchID, err := s.resolveBranchTx(tx, product.CompanyID, change.BranchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	change.BranchID = branchID
+	if branchID != nil {
+		stock, err := s.lockBranchStockTx(tx, product, *branchID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stock.Quantity+delta < 0 {
+			return nil, nil, ErrInsufficientStock
+		}
+		stock.Quantity += delta
+		if err := tx.Model(stock).Update("quantity", stock.Quantity).Error; err != nil {
+			return nil, nil, err
+		}
+		if err := s.checkLowStockTx(tx, product, stock); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	unitCost, err := s.applyCostTx(tx, product, delta, change)
+	if err != nil {
+		return nil, nil, err
+	}
+	change.UnitCost = &unitCost
+
+	product.Quantity += delta
+	if err := tx.Model(product).Updates(map[string]interface{}{
+		"quantity":  product.Quantity,
+		"unit_cost": product.UnitCost,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	movement, err := s.recordMovementTx(tx, product, delta, change)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return product, movement, nil
 }
 
-func (s *ProductService) ReduceProductQuantity(id uint, quantity int) error {
-	var product Product
-	if err := s.db.First(&product, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("product not found")
+// resolveBranchTx returns the branch whose stock a change applies to. A given branch must
+// belong to the company; without one the company's main (first) branch is used. It returns
+// nil for companies without branches, whose stock is only kept as the company total.
+func (s *ProductService) resolveBranchTx(tx *gorm.DB, companyID uint, branchID *uint) (*uint, error) {
+	var ids []uint
+	query := tx.Table("branches").Where("company_id = ? AND deleted_at IS NULL", companyID)
+	if branchID != nil {
+		query = query.Where("id = ?", *branchID)
+	}
+	if err := query.Order("id").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		if branchID != nil {
+			return nil, ErrBranchNotFound
 		}
-		return err
+		return nil, nil
+	}
+	return &ids[0], nil
+}
+
+// lockBranchStockTx locks the product's stock row at branchID, creating an empty one if needed.
+// Callers lock the product row first so concurrent changes take the locks in the same order.
+func (s *ProductService) lockBranchStockTx(tx *gorm.DB, product *Product, branchID uint) (*BranchStock, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&BranchStock{
+		ProductID: product.ID,
+		BranchID:  branchID,
+		CompanyID: product.CompanyID,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	var stock BranchStock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND branch_id = ?", product.ID, branchID).
+		First(&stock).Error; err != nil {
+		return nil, err
+	}
+	return &stock, nil
+}
+
+// BranchQuantityTx returns the product's stock at branchID, zero when the branch has never held it
+func (s *ProductService) BranchQuantityTx(tx *gorm.DB, id uint, branchID uint) (int, error) {
+	var quantities []int
+	if err := tx.Model(&BranchStock{}).Where("product_id = ? AND branch_id = ?", id, branchID).Pluck("quantity", &quantities).Error; err != nil {
+		return 0, err
+	}
+	if len(quantities) == 0 {
+		return 0, nil
+	}
+	return quantities[0], nil
+}
+
+// PopulateStock sets each product's quantity at branchID (when given) and, with breakdown,
+// the stock of every branch. It loads all the products' stock in one query.
+func (s *ProductService) PopulateStock(products []*Product, branchID *uint, breakdown bool) error {
+	if len(products) == 0 || (branchID == nil && !breakdown) {
+		return nil
 	}
 
-	if product.Quantity < quantity {
-		return errors.New("insufficient quantity")
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
 	}
 
-	product.Quantity -= quantity
-	if err := s.db.Save(&product).Error; err != nil {
+	var levels []*BranchStockLevel
+	if err := s.db.Table("branch_stocks").
+		Select("branch_stocks.product_id, branch_stocks.branch_id, branches.name AS branch_name, branch_stocks.quantity, "+effectiveReorderSQL).
+		Joins("JOIN branches ON branches.id = branch_stocks.branch_id AND branches.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = branch_stocks.product_id").
+		Where("branch_stocks.product_id IN ?", ids).
+		Order("branches.id").
+		Scan(&levels).Error; err != nil {
 		return err
 	}
 
+	byProduct := make(map[uint][]*BranchStockLevel)
+	for _, level := range levels {
+		level.LowStock = level.ReorderPoint != nil && level.Quantity <= *level.ReorderPoint
+		byProduct[level.ProductID] = append(byProduct[level.ProductID], level)
+	}
+	for _, product := range products {
+		if branchID != nil {
+			quantity := 0
+			for _, level := range byProduct[product.ID] {
+				if level.BranchID == *branchID {
+					quantity = level.Quantity
+				}
+			}
+			product.BranchQuantity = &quantity
+		}
+		if breakdown {
+			product.BranchStock = byProduct[product.ID]
+			if product.BranchStock == nil {
+				product.BranchStock = []*BranchStockLevel{}
+			}
+		}
+	}
 	return nil
 }
+
+// recordMovementTx appends a movement for a quantity change already applied to product
+func (s *ProductService) recordMovementTx(tx *gorm.DB, product *Product, delta int, change StockChange) (*StockMovement, error) {
+	if change.Reason == "" {
+		change.Reason = MovementAdjustment
+	}
+	movement := &StockMovement{
+		ProductID:     product.ID,
+		CompanyID:     product.CompanyID,
+		BranchID:      change.BranchID,
+		Delta:         delta,
+		QuantityAfter: product.Quantity,
+		Reason:        change.Reason,
+		ReferenceID:   change.ReferenceID,
+		UserID:        change.UserID,
+		UnitCost:      change.UnitCost,
+		Notes:         change.Notes,
+	}
+	if err := tx.Create(movement).Error; err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
+
+// GetStockMovements returns the product's ledger, newest first
+func (s *ProductService) GetStockMovements(productID uint, companyID uint) ([]*StockMovement, error) {
+	var movements []*StockMovement
+	if err := s.db.Where("product_id = ? AND company_id = ?", productID, companyID).
+		Order("created_at DESC, id DESC").
+		Find(&movements).Error; err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+// RecomputeQuantity sums the product's ledger and compares it with the stored quantity
+// and each branch's stock. With apply set, whatever drifted from the ledger is set back to
+// it in one transaction, and an "adjustment" movement with a zero delta records what was
+// corrected. A movement carrying the difference would itself move the ledger sum and open
+// the gap again, so the ledger is taken as it is and only the stored quantities change.
+func (s *ProductService) RecomputeQuantity(id uint, companyID uint, apply bool, change StockChange) (*StockReconciliation, error) {
+	var result *StockReconciliation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		product, err := s.LockProductTx(tx, id, &companyID)
+		if err != nil {
+			return err
+		}
+
+		var ledgerByBranch []struct {
+			BranchID *uint
+			Quantity int
+		}
+		if err := tx.Model(&StockMovement{}).
+			Where("product_id = ?", id).
+			Select("branch_id, COALESCE(SUM(delta), 0) AS quantity").
+			Group("branch_id").
+			Scan(&ledgerByBranch).Error; err != nil {
+			return err
+		}
+		var stocks []*BranchStock
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", id).Find(&stocks).Error; err != nil {
+			return err
+		}
+
+		ledger := 0
+		branchLedger := make(map[uint]int)
+		for _, row := range ledgerByBranch {
+			ledger += row.Quantity
+			if row.BranchID != nil {
+				branchLedger[*row.BranchID] = row.Quantity
+			}
+		}
+		var drifted []uint
+		hasRow := make(map[uint]bool)
+		for _, stock := range stocks {
+			hasRow[stock.BranchID] = true
+			if stock.Quantity != branchLedger[stock.BranchID] {
+				drifted = append(drifted, stock.BranchID)
+			}
+		}
+		// Branches with movements but no stock row yet
+		for branchID, quantity := range branchLedger {
+			if !hasRow[branchID] && quantity != 0 {
+				drifted = append(drifted, branchID)
+			}
+		}
+
+		result = &StockReconciliation{
+			ProductID:        product.ID,
+			PreviousQuantity: product.Quantity,
+			LedgerQuantity:   ledger,
+			Difference:       ledger - product.Quantity,
+			BranchesDrifted:  len(drifted),
+		}
+		if !apply || (result.Difference == 0 && len(drifted) == 0) {
+			return nil
+		}
+
+		for _, branchID := range drifted {
+			stock, err := s.lockBranchStockTx(tx, product, branchID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(stock).Update("quantity", branchLedger[branchID]).Error; err != nil {
+				return err
+			}
+		}
+		product.Quantity = ledger
+		if err := tx.Model(product).Update("quantity", ledger).Error; err != nil {
+			return err
+		}
+
+		notes := fmt.Sprintf("Recomputed from the ledger: stored quantity %d set to %d, %d branch(es) corrected", result.PreviousQuantity, ledger, len(drifted))
+		change.Reason = MovementAdjustment
+		change.BranchID = nil
+		change.Notes = &notes
+		if _, err := s.recordMovementTx(tx, product, 0, change); err != nil {
+			return err
+		}
+		result.Corrected = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mainBranchSQL selects the main (first) branch of the company of product p
+const mainBranchSQL = `(SELECT b.id FROM branches b WHERE b.company_id = p.company_id AND b.deleted_at IS NULL ORDER BY b.id LIMIT 1)`
+
+// backfillOpeningMovements gives products created before the ledger existed an opening
+// movement for their current quantity, so the ledger sums to it
+func (s *ProductService) backfillOpeningMovements() error {
+	return s.db.Exec(`INSERT INTO stock_movements (created_at, product_id, company_id, branch_id, delta, quantity_after, reason, notes)
+		SELECT NOW(), p.id, p.company_id, `+mainBranchSQL+`, p.quantity, p.quantity, ?, 'Opening balance'
+		FROM products p
+		WHERE p.deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.product_id = p.id)`, MovementAdjustment).Error
+}
+
+// backfillBranchStock places the stock of products created before per-branch stock existed
+// at their company's main branch
+func (s *ProductService) backfillBranchStock() error {
+	return s.db.Exec(`INSERT INTO branch_stocks (created_at, updated_at, product_id, branch_id, company_id, quantity)
+		SELECT NOW(), NOW(), p.id, ` + mainBranchSQL + `, p.company_id, p.quantity
+		FROM products p
+		WHERE p.deleted_at IS NULL
+		AND ` + mainBranchSQL + ` IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM branch_stocks s WHERE s.product_id = p.id)`).Error
+}
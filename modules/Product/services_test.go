@@ -0,0 +1,53 @@
+package Product
+
+import (
+	"testing"
+
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a throwaway database with the product tables and initializes the services on it
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t,
+		&Notification.Notification{}, &Idempotency.IdempotencyKey{},
+		&Category{}, &Product{}, &StockMovement{}, &CostLayer{}, &ProductBarcode{}, &BranchStock{},
+	)
+	Notification.InitializeService(db)
+	Idempotency.InitializeService(db)
+	InitializeService(db)
+	return db
+}
+
+// newProduct creates a product priced at 10 whose opening stock of quantity units, bought
+// at unitCost each, is held by branch
+func newProduct(t testing.TB, branch *User.Branch, quantity int, unitCost float64) *Product {
+	t.Helper()
+	branchID := branch.ID
+	product, err := GetProductService().CreateProduct(CreateProductRequest{
+		Name:      "Widget",
+		Price:     10,
+		Currency:  "UGX",
+		CompanyID: branch.CompanyID,
+		Quantity:  quantity,
+		UnitCost:  unitCost,
+		BranchID:  &branchID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func branchQuantity(t testing.TB, db *gorm.DB, productID, branchID uint) int {
+	t.Helper()
+	var stock BranchStock
+	if err := db.Where("product_id = ? AND branch_id = ?", productID, branchID).Limit(1).Find(&stock).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stock.Quantity
+}
@@ -0,0 +1,261 @@
+package Product
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// Barcode encoding and rendering for label printing. Codes are encoded into modules
+// (narrow bar or space units), which are drawn as PNG or SVG at a given module width.
+
+var (
+	// ErrInvalidEAN13 is returned for codes that are not 12 or 13 digits with a valid check digit
+	ErrInvalidEAN13 = errors.New("an EAN-13 code must be 13 digits with a valid check digit")
+	// ErrInvalidCode128 is returned for Code 128 codes that are empty, too long or not printable ASCII
+	ErrInvalidCode128 = errors.New("a Code 128 code must be 1 to 48 printable ASCII characters")
+	// ErrNotRenderable is returned when an image is asked for a custom barcode
+	ErrNotRenderable = errors.New("custom barcodes cannot be rendered")
+)
+
+// ean13Quiet and code128Quiet are the blank modules kept on each side of the bars
+const (
+	ean13Quiet   = 11
+	code128Quiet = 10
+)
+
+var (
+	// ean13L holds the left-hand odd parity patterns; right-hand patterns are their complement
+	// and even parity patterns the reverse of the right-hand ones
+	ean13L = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	// ean13Parity is the odd (L) / even (G) choice for the left digits, selected by the first digit
+	ean13Parity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// code128Patterns are the bar and space widths of each Code 128 symbol value; 103 to 105
+// are the start codes for sets A, B and C and 106 is the stop pattern
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// ean13CheckDigit returns the check digit of the first 12 digits of code
+func ean13CheckDigit(code string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(code[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(code string) bool {
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+	return code != ""
+}
+
+// normalizeEAN13 validates code, completing a 12-digit code with its check digit
+func normalizeEAN13(code string) (string, error) {
+	if !allDigits(code) || (len(code) != 12 && len(code) != 13) {
+		return "", ErrInvalidEAN13
+	}
+	check := ean13CheckDigit(code)
+	if len(code) == 12 {
+		return code + string(check), nil
+	}
+	if code[12] != check {
+		return "", ErrInvalidEAN13
+	}
+	return code, nil
+}
+
+func validCode128(code string) bool {
+	if code == "" || len(code) > 48 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 32 || code[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeEAN13 returns the 95 modules of a validated 13-digit code, true for bars
+func encodeEAN13(code string) []bool {
+	var pattern strings.Builder
+	pattern.WriteString("101")
+	parity := ean13Parity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		digit := code[i] - '0'
+		if parity[i-1] == 'L' {
+			pattern.WriteString(ean13L[digit])
+		} else {
+			pattern.WriteString(reverse(complement(ean13L[digit])))
+		}
+	}
+	pattern.WriteString("01010")
+	for i := 7; i <= 12; i++ {
+		pattern.WriteString(complement(ean13L[code[i]-'0']))
+	}
+	pattern.WriteString("101")
+	return bitsToModules(pattern.String())
+}
+
+// encodeCode128 returns the modules of code, using set C for even-length digit strings and set B otherwise
+func encodeCode128(code string) []bool {
+	var values []int
+	if allDigits(code) && len(code)%2 == 0 {
+		values = append(values, code128StartC)
+		for i := 0; i < len(code); i += 2 {
+			values = append(values, int(code[i]-'0')*10+int(code[i+1]-'0'))
+		}
+	} else {
+		values = append(values, code128StartB)
+		for i := 0; i < len(code); i++ {
+			values = append(values, int(code[i])-32)
+		}
+	}
+
+	checksum := values[0]
+	for i := 1; i < len(values); i++ {
+		checksum += i * values[i]
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	var modules []bool
+	for _, value := range values {
+		for i, width := range code128Patterns[value] {
+			for w := 0; w < int(width-'0'); w++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	return modules
+}
+
+// barcodeModules encodes a barcode with its quiet zones
+func barcodeModules(barcode *ProductBarcode) ([]bool, error) {
+	var modules []bool
+	quiet := 0
+	switch barcode.Symbology {
+	case EAN13:
+		modules, quiet = encodeEAN13(barcode.Code), ean13Quiet
+	case Code128:
+		modules, quiet = encodeCode128(barcode.Code), code128Quiet
+	default:
+		return nil, ErrNotRenderable
+	}
+	padded := make([]bool, quiet, len(modules)+2*quiet)
+	padded = append(padded, modules...)
+	return append(padded, make([]bool, quiet)...), nil
+}
+
+// RenderBarcodePNG draws the barcode with scale pixels per module and height pixels tall
+func RenderBarcodePNG(barcode *ProductBarcode, scale int, height int) ([]byte, error) {
+	modules, err := barcodeModules(barcode)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, len(modules)*scale, height))
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		shade := color.Gray{Y: 255}
+		if modules[x/scale] {
+			shade = color.Gray{Y: 0}
+		}
+		for y := 0; y < height; y++ {
+			img.SetGray(x, y, shade)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderBarcodeSVG draws the barcode with scale pixels per module, with the code printed below the bars
+func RenderBarcodeSVG(barcode *ProductBarcode, scale int, height int) ([]byte, error) {
+	modules, err := barcodeModules(barcode)
+	if err != nil {
+		return nil, err
+	}
+
+	fontSize := 10 * scale
+	width := len(modules) * scale
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height+fontSize+2*scale, width, height+fontSize+2*scale)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/>`)
+	for x := 0; x < len(modules); {
+		if !modules[x] {
+			x++
+			continue
+		}
+		run := 1
+		for x+run < len(modules) && modules[x+run] {
+			run++
+		}
+		fmt.Fprintf(&buf, `<rect x="%d" y="0" width="%d" height="%d" fill="#000"/>`, x*scale, run*scale, height)
+		x += run
+	}
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-family="monospace" font-size="%d" text-anchor="middle">%s</text>`, width/2, height+fontSize, fontSize, html.EscapeString(barcode.Code))
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+func complement(bits string) string {
+	out := []byte(bits)
+	for i := range out {
+		if out[i] == '0' {
+			out[i] = '1'
+		} else {
+			out[i] = '0'
+		}
+	}
+	return string(out)
+}
+
+func reverse(bits string) string {
+	out := []byte(bits)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func bitsToModules(bits string) []bool {
+	modules := make([]bool, len(bits))
+	for i := range bits {
+		modules[i] = bits[i] == '1'
+	}
+	return modules
+}
@@ -0,0 +1,60 @@
+package Product
+
+import (
+	"errors"
+	"testing"
+)
+
+// EAN-13 codes are checked against their check digit; a UPC-A code is the same code with
+// a leading zero, and a 12-digit code is completed with its check digit
+func TestNormalizeEAN13(t *testing.T) {
+	for _, tc := range []struct {
+		name, code, want string
+	}{
+		{"EAN-13", "4006381333931", "4006381333931"},
+		{"EAN-13 with check digit 0", "9780306406157", "9780306406157"},
+		{"UPC-A as EAN-13", "0036000291452", "0036000291452"},
+		{"UPC-A with check digit 5", "0012345678905", "0012345678905"},
+		{"12 digits completed", "400638133393", "4006381333931"},
+		{"12 digits completed from UPC-A", "003600029145", "0036000291452"},
+		{"wrong check digit", "4006381333932", ""},
+		{"UPC-A with wrong check digit", "0036000291453", ""},
+		{"swapped digits", "4006381339331", ""},
+		{"11 digits", "40063813339", ""},
+		{"14 digits", "40063813339310", ""},
+		{"letters", "400638133393X", ""},
+		{"spaces", "4006381 33393", ""},
+		{"empty", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeEAN13(tc.code)
+			if tc.want == "" {
+				if !errors.Is(err, ErrInvalidEAN13) {
+					t.Errorf("normalizeEAN13(%q) = %q, %v, want ErrInvalidEAN13", tc.code, got, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("normalizeEAN13(%q) = %q, %v, want %q", tc.code, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEAN13(t *testing.T) {
+	modules := encodeEAN13("4006381333931")
+	if len(modules) != 95 {
+		t.Fatalf("got %d modules, want 95", len(modules))
+	}
+	// Start, centre and end guards
+	for _, guard := range []struct {
+		at   int
+		bits string
+	}{{0, "101"}, {45, "01010"}, {92, "101"}} {
+		for i, bit := range guard.bits {
+			if modules[guard.at+i] != (bit == '1') {
+				t.Errorf("module %d = %v, want guard %s at %d", guard.at+i, modules[guard.at+i], guard.bits, guard.at)
+			}
+		}
+	}
+}
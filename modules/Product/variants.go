@@ -0,0 +1,302 @@
+package Product
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Variants. A variant (e.g. a 6kg refill of a gas brand) is a product of its own with
+// ParentID set, so it has its own SKU, price, stock, ledger and costing. Its Attributes
+// are what set it apart from its siblings. Once a product has variants its stock is held
+// by them, and sales of it must name a variant, directly or through matching attributes.
+
+func normalizeSKU(sku *string) *string {
+	if sku == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*sku)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// checkSKUTx returns ErrDuplicateSKU when another product of the company (not excludeID) uses sku
+func (s *ProductService) checkSKUTx(tx *gorm.DB, companyID uint, sku *string, excludeID uint) error {
+	if sku == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&Product{}).
+		Where("company_id = ? AND LOWER(sku) = LOWER(?) AND id <> ?", companyID, *sku, excludeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateSKU
+	}
+	return nil
+}
+
+func (s *ProductService) hasVariantsTx(tx *gorm.DB, id uint) (bool, error) {
+	var count int64
+	if err := tx.Model(&Product{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateVariant adds a variant under parentID, with req.Quantity as its opening stock
+func (s *ProductService) CreateVariant(parentID uint, companyID uint, userID *uint, req CreateVariantRequest) (*Product, error) {
+	if len(req.Attributes) == 0 {
+		return nil, ErrVariantAttributesRequired
+	}
+	if req.UnitCost < 0 {
+		return nil, ErrInvalidUnitCost
+	}
+	if !validReorder(req.ReorderPoint, req.ReorderQuantity) {
+		return nil, ErrInvalidReorder
+	}
+
+	var variant *Product
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the parent serializes sibling creation for the duplicate check
+		parent, err := s.LockProductTx(tx, parentID, &companyID)
+		if err != nil {
+			return err
+		}
+		if parent.ParentID != nil {
+			return ErrNestedVariant
+		}
+
+		siblings, err := s.variantsTx(tx, parent.ID)
+		if err != nil {
+			return err
+		}
+		if len(siblings) == 0 && parent.Quantity != 0 {
+			return ErrParentHasStock
+		}
+		for _, sibling := range siblings {
+			if sameAttributes(sibling.Attributes, req.Attributes) {
+				return ErrDuplicateVariant
+			}
+		}
+
+		variant = &Product{
+			Name:            variantName(parent.Name, req.Attributes),
+			Price:           parent.Price,
+			Currency:        parent.Currency,
+			CompanyID:       companyID,
+			UnitCost:        req.UnitCost,
+			CategoryID:      parent.CategoryID,
+			ReorderPoint:    parent.ReorderPoint,
+			ReorderQuantity: parent.ReorderQuantity,
+			ImageURI:        parent.ImageURI,
+			Attributes:      JSONB(req.Attributes),
+		}
+		if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+			variant.Name = strings.TrimSpace(*req.Name)
+		}
+		if req.Price != nil {
+			variant.Price = *req.Price
+		}
+		if req.ImageURI != nil {
+			variant.ImageURI = req.ImageURI
+		}
+		if req.ReorderPoint != nil {
+			variant.ReorderPoint = req.ReorderPoint
+		}
+		if req.ReorderQuantity != nil {
+			variant.ReorderQuantity = req.ReorderQuantity
+		}
+
+		return s.createProductTx(tx, variant, CreateProductRequest{
+			SKU:        req.SKU,
+			CategoryID: parent.CategoryID,
+			Quantity:   req.Quantity,
+			UnitCost:   req.UnitCost,
+			UserID:     userID,
+			BranchID:   req.BranchID,
+			ParentID:   &parent.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// GetVariants returns the variants of a product of the company, by name
+func (s *ProductService) GetVariants(parentID uint, companyID uint) ([]*Product, error) {
+	var parent Product
+	if err := s.db.Where("company_id = ?", companyID).First(&parent, "id = ?", parentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return s.variantsTx(s.db, parent.ID)
+}
+
+// PopulateVariants sets the variants of each product that has any, in one query
+func (s *ProductService) PopulateVariants(products ...*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	var variants []*Product
+	if err := s.db.Where("parent_id IN ?", ids).Order("name").Find(&variants).Error; err != nil {
+		return err
+	}
+	byParent := make(map[uint][]*Product)
+	for _, variant := range variants {
+		byParent[*variant.ParentID] = append(byParent[*variant.ParentID], variant)
+	}
+	for _, product := range products {
+		product.Variants = byParent[product.ID]
+	}
+	return nil
+}
+
+func (s *ProductService) variantsTx(tx *gorm.DB, parentID uint) ([]*Product, error) {
+	variants := []*Product{}
+	if err := tx.Where("parent_id = ?", parentID).Order("name").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// ResolveVariantTx returns the product a sale of productID takes its stock from, and the
+// sale's attributes with the variant's filled in. For a product with variants the variant is
+// variantID, or else the only variant whose attributes all match the sale's. A variant sold
+// directly must not contradict the sale's attributes. Plain products are returned as they are.
+func (s *ProductService) ResolveVariantTx(tx *gorm.DB, companyID uint, productID uint, variantID *uint, attributes map[string]interface{}) (*Product, JSONB, error) {
+	var product Product
+	if err := tx.Where("company_id = ?", companyID).First(&product, "id = ?", productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrProductNotFound
+		}
+		return nil, nil, err
+	}
+
+	// Variants are picked among the product's own, or its siblings' when the product is a variant
+	parentID := product.ID
+	if product.ParentID != nil {
+		parentID = *product.ParentID
+	}
+
+	if variantID != nil {
+		var variant Product
+		if err := tx.Where("company_id = ? AND parent_id = ?", companyID, parentID).First(&variant, "id = ?", *variantID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, nil, ErrVariantNotFound
+			}
+			return nil, nil, err
+		}
+		if !attributesMatch(variant.Attributes, attributes) {
+			return nil, nil, ErrVariantNotFound
+		}
+		return &variant, mergeAttributes(attributes, variant.Attributes), nil
+	}
+
+	if product.ParentID != nil {
+		if !attributesMatch(product.Attributes, attributes) {
+			return nil, nil, ErrVariantNotFound
+		}
+		return &product, mergeAttributes(attributes, product.Attributes), nil
+	}
+
+	variants, err := s.variantsTx(tx, product.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(variants) == 0 {
+		return &product, JSONB(attributes), nil
+	}
+
+	var matches []*Product
+	for _, variant := range variants {
+		if attributesMatch(variant.Attributes, attributes) {
+			matches = append(matches, variant)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil, ErrVariantNotFound
+	case 1:
+		return matches[0], mergeAttributes(attributes, matches[0].Attributes), nil
+	default:
+		return nil, nil, ErrVariantRequired
+	}
+}
+
+// attributesMatch reports whether given does not contradict any of the variant's
+// attributes and names every one of them. Values are compared as text, ignoring case.
+func attributesMatch(variant JSONB, given map[string]interface{}) bool {
+	for key, value := range variant {
+		other, ok := lookupAttribute(given, key)
+		if !ok || !sameValue(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAttributes reports whether two attribute sets have the same keys and values
+func sameAttributes(a JSONB, b map[string]interface{}) bool {
+	return len(a) == len(b) && attributesMatch(a, b)
+}
+
+func lookupAttribute(attributes map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := attributes[key]; ok {
+		return value, true
+	}
+	for other, value := range attributes {
+		if strings.EqualFold(other, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func sameValue(a, b interface{}) bool {
+	return strings.EqualFold(strings.TrimSpace(fmt.Sprint(a)), strings.TrimSpace(fmt.Sprint(b)))
+}
+
+// mergeAttributes returns the sale's attributes with the variant's values taking precedence
+func mergeAttributes(given map[string]interface{}, variant JSONB) JSONB {
+	merged := make(JSONB, len(given)+len(variant))
+	for key, value := range given {
+		merged[key] = value
+	}
+	for key, value := range variant {
+		for other := range merged {
+			if other != key && strings.EqualFold(other, key) {
+				delete(merged, other)
+			}
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// variantName names a variant after its parent and attribute values, e.g. "Gas (12kg, Refill)"
+func variantName(parentName string, attributes map[string]interface{}) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = fmt.Sprint(attributes[key])
+	}
+	return fmt.Sprintf("%s (%s)", parentName, strings.Join(values, ", "))
+}
@@ -0,0 +1,40 @@
+package Query
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidIfMatch is returned for an If-Match header that is not an ETag issued by SetETag
+var ErrInvalidIfMatch = errors.New("If-Match must be the ETag of the record")
+
+// SetETag sets the ETag header to a record's version, for clients to send back as If-Match
+func SetETag(c *gin.Context, version uint) {
+	c.Header("ETag", strconv.Quote(strconv.FormatUint(uint64(version), 10)))
+}
+
+// IfMatchVersion returns the record version an update was made against, read from its
+// If-Match header. It returns nil when the header is missing or "*", and writes a 400
+// response and returns false when it is malformed.
+func IfMatchVersion(c *gin.Context) (*uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	tag, err := strconv.Unquote(strings.TrimPrefix(header, "W/"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidIfMatch.Error(), "code": "INVALID_IF_MATCH"})
+		return nil, false
+	}
+	version, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidIfMatch.Error(), "code": "INVALID_IF_MATCH"})
+		return nil, false
+	}
+	v := uint(version)
+	return &v, true
+}
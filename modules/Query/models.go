@@ -0,0 +1,65 @@
+package Query
+
+import "time"
+
+const (
+	// DefaultLimit is the page size when a list request does not ask for one
+	DefaultLimit = 50
+	// MaxLimit caps ?limit= so a single request cannot read a whole table
+	MaxLimit = 200
+)
+
+// FilterKind says how a filter's query value is parsed
+type FilterKind int
+
+const (
+	StringFilter FilterKind = iota
+	UintFilter
+	BoolFilter
+)
+
+// Filter is a query parameter matched for equality against a column.
+// A filter without a Column is parsed and validated but left to the handler to apply.
+type Filter struct {
+	Column string
+	Kind   FilterKind
+}
+
+// Spec describes what a list endpoint lets callers sort and filter by
+type Spec struct {
+	ID          string            // Primary key column, "id" by default. Ties in the sort order are broken on it.
+	Sorts       map[string]string // ?sort= name (e.g. "createdAt") to column
+	DefaultSort string            // e.g. "-createdAt"
+	Filters     map[string]Filter // Query parameter (e.g. "branchId") to filter
+	DateColumn  string            // Column ?from= and ?to= apply to, none when empty
+	Search      []string          // Columns ?q= matches, case-insensitively
+}
+
+// Sort is one column of the requested order
+type Sort struct {
+	Name   string
+	Column string
+	Desc   bool
+}
+
+// Params is a parsed list request: page, order and filters
+type Params struct {
+	Limit  int
+	Offset int
+	Cursor string // Opaque cursor from a previous page's nextCursor
+	Sorts  []Sort
+	From   *time.Time
+	To     *time.Time
+	Search string
+
+	spec   Spec
+	values map[string]any // Parsed filter values by query parameter
+}
+
+// Page describes the page returned next to a list
+type Page struct {
+	Total      int64  `json:"total"` // Rows matching the filters, across all pages
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"nextCursor,omitempty"` // Set when more rows follow
+}
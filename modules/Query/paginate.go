@@ -0,0 +1,170 @@
+package Query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// cursor is the position after the last row of a page, in the order it was sorted by
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// Scope applies the request's filters, date range and search to a query
+func (p *Params) Scope(db *gorm.DB) *gorm.DB {
+	for name, filter := range p.spec.Filters {
+		value, ok := p.values[name]
+		if !ok || filter.Column == "" {
+			continue
+		}
+		db = db.Where(filter.Column+" = ?", value)
+	}
+	if p.From != nil {
+		db = db.Where(p.spec.DateColumn+" >= ?", *p.From)
+	}
+	if p.To != nil {
+		db = db.Where(p.spec.DateColumn+" <= ?", *p.To)
+	}
+	if p.Search != "" && len(p.spec.Search) > 0 {
+		pattern := "%" + likeEscaper.Replace(p.Search) + "%"
+		conditions := make([]string, len(p.spec.Search))
+		args := make([]any, len(p.spec.Search))
+		for i, column := range p.spec.Search {
+			conditions[i] = column + " ILIKE ?"
+			args[i] = pattern
+		}
+		db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return db
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Paginate counts the rows of query matching params, then reads one page of them into dest,
+// a pointer to a slice of models. Preloads are only applied to the page read, not the count.
+func Paginate(query *gorm.DB, params *Params, dest any, preloads ...string) (*Page, error) {
+	query = query.Scopes(params.Scope).Session(&gorm.Session{})
+	page := &Page{Limit: params.Limit, Offset: params.Offset}
+	if err := query.Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	stmt := &gorm.Statement{DB: query, Context: query.Statement.Context}
+	if err := stmt.Parse(dest); err != nil {
+		return nil, err
+	}
+	idColumn := params.spec.ID
+	first := params.Sorts[0]
+
+	find := query
+	if params.Cursor != "" {
+		position, value, err := decodeCursor(stmt.Schema, params.Cursor, first)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if first.Desc {
+			op = "<"
+		}
+		if first.Column == idColumn {
+			find = find.Where(idColumn+" "+op+" ?", position.ID)
+		} else {
+			find = find.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", first.Column, op, first.Column, idColumn, op), value, value, position.ID)
+		}
+	} else if params.Offset > 0 {
+		find = find.Offset(params.Offset)
+	}
+	tieBroken := false
+	for _, sort := range params.Sorts {
+		find = find.Order(clause.OrderByColumn{Column: clause.Column{Name: sort.Column, Raw: true}, Desc: sort.Desc})
+		tieBroken = tieBroken || sort.Column == idColumn
+	}
+	if !tieBroken {
+		find = find.Order(clause.OrderByColumn{Column: clause.Column{Name: idColumn, Raw: true}, Desc: first.Desc})
+	}
+	for _, preload := range preloads {
+		find = find.Preload(preload)
+	}
+
+	// One extra row tells whether another page follows
+	if err := find.Limit(params.Limit + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > params.Limit {
+		rows.Set(rows.Slice(0, params.Limit))
+		if len(params.Sorts) == 1 {
+			next, err := encodeCursor(stmt, rows.Index(rows.Len()-1), first, idColumn)
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = next
+		}
+	}
+	return page, nil
+}
+
+func encodeCursor(stmt *gorm.Statement, row reflect.Value, sort Sort, idColumn string) (string, error) {
+	sortField := stmt.Schema.LookUpField(columnName(sort.Column))
+	idField := stmt.Schema.LookUpField(columnName(idColumn))
+	if sortField == nil || idField == nil {
+		// Sorted on a joined column; offset paging still works
+		return "", nil
+	}
+	row = reflect.Indirect(row)
+	value, _ := sortField.ValueOf(stmt.Context, row)
+	id, _ := idField.ValueOf(stmt.Context, row)
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	idValue, ok := id.(uint)
+	if !ok {
+		return "", nil
+	}
+	encoded, err := json.Marshal(cursor{Sort: sort.Name, Value: raw, ID: idValue})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// decodeCursor checks the cursor was issued for the same order and returns the sort value
+// typed like the model's field, so times are compared as times
+func decodeCursor(s *schema.Schema, raw string, sort Sort) (*cursor, any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Sort != sort.Name {
+		return nil, nil, ErrInvalidCursor
+	}
+	field := s.LookUpField(columnName(sort.Column))
+	if field == nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	value := reflect.New(field.FieldType)
+	if err := json.Unmarshal(position.Value, value.Interface()); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return &position, value.Elem().Interface(), nil
+}
+
+// columnName strips the table from a qualified column such as "sales.created_at"
+func columnName(column string) string {
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		return column[i+1:]
+	}
+	return column
+}
@@ -0,0 +1,204 @@
+package Query
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrInvalidLimit is returned for a limit that is not between 1 and MaxLimit
+	ErrInvalidLimit = fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	// ErrInvalidOffset is returned for a negative or non-numeric offset
+	ErrInvalidOffset = errors.New("offset must be a non-negative number")
+	// ErrInvalidCursor is returned for a cursor that was not issued for this list and order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorWithOffset is returned when a request asks for both a cursor and an offset
+	ErrCursorWithOffset = errors.New("cursor and offset cannot be combined")
+	// ErrInvalidSort is returned for an unknown sort field, or several sort fields with a cursor
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidFilter is returned for a filter value of the wrong type
+	ErrInvalidFilter = errors.New("invalid filter")
+	// ErrInvalidDate is returned for from and to values that are not RFC3339 or YYYY-MM-DD dates
+	ErrInvalidDate = errors.New("dates must be RFC3339 or YYYY-MM-DD")
+)
+
+// FromContext parses the list parameters of the request against spec.
+// It writes a 400 response and returns false when they are invalid.
+func FromContext(c *gin.Context, spec Spec) (*Params, bool) {
+	params, err := Parse(c.Request.URL.Query(), spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUERY"})
+		return nil, false
+	}
+	return params, true
+}
+
+// ErrorResponse writes a 400 for errors caused by the list parameters (such as a stale cursor)
+// and a 500 for anything else
+func ErrorResponse(c *gin.Context, err error) {
+	if IsInvalid(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUERY"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// IsInvalid reports whether err was caused by the list parameters
+func IsInvalid(err error) bool {
+	for _, invalid := range []error{ErrInvalidLimit, ErrInvalidOffset, ErrInvalidCursor, ErrCursorWithOffset, ErrInvalidSort, ErrInvalidFilter, ErrInvalidDate} {
+		if errors.Is(err, invalid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads limit, offset, cursor, sort, from, to, q and the spec's filters from query
+func Parse(query url.Values, spec Spec) (*Params, error) {
+	if spec.ID == "" {
+		spec.ID = "id"
+	}
+	params := &Params{
+		Limit:  DefaultLimit,
+		Cursor: query.Get("cursor"),
+		Search: strings.TrimSpace(query.Get("q")),
+		spec:   spec,
+		values: make(map[string]any),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return nil, ErrInvalidLimit
+		}
+		params.Limit = n
+	}
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidOffset
+		}
+		params.Offset = n
+	}
+	if params.Cursor != "" && params.Offset > 0 {
+		return nil, ErrCursorWithOffset
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	for _, name := range strings.Split(sort, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		column, ok := spec.Sorts[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidSort, name)
+		}
+		params.Sorts = append(params.Sorts, Sort{Name: name, Column: column, Desc: desc})
+	}
+	if len(params.Sorts) == 0 {
+		params.Sorts = []Sort{{Name: "id", Column: spec.ID, Desc: true}}
+	}
+	if params.Cursor != "" && len(params.Sorts) > 1 {
+		return nil, fmt.Errorf("%w: a cursor follows a single sort field", ErrInvalidSort)
+	}
+
+	for name, filter := range spec.Filters {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := parseFilter(filter.Kind, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, name)
+		}
+		params.values[name] = value
+	}
+
+	if spec.DateColumn != "" {
+		var err error
+		if params.From, err = parseDate(query.Get("from"), false); err != nil {
+			return nil, err
+		}
+		if params.To, err = parseDate(query.Get("to"), true); err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+func parseFilter(kind FilterKind, raw string) (any, error) {
+	switch kind {
+	case UintFilter:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return uint(n), nil
+	case BoolFilter:
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// parseDate accepts RFC3339 or a plain date. A plain date used as the end of a
+// range covers that whole day.
+func parseDate(raw string, endOfDay bool) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// Uint returns the value of a UintFilter, or nil when the request did not set it
+func (p *Params) Uint(name string) *uint {
+	if value, ok := p.values[name].(uint); ok {
+		return &value
+	}
+	return nil
+}
+
+// String returns the value of a StringFilter, or nil when the request did not set it
+func (p *Params) String(name string) *string {
+	if value, ok := p.values[name].(string); ok {
+		return &value
+	}
+	return nil
+}
+
+// Bool returns the value of a BoolFilter, or nil when the request did not set it
+func (p *Params) Bool(name string) *bool {
+	if value, ok := p.values[name].(bool); ok {
+		return &value
+	}
+	return nil
+}
+
+// Set overrides a filter value, e.g. to pin a branch-limited caller to their own branch
+func (p *Params) Set(name string, value any) {
+	p.values[name] = value
+}
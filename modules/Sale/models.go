@@ -5,14 +5,28 @@ import (
 	"encoding/json"
 	"time"
 
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 	"gorm.io/gorm"
 )
 
 type PaymentStatus string
 
 const (
-	Credit   PaymentStatus = "credit"
-	Promised PaymentStatus = "promised"
+	Credit        PaymentStatus = "credit"
+	Promised      PaymentStatus = "promised"
+	Paid          PaymentStatus = "paid"
+	PartiallyPaid PaymentStatus = "partially_paid"
+	Overdue       PaymentStatus = "overdue"
+)
+
+type PaymentMethod string
+
+const (
+	Cash        PaymentMethod = "cash"
+	MobileMoney PaymentMethod = "mobile_money"
+	Bank        PaymentMethod = "bank"
+	OtherMethod PaymentMethod = "other"
 )
 
 type SyncStatus string
@@ -51,21 +65,47 @@ func (j *JSONB) Scan(value interface{}) error {
 
 type Sale struct {
 	gorm.Model
+	OrderID           *uint          `json:"orderId,omitempty" gorm:"index"` // Set when the sale is a line of a multi-line order
 	ProductID         uint           `json:"productId" gorm:"not null;index"`
+	ParentProductID   *uint          `json:"parentProductId,omitempty" gorm:"index"` // Set when ProductID is a variant
 	ProductName       string         `json:"productName" gorm:"not null"`
 	ProductAttributes JSONB          `json:"productAttributes" gorm:"type:jsonb"`
 	Quantity          int            `json:"quantity" gorm:"not null"`
 	UnitPrice         float64        `json:"unitPrice" gorm:"not null"`
 	ExtraCosts        float64        `json:"extraCosts" gorm:"default:0"` // Additional costs like delivery charges
+	ListPrice         float64        `json:"listPrice" gorm:"default:0"`  // Product price at the time of sale
+	Discount          float64        `json:"discount" gorm:"default:0"`
 	TotalPrice        float64        `json:"totalPrice" gorm:"not null"`
 	Currency          string         `json:"currency" gorm:"not null"`
 	SellerID          uint           `json:"sellerId" gorm:"not null;index"`
 	PaymentStatus     PaymentStatus  `json:"paymentStatus" gorm:"not null"`
+	AmountPaid        float64        `json:"amountPaid" gorm:"default:0"` // Sum of recorded payments (kept on the order for order lines)
+	DueDate           *time.Time     `json:"dueDate,omitempty"`           // When an unpaid balance becomes overdue
+	Balance           float64        `json:"balance" gorm:"-"`            // Computed: TotalPrice - AmountPaid
+	// Cost of goods sold, snapshotted from the stock taken
+	UnitCost    float64 `json:"unitCost" gorm:"default:0"`
+	CostTotal   float64 `json:"costTotal" gorm:"default:0"`
+	GrossProfit float64 `json:"grossProfit" gorm:"-"` // Computed: TotalPrice - CostTotal
 	// Buyer information (optional)
+	CustomerID    *uint         `json:"customerId,omitempty" gorm:"index"` // Registered customer the sale is charged to
 	BuyerName     *string       `json:"buyerName,omitempty"`
 	BuyerContact  *string       `json:"buyerContact,omitempty"`
 	BuyerLocation *string       `json:"buyerLocation,omitempty"`
 	SyncStatus    *SyncStatus   `json:"syncStatus,omitempty"`
+	// Price override audit (set when the unit price, discount or total differs from the derived price)
+	PriceOverridden     bool    `json:"priceOverridden" gorm:"default:false"`
+	PriceOverrideReason *string `json:"priceOverrideReason,omitempty"`
+	PriceApprovedByID   *uint   `json:"priceApprovedById,omitempty"`
+	// Version counts edits of the sale; updates made against an older version are rejected
+	Version uint `json:"version" gorm:"not null;default:1"`
+	// Voids and returns (see SaleReturn). Quantity, TotalPrice and CostTotal are what is
+	// still sold; these add up what was taken back.
+	ReturnedQuantity int        `json:"returnedQuantity" gorm:"default:0"`
+	ReturnedAmount   float64    `json:"returnedAmount" gorm:"default:0"`
+	ReturnedCost     float64    `json:"returnedCost" gorm:"default:0"`
+	VoidedAt         *time.Time `json:"voidedAt,omitempty"`
+	// Receipt number issued by the selling branch (see ReceiptSequence); order lines use the order's
+	ReceiptNumber *string `json:"receiptNumber,omitempty" gorm:"index"`
 
 	// Relationships (for JSON response - computed from FKs)
 	Product *ProductResponse `json:"product,omitempty" gorm:"-"`
@@ -73,6 +113,113 @@ type Sale struct {
 	Branch  *BranchResponse  `json:"branch,omitempty" gorm:"-"` // Computed from Seller's BranchID
 }
 
+// Order is a receipt grouping several products sold to one buyer in one transaction.
+// Each line is stored as a Sale row with OrderID set, so per-item reads keep working.
+type Order struct {
+	gorm.Model
+	SellerID      uint          `json:"sellerId" gorm:"not null;index"`
+	Currency      string        `json:"currency" gorm:"not null"`
+	Subtotal      float64       `json:"subtotal" gorm:"not null"`    // Sum of the line totals
+	ExtraCosts    float64       `json:"extraCosts" gorm:"default:0"` // Order-level costs like delivery charges
+	Discount      float64       `json:"discount" gorm:"default:0"`   // Order-level discount
+	TotalPrice    float64       `json:"totalPrice" gorm:"not null"`
+	PaymentStatus PaymentStatus `json:"paymentStatus" gorm:"not null"`
+	AmountPaid    float64       `json:"amountPaid" gorm:"default:0"`
+	DueDate       *time.Time    `json:"dueDate,omitempty"`
+	Balance       float64       `json:"balance" gorm:"-"` // Computed: TotalPrice - AmountPaid
+	CostTotal     float64       `json:"costTotal" gorm:"default:0"` // Sum of the lines' cost of goods sold
+	GrossProfit   float64       `json:"grossProfit" gorm:"-"`       // Computed: TotalPrice - CostTotal
+	// Buyer information (optional)
+	CustomerID    *uint       `json:"customerId,omitempty" gorm:"index"`
+	BuyerName     *string     `json:"buyerName,omitempty"`
+	BuyerContact  *string     `json:"buyerContact,omitempty"`
+	BuyerLocation *string     `json:"buyerLocation,omitempty"`
+	SyncStatus    *SyncStatus `json:"syncStatus,omitempty"`
+	// Discount override audit
+	PriceOverridden     bool    `json:"priceOverridden" gorm:"default:false"`
+	PriceOverrideReason *string `json:"priceOverrideReason,omitempty"`
+	PriceApprovedByID   *uint   `json:"priceApprovedById,omitempty"`
+	// Receipt number issued by the selling branch (see ReceiptSequence)
+	ReceiptNumber *string `json:"receiptNumber,omitempty" gorm:"index"`
+
+	Items []*Sale `json:"items" gorm:"foreignKey:OrderID"`
+
+	// Relationships (for JSON response - computed from FKs)
+	Seller *UserResponse   `json:"seller,omitempty" gorm:"-"`
+	Branch *BranchResponse `json:"branch,omitempty" gorm:"-"`
+}
+
+// Payment is money received against a standalone sale or an order
+type Payment struct {
+	gorm.Model
+	SaleID       *uint         `json:"saleId,omitempty" gorm:"index"`  // Set for standalone sales
+	OrderID      *uint         `json:"orderId,omitempty" gorm:"index"` // Set for multi-line orders
+	Amount       float64       `json:"amount" gorm:"not null"`
+	Currency     string        `json:"currency" gorm:"not null"`
+	Method       PaymentMethod `json:"method" gorm:"not null"`
+	Reference    *string       `json:"reference,omitempty"` // e.g. mobile money transaction ID
+	Notes        *string       `json:"notes,omitempty"`
+	PaidAt       time.Time     `json:"paidAt" gorm:"not null"`
+	ReceivedByID uint          `json:"receivedById" gorm:"not null;index"`
+
+	// Relationships (for JSON response - computed from FKs)
+	ReceivedBy *UserResponse `json:"receivedBy,omitempty" gorm:"-"`
+}
+
+// ReturnKind tells a same-day void from a later return of goods
+type ReturnKind string
+
+const (
+	KindVoid   ReturnKind = "void"
+	KindReturn ReturnKind = "return"
+)
+
+// SaleReturn reverses all or part of a sale. The stock goes back to the seller's branch
+// at the cost it was sold at, the sale's total is reduced by the value returned, and
+// whatever the buyer had paid beyond the new total is refunded.
+type SaleReturn struct {
+	gorm.Model
+	SaleID        uint       `json:"saleId" gorm:"not null;index"`
+	OrderID       *uint      `json:"orderId,omitempty" gorm:"index"`
+	Kind          ReturnKind `json:"kind" gorm:"not null"`
+	ProductID     uint       `json:"productId" gorm:"not null;index"`
+	ProductName   string     `json:"productName" gorm:"not null"`
+	Quantity      int        `json:"quantity" gorm:"not null"`
+	Amount        float64    `json:"amount" gorm:"not null"`    // Sale value taken back
+	CostTotal     float64    `json:"costTotal" gorm:"not null"` // Cost of the stock put back
+	RefundAmount  float64    `json:"refundAmount" gorm:"default:0"`
+	RefundID      *uint      `json:"refundId,omitempty"` // Negative payment recording the refund
+	Currency      string     `json:"currency" gorm:"not null"`
+	Reason        string     `json:"reason" gorm:"not null"`
+	ProcessedByID uint       `json:"processedById" gorm:"not null"`
+	ApprovedByID  *uint      `json:"approvedById,omitempty"` // Set on voids
+
+	// Relationships (for JSON response - computed from FKs)
+	ProcessedBy *UserResponse `json:"processedBy,omitempty" gorm:"-"`
+}
+
+// ReceiptSequence hands out a branch's receipt numbers in order, one per standalone
+// sale or order
+type ReceiptSequence struct {
+	BranchID   uint `gorm:"primaryKey;autoIncrement:false"`
+	LastNumber uint `gorm:"not null;default:0"`
+	UpdatedAt  time.Time
+}
+
+// VoidSaleRequest cancels a sale on the day it was made
+type VoidSaleRequest struct {
+	Reason       string         `json:"reason" binding:"required"`
+	RefundMethod *PaymentMethod `json:"refundMethod,omitempty"` // How payments are given back (default cash)
+	ApprovedByID *uint          `json:"approvedById,omitempty"` // User who approved the void and holds sales:void (default the caller)
+}
+
+// ReturnSaleRequest takes back some or all of a sale's goods
+type ReturnSaleRequest struct {
+	Quantity     int            `json:"quantity" binding:"required"`
+	Reason       string         `json:"reason" binding:"required"`
+	RefundMethod *PaymentMethod `json:"refundMethod,omitempty"` // How the refund is paid (default cash)
+}
+
 // ProductResponse is used for JSON serialization
 type ProductResponse struct {
 	ID   uint   `json:"id"`
@@ -91,38 +238,131 @@ type BranchResponse struct {
 	Name string `json:"name"`
 }
 
+// CreateSaleRequest records a sale. Product name, currency, unit price and total are
+// derived from the product on the server; UnitPrice, Discount and TotalPrice are only
+// honoured as overrides when the caller is allowed to override prices.
 type CreateSaleRequest struct {
 	ProductID         uint                   `json:"productId" binding:"required"`
-	ProductName        string                 `json:"productName" binding:"required"`
-	ProductAttributes  map[string]interface{} `json:"productAttributes"`
-	Quantity           int                    `json:"quantity" binding:"required"`
-	UnitPrice          float64                `json:"unitPrice" binding:"required"`
-	ExtraCosts         float64                `json:"extraCosts"` // Optional additional costs like delivery charges
-	TotalPrice         float64                `json:"totalPrice" binding:"required"`
-	Currency           string                 `json:"currency" binding:"required"`
-	SellerID           uint                   `json:"sellerId"` // Optional - will be set from token context
-	PaymentStatus      PaymentStatus          `json:"paymentStatus" binding:"required"`
-	// Buyer information (optional)
+	VariantID         *uint                  `json:"variantId,omitempty"` // Required for products with variants unless productAttributes pick one
+	ProductName       string                 `json:"productName"` // Ignored - taken from the product
+	ProductAttributes map[string]interface{} `json:"productAttributes"`
+	Quantity          int                    `json:"quantity" binding:"required"`
+	UnitPrice         *float64               `json:"unitPrice,omitempty"`
+	ExtraCosts        float64                `json:"extraCosts"` // Optional additional costs like delivery charges
+	Discount          *float64               `json:"discount,omitempty"`
+	TotalPrice        *float64               `json:"totalPrice,omitempty"`
+	OverrideReason    *string                `json:"overrideReason,omitempty"` // Required when overriding the price
+	Currency          string                 `json:"currency"`                 // Ignored - taken from the product
+	SellerID          uint                   `json:"sellerId"`                 // Optional - will be set from token context
+	PaymentStatus     PaymentStatus          `json:"paymentStatus" binding:"required"`
+	AmountPaid        *float64               `json:"amountPaid,omitempty"`    // Paid up front; defaults to the total when paymentStatus is "paid"
+	PaymentMethod     *PaymentMethod         `json:"paymentMethod,omitempty"` // Method of the up-front payment (default cash)
+	DueDate           *time.Time             `json:"dueDate,omitempty"`
+	// Buyer information (optional). Without a customerId the buyer is matched to a
+	// registered customer by contact, and registered if the contact is new.
+	CustomerID    *uint   `json:"customerId,omitempty"`
+	BuyerName     *string `json:"buyerName,omitempty"`
+	BuyerContact  *string `json:"buyerContact,omitempty"`
+	BuyerLocation *string `json:"buyerLocation,omitempty"`
+}
+
+// CreateOrderRequest records a multi-line sale. It is accepted by POST /sales when the body has "items".
+type CreateOrderRequest struct {
+	Items          []CreateOrderItemRequest `json:"items" binding:"required,min=1,dive"`
+	ExtraCosts     float64                  `json:"extraCosts"` // Order-level costs like delivery charges
+	Discount       *float64                 `json:"discount,omitempty"`
+	OverrideReason *string                  `json:"overrideReason,omitempty"` // Required when overriding any price
+	SellerID       uint                     `json:"sellerId"`                 // Optional - will be set from token context
+	PaymentStatus  PaymentStatus            `json:"paymentStatus" binding:"required"`
+	AmountPaid     *float64                 `json:"amountPaid,omitempty"`    // Paid up front; defaults to the total when paymentStatus is "paid"
+	PaymentMethod  *PaymentMethod           `json:"paymentMethod,omitempty"` // Method of the up-front payment (default cash)
+	DueDate        *time.Time               `json:"dueDate,omitempty"`
+	// Buyer information (optional). Without a customerId the buyer is matched to a
+	// registered customer by contact, and registered if the contact is new.
+	CustomerID    *uint   `json:"customerId,omitempty"`
 	BuyerName     *string `json:"buyerName,omitempty"`
 	BuyerContact  *string `json:"buyerContact,omitempty"`
 	BuyerLocation *string `json:"buyerLocation,omitempty"`
 }
 
+// CreateOrderItemRequest is one line of a CreateOrderRequest
+type CreateOrderItemRequest struct {
+	ProductID         uint                   `json:"productId" binding:"required"`
+	VariantID         *uint                  `json:"variantId,omitempty"`
+	ProductAttributes map[string]interface{} `json:"productAttributes"`
+	Quantity          int                    `json:"quantity" binding:"required"`
+	UnitPrice         *float64               `json:"unitPrice,omitempty"`
+	Discount          *float64               `json:"discount,omitempty"`
+	TotalPrice        *float64               `json:"totalPrice,omitempty"`
+}
+
 type UpdateSaleRequest struct {
 	ProductID         *uint                  `json:"productId,omitempty"`
-	ProductName       *string                `json:"productName,omitempty"`
+	VariantID         *uint                  `json:"variantId,omitempty"`
+	ProductName       *string                `json:"productName,omitempty"` // Ignored - taken from the product
 	ProductAttributes map[string]interface{} `json:"productAttributes,omitempty"`
 	Quantity          *int                   `json:"quantity,omitempty"`
 	UnitPrice         *float64               `json:"unitPrice,omitempty"`
 	ExtraCosts        *float64               `json:"extraCosts,omitempty"` // Optional additional costs like delivery charges
+	Discount          *float64               `json:"discount,omitempty"`
 	TotalPrice        *float64               `json:"totalPrice,omitempty"`
-	Currency          *string                `json:"currency,omitempty"`
+	OverrideReason    *string                `json:"overrideReason,omitempty"` // Required when overriding the price
+	Currency          *string                `json:"currency,omitempty"` // Ignored - taken from the product
 	SellerID          *uint                  `json:"sellerId,omitempty"`
-	PaymentStatus     *PaymentStatus         `json:"paymentStatus,omitempty"`
+	PaymentStatus     *PaymentStatus         `json:"paymentStatus,omitempty"` // Only "credit" or "promised" - record payments instead
+	DueDate           *time.Time             `json:"dueDate,omitempty"`
 	// Buyer information (optional)
+	CustomerID    *uint   `json:"customerId,omitempty"`
 	BuyerName     *string `json:"buyerName,omitempty"`
 	BuyerContact  *string `json:"buyerContact,omitempty"`
 	BuyerLocation *string `json:"buyerLocation,omitempty"`
+	// Version the edit was made against (or the If-Match header); a stale version is a conflict
+	Version *uint `json:"version,omitempty"`
+}
+
+// CreatePaymentRequest records a payment against a sale or order
+type CreatePaymentRequest struct {
+	Amount    float64       `json:"amount" binding:"required"`
+	Method    PaymentMethod `json:"method" binding:"required"`
+	Reference *string       `json:"reference,omitempty"`
+	Notes     *string       `json:"notes,omitempty"`
+	PaidAt    *time.Time    `json:"paidAt,omitempty"` // Defaults to now; set by offline clients
+}
+
+// PaymentResult is returned after recording a payment, with the updated balance
+type PaymentResult struct {
+	Payment       *Payment      `json:"payment"`
+	AmountPaid    float64       `json:"amountPaid"`
+	Balance       float64       `json:"balance"`
+	PaymentStatus PaymentStatus `json:"paymentStatus"`
+}
+
+// SaleActor identifies the authenticated user a sale operation is performed for
+type SaleActor struct {
+	UserID    uint
+	CompanyID uint
+	BranchID  *uint
+	Role      User.UserRole
+}
+
+// stockChange attributes a stock movement caused by a sale to the actor, taking the
+// stock of branchID (the seller's branch)
+func (a SaleActor) stockChange(reason Product.MovementReason, saleID *uint, branchID *uint) Product.StockChange {
+	userID := a.UserID
+	return Product.StockChange{
+		Reason:      reason,
+		ReferenceID: saleID,
+		UserID:      &userID,
+		BranchID:    branchID,
+	}
+}
+
+// returnChange puts stock of sale back into branchID at the cost it was sold at
+func (a SaleActor) returnChange(sale *Sale, branchID *uint) Product.StockChange {
+	change := a.stockChange(Product.MovementAdjustment, &sale.ID, branchID)
+	unitCost := sale.UnitCost
+	change.UnitCost = &unitCost
+	return change
 }
 
 type SaleFilter struct {
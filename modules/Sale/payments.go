@@ -0,0 +1,307 @@
+package Sale
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidPaymentAmount is returned for zero or negative payments
+	ErrInvalidPaymentAmount = errors.New("payment amount must be greater than zero")
+	// ErrOverpayment is returned when a payment exceeds the outstanding balance
+	ErrOverpayment = errors.New("payment exceeds the outstanding balance")
+	// ErrInvalidPaymentMethod is returned for unknown payment methods
+	ErrInvalidPaymentMethod = errors.New("payment method must be one of cash, mobile_money, bank, other")
+	// ErrTotalBelowPaid is returned when an edit would make a sale's total less than what was already paid
+	ErrTotalBelowPaid = errors.New("sale total cannot be less than the amount already paid")
+	// ErrInvalidPaymentStatus is returned when a sale is opened or edited with a status the server derives itself
+	ErrInvalidPaymentStatus = errors.New("payment status must be credit, promised, paid or partially_paid; record payments to change it")
+)
+
+func validPaymentMethod(method PaymentMethod) bool {
+	switch method {
+	case Cash, MobileMoney, Bank, OtherMethod:
+		return true
+	}
+	return false
+}
+
+// derivePaymentStatus returns the status implied by the amount paid against total.
+// current is the stored status; an unpaid balance keeps "promised" if that is what the
+// buyer agreed to and otherwise counts as credit.
+func derivePaymentStatus(total, paid float64, dueDate *time.Time, current PaymentStatus, now time.Time) PaymentStatus {
+	balance := total - paid
+	if balance <= priceTolerance {
+		return Paid
+	}
+	if dueDate != nil && now.After(*dueDate) {
+		return Overdue
+	}
+	if paid > priceTolerance {
+		return PartiallyPaid
+	}
+	if current == Promised {
+		return Promised
+	}
+	return Credit
+}
+
+// openingPayment validates the payment fields of a create request and returns the
+// amount paid up front. A "paid" sale without an explicit amount is paid in full.
+func openingPayment(status PaymentStatus, amountPaid *float64, method *PaymentMethod, total float64) (float64, error) {
+	switch status {
+	case Credit, Promised, Paid, PartiallyPaid:
+	default:
+		return 0, ErrInvalidPaymentStatus
+	}
+	if method != nil && !validPaymentMethod(*method) {
+		return 0, ErrInvalidPaymentMethod
+	}
+
+	amount := 0.0
+	if amountPaid != nil {
+		amount = *amountPaid
+	} else if status == Paid {
+		amount = total
+	}
+	if amount < 0 {
+		return 0, ErrInvalidPaymentAmount
+	}
+	if amount-total > priceTolerance {
+		return 0, ErrOverpayment
+	}
+	return amount, nil
+}
+
+// newPayment builds a payment row from a request; the caller sets SaleID or OrderID
+func newPayment(req CreatePaymentRequest, currency string, actor SaleActor) (*Payment, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidPaymentAmount
+	}
+	if !validPaymentMethod(req.Method) {
+		return nil, ErrInvalidPaymentMethod
+	}
+
+	paidAt := time.Now()
+	if req.PaidAt != nil && req.PaidAt.Before(paidAt) {
+		paidAt = *req.PaidAt
+	}
+
+	return &Payment{
+		Amount:       req.Amount,
+		Currency:     currency,
+		Method:       req.Method,
+		Reference:    req.Reference,
+		Notes:        req.Notes,
+		PaidAt:       paidAt,
+		ReceivedByID: actor.UserID,
+	}, nil
+}
+
+// openingPaymentRow builds the payment recorded when a sale or order is paid at checkout
+func openingPaymentRow(amount float64, method *PaymentMethod, currency string, saleID, orderID *uint, actor SaleActor) *Payment {
+	paymentMethod := Cash
+	if method != nil {
+		paymentMethod = *method
+	}
+	return &Payment{
+		SaleID:       saleID,
+		OrderID:      orderID,
+		Amount:       amount,
+		Currency:     currency,
+		Method:       paymentMethod,
+		PaidAt:       time.Now(),
+		ReceivedByID: actor.UserID,
+	}
+}
+
+// RecordPayment records a payment against a sale and re-derives its payment status.
+// Payments against a line of a multi-line order are recorded against the whole order.
+func (s *SaleService) RecordPayment(saleID uint, req CreatePaymentRequest, actor SaleActor) (*PaymentResult, error) {
+	var result *PaymentResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var sale Sale
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(companySales(actor.CompanyID)).First(&sale, "id = ?", saleID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrSaleNotFound
+			}
+			return err
+		}
+		if sale.OrderID != nil {
+			var err error
+			result, err = s.recordOrderPaymentTx(tx, *sale.OrderID, req, actor)
+			return err
+		}
+
+		payment, err := newPayment(req, sale.Currency, actor)
+		if err != nil {
+			return err
+		}
+		if payment.Amount-(sale.TotalPrice-sale.AmountPaid) > priceTolerance {
+			return ErrOverpayment
+		}
+
+		payment.SaleID = &sale.ID
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+
+		sale.AmountPaid += payment.Amount
+		sale.PaymentStatus = derivePaymentStatus(sale.TotalPrice, sale.AmountPaid, sale.DueDate, sale.PaymentStatus, time.Now())
+		if err := tx.Model(&sale).Updates(map[string]interface{}{
+			"amount_paid":    sale.AmountPaid,
+			"payment_status": sale.PaymentStatus,
+		}).Error; err != nil {
+			return err
+		}
+
+		result = &PaymentResult{
+			Payment:       payment,
+			AmountPaid:    sale.AmountPaid,
+			Balance:       sale.TotalPrice - sale.AmountPaid,
+			PaymentStatus: sale.PaymentStatus,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.populatePaymentReceivers(result.Payment)
+	return result, nil
+}
+
+// RecordOrderPayment records a payment against an order and mirrors the new status onto its lines
+func (s *SaleService) RecordOrderPayment(orderID uint, req CreatePaymentRequest, actor SaleActor) (*PaymentResult, error) {
+	var result *PaymentResult
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = s.recordOrderPaymentTx(tx, orderID, req, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.populatePaymentReceivers(result.Payment)
+	return result, nil
+}
+
+func (s *SaleService) recordOrderPaymentTx(tx *gorm.DB, orderID uint, req CreatePaymentRequest, actor SaleActor) (*PaymentResult, error) {
+	var order Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(companyOrders(actor.CompanyID)).First(&order, "id = ?", orderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	payment, err := newPayment(req, order.Currency, actor)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Amount-(order.TotalPrice-order.AmountPaid) > priceTolerance {
+		return nil, ErrOverpayment
+	}
+
+	payment.OrderID = &order.ID
+	if err := tx.Create(payment).Error; err != nil {
+		return nil, err
+	}
+
+	order.AmountPaid += payment.Amount
+	order.PaymentStatus = derivePaymentStatus(order.TotalPrice, order.AmountPaid, order.DueDate, order.PaymentStatus, time.Now())
+	if err := tx.Model(&order).Updates(map[string]interface{}{
+		"amount_paid":    order.AmountPaid,
+		"payment_status": order.PaymentStatus,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&Sale{}).Where("order_id = ?", order.ID).Update("payment_status", order.PaymentStatus).Error; err != nil {
+		return nil, err
+	}
+
+	return &PaymentResult{
+		Payment:       payment,
+		AmountPaid:    order.AmountPaid,
+		Balance:       order.TotalPrice - order.AmountPaid,
+		PaymentStatus: order.PaymentStatus,
+	}, nil
+}
+
+// GetPaymentsBySale lists the payments of a sale, or of its order when the sale is an order line
+func (s *SaleService) GetPaymentsBySale(saleID uint, companyID uint) ([]*Payment, error) {
+	var sale Sale
+	if err := s.db.Scopes(companySales(companyID)).First(&sale, "id = ?", saleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSaleNotFound
+		}
+		return nil, err
+	}
+	if sale.OrderID != nil {
+		return s.GetPaymentsByOrder(*sale.OrderID, companyID)
+	}
+
+	var payments []*Payment
+	if err := s.db.Where("sale_id = ?", saleID).Order("paid_at ASC").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	s.populatePaymentReceivers(payments...)
+	return payments, nil
+}
+
+// GetPaymentsByOrder lists the payments of an order
+func (s *SaleService) GetPaymentsByOrder(orderID uint, companyID uint) ([]*Payment, error) {
+	var order Order
+	if err := s.db.Scopes(companyOrders(companyID)).First(&order, "id = ?", orderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	var payments []*Payment
+	if err := s.db.Where("order_id = ?", orderID).Order("paid_at ASC").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	s.populatePaymentReceivers(payments...)
+	return payments, nil
+}
+
+// populatePaymentReceivers populates the receiving users from their ReceivedByID FKs with one query
+func (s *SaleService) populatePaymentReceivers(payments ...*Payment) {
+	ids := make([]uint, 0, len(payments))
+	for _, payment := range payments {
+		ids = append(ids, payment.ReceivedByID)
+	}
+	receivers := s.loadSellers(ids)
+	for _, payment := range payments {
+		if user, ok := receivers[payment.ReceivedByID]; ok {
+			payment.ReceivedBy = &UserResponse{ID: user.ID, Name: user.Name}
+		}
+	}
+}
+
+// populateBalance computes the outstanding balance and flags overdue sales on read.
+// Order lines carry their order's status; their balance is tracked on the order.
+func populateBalance(sale *Sale, now time.Time) {
+	sale.GrossProfit = sale.TotalPrice - sale.CostTotal
+	if sale.OrderID != nil {
+		return
+	}
+	sale.Balance = sale.TotalPrice - sale.AmountPaid
+	sale.PaymentStatus = derivePaymentStatus(sale.TotalPrice, sale.AmountPaid, sale.DueDate, sale.PaymentStatus, now)
+}
+
+func populateOrderBalance(order *Order, now time.Time) {
+	order.Balance = order.TotalPrice - order.AmountPaid
+	order.GrossProfit = order.TotalPrice - order.CostTotal
+	order.PaymentStatus = derivePaymentStatus(order.TotalPrice, order.AmountPaid, order.DueDate, order.PaymentStatus, now)
+	for _, item := range order.Items {
+		item.PaymentStatus = order.PaymentStatus
+		item.GrossProfit = item.TotalPrice - item.CostTotal
+	}
+}
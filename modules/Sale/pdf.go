@@ -0,0 +1,59 @@
+package Sale
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pointsPerMM converts paper sizes to PDF points
+const pointsPerMM = 72 / 25.4
+
+// courierAdvance is the width of every Courier glyph as a fraction of the font size
+const courierAdvance = 0.6
+
+// renderTextPDF lays lines out in Courier on a single page widthMM wide, sized so that
+// columns characters fill a line and tall enough for every line, like a till roll.
+// Courier is one of the standard PDF fonts, so nothing has to be embedded.
+func renderTextPDF(lines []string, widthMM float64, columns int) []byte {
+	const margin = 8.0
+	width := widthMM * pointsPerMM
+	fontSize := (width - 2*margin) / (float64(columns) * courierAdvance)
+	leading := fontSize * 1.2
+	height := 2*margin + leading*float64(len(lines))
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT\n/F1 %.2f Tf\n%.2f TL\n%.2f %.2f Td\n", fontSize, leading, margin, height-margin)
+	for _, line := range lines {
+		fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", width, height),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape escapes the characters that end or escape a PDF string literal
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
@@ -0,0 +1,156 @@
+package Sale
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+var (
+	// ErrPriceOverrideNotAllowed is returned when a caller without override rights changes the derived price
+	ErrPriceOverrideNotAllowed = errors.New("you are not allowed to override sale prices")
+	// ErrOverrideReasonRequired is returned when a price override is made without a reason
+	ErrOverrideReasonRequired = errors.New("a reason is required when overriding the sale price")
+	// ErrInvalidDiscount is returned for negative discounts
+	ErrInvalidDiscount = errors.New("discount cannot be negative")
+	// ErrInvalidExtraCosts is returned for negative extra costs, which would lower the total without an override
+	ErrInvalidExtraCosts = errors.New("extra costs cannot be negative")
+)
+
+// priceTolerance absorbs floating point noise when comparing client prices with derived ones
+const priceTolerance = 0.005
+
+// priceInput holds the client-supplied pricing fields of a create or update request
+type priceInput struct {
+	UnitPrice      *float64
+	Discount       *float64
+	TotalPrice     *float64
+	OverrideReason *string
+	// KeepTotal is set on updates of a sale whose price was overridden, when the edit leaves
+	// its product, quantity, unit price, extra costs and discount as they were
+	KeepTotal bool
+}
+
+// canOverridePrice reports whether a role may sell below or above the derived price
+func canOverridePrice(role User.UserRole) bool {
+	return User.HasPermission(role, User.PermSalesOverridePrice)
+}
+
+func pricesDiffer(a, b float64) bool {
+	return math.Abs(a-b) > priceTolerance
+}
+
+// applyPricing computes the sale's total as Quantity*UnitPrice+ExtraCosts-Discount.
+// sale.ListPrice and sale.UnitPrice must already hold the list price and current unit price.
+// Any client value that differs from the derived one is an override: it must be permitted
+// for the actor's role and carry a reason, and the actor is recorded as the approver.
+// With in.KeepTotal, a stored total the request does not change is kept with its approval.
+func applyPricing(sale *Sale, in priceInput, actor SaleActor) error {
+	if sale.ExtraCosts < 0 {
+		return ErrInvalidExtraCosts
+	}
+	storedTotal := sale.TotalPrice
+	changed := false
+
+	if in.UnitPrice != nil && pricesDiffer(*in.UnitPrice, sale.UnitPrice) {
+		sale.UnitPrice = *in.UnitPrice
+		changed = true
+	}
+	if in.Discount != nil {
+		if *in.Discount < 0 {
+			return ErrInvalidDiscount
+		}
+		if pricesDiffer(*in.Discount, sale.Discount) {
+			sale.Discount = *in.Discount
+			changed = true
+		}
+	}
+
+	if in.KeepTotal && !changed && (in.TotalPrice == nil || !pricesDiffer(*in.TotalPrice, storedTotal)) {
+		// The approved total was not priced from anything this request changed
+		return nil
+	}
+
+	sale.TotalPrice = sale.UnitPrice*float64(sale.Quantity) + sale.ExtraCosts - sale.Discount
+	totalOverridden := false
+	if in.TotalPrice != nil && pricesDiffer(*in.TotalPrice, sale.TotalPrice) {
+		sale.TotalPrice = *in.TotalPrice
+		totalOverridden = true
+		changed = true
+	}
+
+	overridden := totalOverridden || pricesDiffer(sale.UnitPrice, sale.ListPrice) || sale.Discount > 0
+	if !overridden {
+		sale.PriceOverridden = false
+		sale.PriceOverrideReason = nil
+		sale.PriceApprovedByID = nil
+		return nil
+	}
+	if !changed {
+		// Keep the existing approval for an override that was not touched by this request
+		return nil
+	}
+
+	if !canOverridePrice(actor.Role) {
+		return ErrPriceOverrideNotAllowed
+	}
+	if in.OverrideReason == nil || strings.TrimSpace(*in.OverrideReason) == "" {
+		return ErrOverrideReasonRequired
+	}
+
+	reason := strings.TrimSpace(*in.OverrideReason)
+	approverID := actor.UserID
+	sale.PriceOverridden = true
+	sale.PriceOverrideReason = &reason
+	sale.PriceApprovedByID = &approverID
+	return nil
+}
+
+// applyOrderPricing totals an order from its already priced lines and applies the
+// order-level extra costs and discount. A discount is an override and follows the
+// same permission and reason rules as applyPricing.
+func applyOrderPricing(order *Order, discount *float64, reason *string, actor SaleActor) error {
+	if order.ExtraCosts < 0 {
+		return ErrInvalidExtraCosts
+	}
+	order.Subtotal = 0
+	for _, item := range order.Items {
+		order.Subtotal += item.TotalPrice
+	}
+
+	changed := false
+	if discount != nil {
+		if *discount < 0 {
+			return ErrInvalidDiscount
+		}
+		changed = pricesDiffer(*discount, order.Discount)
+		order.Discount = *discount
+	}
+	order.TotalPrice = order.Subtotal + order.ExtraCosts - order.Discount
+
+	if order.Discount <= 0 {
+		order.PriceOverridden = false
+		order.PriceOverrideReason = nil
+		order.PriceApprovedByID = nil
+		return nil
+	}
+	if !changed {
+		return nil
+	}
+
+	if !canOverridePrice(actor.Role) {
+		return ErrPriceOverrideNotAllowed
+	}
+	if reason == nil || strings.TrimSpace(*reason) == "" {
+		return ErrOverrideReasonRequired
+	}
+
+	trimmed := strings.TrimSpace(*reason)
+	approverID := actor.UserID
+	order.PriceOverridden = true
+	order.PriceOverrideReason = &trimmed
+	order.PriceApprovedByID = &approverID
+	return nil
+}
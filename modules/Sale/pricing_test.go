@@ -0,0 +1,57 @@
+package Sale
+
+import (
+	"errors"
+	"testing"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+)
+
+// Editing an unrelated field of a sale whose total was overridden keeps the approved
+// total, its approval and the payment made against it
+func TestUpdateKeepsOverriddenTotal(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	product := newStockedProduct(t, db, a.Branch, 5)
+	actor := actorFor(a.Owner, a.Company.ID)
+
+	total, reason := 15.0, "Bulk deal"
+	sale, err := GetSaleService().CreateSale(CreateSaleRequest{
+		ProductID:      product.ID,
+		Quantity:       2,
+		TotalPrice:     &total,
+		OverrideReason: &reason,
+		PaymentStatus:  Paid,
+		SellerID:       a.Owner.ID,
+	}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sale.PriceOverridden || sale.TotalPrice != total || sale.AmountPaid != total {
+		t.Fatalf("created sale: overridden %v, total %v, paid %v", sale.PriceOverridden, sale.TotalPrice, sale.AmountPaid)
+	}
+
+	buyer := "Jane"
+	updated, err := GetSaleService().UpdateSale(sale.ID, UpdateSaleRequest{BuyerName: &buyer}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.TotalPrice != total {
+		t.Errorf("total = %v, want the approved %v", updated.TotalPrice, total)
+	}
+	if !updated.PriceOverridden || updated.PriceOverrideReason == nil || *updated.PriceOverrideReason != reason {
+		t.Errorf("override = %v %v, want it kept with reason %q", updated.PriceOverridden, updated.PriceOverrideReason, reason)
+	}
+	if approver := updated.PriceApprovedByID; approver == nil || *approver != a.Owner.ID {
+		t.Errorf("approvedById = %v, want %d", approver, a.Owner.ID)
+	}
+	if updated.PaymentStatus != Paid {
+		t.Errorf("payment status = %s, want %s", updated.PaymentStatus, Paid)
+	}
+
+	// Changing the quantity prices the sale again
+	quantity := 1
+	if _, err := GetSaleService().UpdateSale(sale.ID, UpdateSaleRequest{Quantity: &quantity}, actor); !errors.Is(err, ErrTotalBelowPaid) {
+		t.Errorf("quantity edit: got %v, want ErrTotalBelowPaid", err)
+	}
+}
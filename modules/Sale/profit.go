@@ -0,0 +1,269 @@
+package Sale
+
+import (
+	"sort"
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+)
+
+// ProfitLine is the revenue, cost of goods and gross profit of one product or currency.
+// Quantity, Revenue and Cost are net of the returns and voids made in the period, which
+// are also reported on their own as ReturnedQuantity and Returns.
+type ProfitLine struct {
+	ProductID        *uint   `json:"productId,omitempty"`
+	ProductName      string  `json:"productName,omitempty"`
+	Currency         string  `json:"currency"`
+	Quantity         int     `json:"quantity"`
+	Revenue          float64 `json:"revenue"`
+	Cost             float64 `json:"cost"`
+	ReturnedQuantity int     `json:"returnedQuantity"`
+	Returns          float64 `json:"returns"` // Sale value taken back
+	GrossProfit      float64 `json:"grossProfit"`
+	Margin           float64 `json:"margin"` // Gross profit as a percentage of revenue
+}
+
+func (l *ProfitLine) add(other *ProfitLine) {
+	l.Quantity += other.Quantity
+	l.Revenue += other.Revenue
+	l.Cost += other.Cost
+	l.ReturnedQuantity += other.ReturnedQuantity
+	l.Returns += other.Returns
+}
+
+func (l *ProfitLine) finish() {
+	l.GrossProfit = l.Revenue - l.Cost
+	if l.Revenue != 0 {
+		l.Margin = l.GrossProfit / l.Revenue * 100
+	}
+}
+
+// CategoryProfit is the profit of a category in one currency, including its subcategories.
+// Sales of uncategorized products are reported with a nil CategoryID.
+type CategoryProfit struct {
+	CategoryID   *uint  `json:"categoryId"`
+	CategoryName string `json:"categoryName"`
+	ParentID     *uint  `json:"parentId,omitempty"`
+	ProfitLine
+}
+
+// ProfitReport is gross profit over a period, per currency, product and category.
+// Revenue is counted per line, so order-level extra costs and discounts are left out.
+type ProfitReport struct {
+	StartDate  *time.Time             `json:"startDate,omitempty"`
+	EndDate    *time.Time             `json:"endDate,omitempty"`
+	Totals     map[string]*ProfitLine `json:"totals"` // Keyed by currency
+	ByProduct  []*ProfitLine          `json:"byProduct"`
+	ByCategory []*CategoryProfit      `json:"byCategory"`
+}
+
+// ProfitFilter narrows the profit report to a period and branch
+type ProfitFilter struct {
+	StartDate *time.Time
+	EndDate   *time.Time
+	BranchID  *uint
+}
+
+// profitRow is the sales or returns of one product in one currency
+type profitRow struct {
+	ProductID   uint
+	ProductName string
+	CategoryID  *uint
+	Currency    string
+	Quantity    int
+	Revenue     float64
+	Cost        float64
+}
+
+// GetProfitReport sums sale lines (standalone sales and order lines) of the company by
+// product and currency, using the cost snapshotted on each sale when it was made.
+// Sales made in the period count in full, and the returns and voids made in the period
+// are taken off them, so a return lowers the period it happened in.
+func (s *SaleService) GetProfitReport(companyID uint, filter ProfitFilter) (*ProfitReport, error) {
+	var rows []profitRow
+	query := s.db.Table("sales").
+		Select("sales.product_id, MAX(sales.product_name) AS product_name, MAX(products.category_id) AS category_id, sales.currency, SUM(sales.quantity + sales.returned_quantity) AS quantity, SUM(sales.total_price + sales.returned_amount) AS revenue, SUM(sales.cost_total + sales.returned_cost) AS cost").
+		Joins("JOIN user_models ON sales.seller_id = user_models.id").
+		Joins("LEFT JOIN products ON sales.product_id = products.id").
+		Joins("JOIN branches ON user_models.branch_id = branches.id").
+		Where("branches.company_id = ?", companyID).
+		Where("sales.deleted_at IS NULL").
+		Group("sales.product_id, sales.currency")
+	if filter.StartDate != nil {
+		query = query.Where("sales.created_at >= ?", *filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		query = query.Where("sales.created_at <= ?", *filter.EndDate)
+	}
+	if filter.BranchID != nil {
+		query = query.Where("user_models.branch_id = ?", *filter.BranchID)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var returnRows []profitRow
+	returnQuery := s.db.Table("sale_returns").
+		Select("sale_returns.product_id, MAX(sale_returns.product_name) AS product_name, MAX(products.category_id) AS category_id, sale_returns.currency, SUM(sale_returns.quantity) AS quantity, SUM(sale_returns.amount) AS revenue, SUM(sale_returns.cost_total) AS cost").
+		Joins("JOIN sales ON sale_returns.sale_id = sales.id").
+		Joins("JOIN user_models ON sales.seller_id = user_models.id").
+		Joins("LEFT JOIN products ON sale_returns.product_id = products.id").
+		Joins("JOIN branches ON user_models.branch_id = branches.id").
+		Where("branches.company_id = ?", companyID).
+		Where("sale_returns.deleted_at IS NULL AND sales.deleted_at IS NULL").
+		Group("sale_returns.product_id, sale_returns.currency")
+	if filter.StartDate != nil {
+		returnQuery = returnQuery.Where("sale_returns.created_at >= ?", *filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		returnQuery = returnQuery.Where("sale_returns.created_at <= ?", *filter.EndDate)
+	}
+	if filter.BranchID != nil {
+		returnQuery = returnQuery.Where("user_models.branch_id = ?", *filter.BranchID)
+	}
+	if err := returnQuery.Scan(&returnRows).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ProfitReport{
+		StartDate: filter.StartDate,
+		EndDate:   filter.EndDate,
+		Totals:    make(map[string]*ProfitLine),
+		ByProduct: []*ProfitLine{},
+	}
+	categories, err := Product.GetProductService().GetCategories(companyID)
+	if err != nil {
+		return nil, err
+	}
+	type productCurrency struct {
+		productID uint
+		currency  string
+	}
+	lines := make(map[productCurrency]*ProfitLine)
+	lineCategories := make(map[*ProfitLine]*uint)
+	lineFor := func(row profitRow) *ProfitLine {
+		key := productCurrency{row.ProductID, row.Currency}
+		line, ok := lines[key]
+		if !ok {
+			productID := row.ProductID
+			line = &ProfitLine{ProductID: &productID, ProductName: row.ProductName, Currency: row.Currency}
+			lines[key] = line
+			lineCategories[line] = row.CategoryID
+			report.ByProduct = append(report.ByProduct, line)
+		}
+		return line
+	}
+	for _, row := range rows {
+		line := lineFor(row)
+		line.Quantity += row.Quantity
+		line.Revenue += row.Revenue
+		line.Cost += row.Cost
+	}
+	// Products with only returns in the period still get a line, with negative totals
+	for _, row := range returnRows {
+		line := lineFor(row)
+		line.Quantity -= row.Quantity
+		line.Revenue -= row.Revenue
+		line.Cost -= row.Cost
+		line.ReturnedQuantity += row.Quantity
+		line.Returns += row.Revenue
+	}
+
+	rollup := newCategoryRollup(categories)
+	for _, line := range report.ByProduct {
+		line.finish()
+		rollup.add(lineCategories[line], line)
+
+		totals, ok := report.Totals[line.Currency]
+		if !ok {
+			totals = &ProfitLine{Currency: line.Currency}
+			report.Totals[line.Currency] = totals
+		}
+		totals.add(line)
+	}
+	for _, totals := range report.Totals {
+		totals.finish()
+	}
+
+	// Most profitable products first
+	sort.SliceStable(report.ByProduct, func(i, j int) bool {
+		return report.ByProduct[i].GrossProfit > report.ByProduct[j].GrossProfit
+	})
+	report.ByCategory = rollup.lines()
+
+	return report, nil
+}
+
+// categoryRollup sums profit lines into their category and every ancestor of it
+type categoryRollup struct {
+	categories map[uint]*Product.Category
+	totals     map[categoryCurrency]*CategoryProfit
+}
+
+type categoryCurrency struct {
+	categoryID uint // 0 for uncategorized products
+	currency   string
+}
+
+func newCategoryRollup(categories []*Product.Category) *categoryRollup {
+	rollup := &categoryRollup{
+		categories: make(map[uint]*Product.Category, len(categories)),
+		totals:     make(map[categoryCurrency]*CategoryProfit),
+	}
+	for _, category := range categories {
+		rollup.categories[category.ID] = category
+	}
+	return rollup
+}
+
+func (r *categoryRollup) add(categoryID *uint, line *ProfitLine) {
+	if categoryID == nil || r.categories[*categoryID] == nil {
+		r.addTo(nil, line)
+		return
+	}
+	// Walk up to the top-level category; seen guards against a corrupted parent chain
+	seen := make(map[uint]bool)
+	for category := r.categories[*categoryID]; category != nil && !seen[category.ID]; {
+		seen[category.ID] = true
+		r.addTo(category, line)
+		if category.ParentID == nil {
+			break
+		}
+		category = r.categories[*category.ParentID]
+	}
+}
+
+func (r *categoryRollup) addTo(category *Product.Category, line *ProfitLine) {
+	key := categoryCurrency{currency: line.Currency}
+	if category != nil {
+		key.categoryID = category.ID
+	}
+	total, ok := r.totals[key]
+	if !ok {
+		total = &CategoryProfit{CategoryName: "Uncategorized", ProfitLine: ProfitLine{Currency: line.Currency}}
+		if category != nil {
+			id := category.ID
+			total.CategoryID = &id
+			total.CategoryName = category.Name
+			total.ParentID = category.ParentID
+		}
+		r.totals[key] = total
+	}
+	total.add(line)
+}
+
+// lines returns the rolled-up categories, most profitable first
+func (r *categoryRollup) lines() []*CategoryProfit {
+	lines := make([]*CategoryProfit, 0, len(r.totals))
+	for _, total := range r.totals {
+		total.finish()
+		lines = append(lines, total)
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].GrossProfit != lines[j].GrossProfit {
+			return lines[i].GrossProfit > lines[j].GrossProfit
+		}
+		return lines[i].CategoryName < lines[j].CategoryName
+	})
+	return lines
+}
@@ -0,0 +1,96 @@
+package Sale
+
+import (
+	"math"
+	"testing"
+
+	Company "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newCostedProduct creates a product priced at 10 whose stock at branch was bought in
+// two lots: 2 units at 4, then 3 units at 6
+func newCostedProduct(t testing.TB, db *gorm.DB, branch *User.Branch) *Product.Product {
+	t.Helper()
+	branchID := branch.ID
+	product, err := Product.GetProductService().CreateProduct(Product.CreateProductRequest{
+		Name: "Widget", Price: 10, Currency: "UGX", CompanyID: branch.CompanyID, Quantity: 2, UnitCost: 4, BranchID: &branchID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unitCost := 6.0
+	restock := Product.StockChange{Reason: Product.MovementRestock, BranchID: &branchID, UnitCost: &unitCost}
+	if _, err := Product.GetProductService().AdjustQuantityTx(db, product.ID, &branch.CompanyID, 3, restock); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// A sale spanning two cost layers is costed by the company's method, a return puts its
+// units back at the cost they were sold at, and the profit report nets the two
+func TestSaleCostAcrossLayers(t *testing.T) {
+	for _, tc := range []struct {
+		method Company.CostingMethod
+		// Cost of 4 units, of the 1 returned, and of 2 more sold after the return
+		saleCost, returnCost, nextCost float64
+	}{
+		// Both lots of 2 at 4 and 2 of the 3 at 6, then the 1 left at 6 and the returned 1 at 5
+		{Company.FIFO, 20, 5, 11},
+		// Everything at the average of (2*4 + 3*6) / 5 = 5.2, which the return does not move
+		{Company.WeightedAverage, 20.8, 5.2, 10.4},
+	} {
+		t.Run(string(tc.method), func(t *testing.T) {
+			db := newTestDB(t)
+			a := Testutil.NewTenant(t, db, "a")
+			if err := db.Model(&Company.Company{}).Where("id = ?", a.Company.ID).Update("costing_method", tc.method).Error; err != nil {
+				t.Fatal(err)
+			}
+			product := newCostedProduct(t, db, a.Branch)
+			actor := actorFor(a.Owner, a.Company.ID)
+
+			sale, err := GetSaleService().CreateSale(CreateSaleRequest{ProductID: product.ID, Quantity: 4, PaymentStatus: Paid, SellerID: a.Owner.ID}, actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !approx(sale.CostTotal, tc.saleCost) {
+				t.Errorf("cost of 4 units = %v, want %v", sale.CostTotal, tc.saleCost)
+			}
+
+			result, err := GetSaleService().ReturnSale(sale.ID, ReturnSaleRequest{Quantity: 1, Reason: "Wrong size"}, actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !approx(result.Return.CostTotal, tc.returnCost) {
+				t.Errorf("cost returned = %v, want %v", result.Return.CostTotal, tc.returnCost)
+			}
+			if want := tc.saleCost - tc.returnCost; !approx(result.Sale.CostTotal, want) || !approx(result.Sale.ReturnedCost, tc.returnCost) {
+				t.Errorf("sale cost %v with %v returned, want %v with %v", result.Sale.CostTotal, result.Sale.ReturnedCost, want, tc.returnCost)
+			}
+
+			next, err := GetSaleService().CreateSale(CreateSaleRequest{ProductID: product.ID, Quantity: 2, PaymentStatus: Paid, SellerID: a.Owner.ID}, actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !approx(next.CostTotal, tc.nextCost) {
+				t.Errorf("cost of 2 units after the return = %v, want %v", next.CostTotal, tc.nextCost)
+			}
+
+			report, err := GetSaleService().GetProfitReport(a.Company.ID, ProfitFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			totals := report.Totals["UGX"]
+			if want := tc.saleCost - tc.returnCost + tc.nextCost; totals == nil || !approx(totals.Cost, want) || totals.Quantity != 5 {
+				t.Errorf("profit report totals %+v, want 5 units costing %v", totals, want)
+			}
+		})
+	}
+}
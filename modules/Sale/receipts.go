@@ -0,0 +1,393 @@
+package Sale
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	Company "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidPaperWidth is returned for receipt widths other than the supported thermal rolls
+	ErrInvalidPaperWidth = errors.New("width must be 58 or 80 (mm)")
+	// ErrNoReceiptBranch is returned when a sale's seller has no branch to number its receipt
+	ErrNoReceiptBranch = errors.New("the seller has no branch to issue the receipt from")
+)
+
+// paperColumns is how many characters fit a line of each supported roll width (mm)
+var paperColumns = map[int]int{
+	58: 32,
+	80: 48,
+}
+
+// DefaultPaperWidth is the roll width (mm) receipts are laid out for unless asked otherwise
+const DefaultPaperWidth = 80
+
+// Receipt is what is printed for a standalone sale or an order
+type Receipt struct {
+	Number        string
+	Date          time.Time
+	CompanyName   string
+	CompanyLines  []string // Address and phone
+	BranchName    string
+	BranchLines   []string
+	SellerName    string
+	BuyerName     *string
+	BuyerContact  *string
+	BuyerLocation *string
+	Items         []*Sale
+	ExtraCosts    float64 // Order-level
+	Discount      float64 // Order-level
+	Total         float64
+	AmountPaid    float64
+	Balance       float64
+	Currency      string
+	PaymentStatus PaymentStatus
+	Voided        bool
+}
+
+// nextReceiptNumberTx takes the next receipt number of branchID. The upsert locks the
+// branch's sequence row until tx ends, so concurrent sales never share a number.
+func nextReceiptNumberTx(tx *gorm.DB, branchID uint) (*string, error) {
+	var next uint
+	if err := tx.Raw(`INSERT INTO receipt_sequences (branch_id, last_number, updated_at) VALUES (?, 1, NOW())
+		ON CONFLICT (branch_id) DO UPDATE SET last_number = receipt_sequences.last_number + 1, updated_at = NOW()
+		RETURNING last_number`, branchID).Scan(&next).Error; err != nil {
+		return nil, err
+	}
+	number := fmt.Sprintf("R%d-%06d", branchID, next)
+	return &number, nil
+}
+
+// issueReceiptNumberTx numbers a new sale or order from the selling branch. Sellers
+// without a branch get their number when the receipt is first printed.
+func issueReceiptNumberTx(tx *gorm.DB, branchID *uint) (*string, error) {
+	if branchID == nil {
+		return nil, nil
+	}
+	return nextReceiptNumberTx(tx, *branchID)
+}
+
+// GetReceipt builds the receipt of a sale. For a line of a multi-line order it is the
+// order's receipt. Sales made before receipts were numbered get their number now.
+func (s *SaleService) GetReceipt(saleID uint, companyID uint) (*Receipt, error) {
+	sale, err := s.GetSaleByID(saleID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if sale.OrderID != nil {
+		return s.GetOrderReceipt(*sale.OrderID, companyID)
+	}
+
+	if sale.ReceiptNumber == nil {
+		if sale.ReceiptNumber, err = s.backfillReceiptNumber(&Sale{}, sale.ID, sale.SellerID, "reference_id = ?"); err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := &Receipt{
+		Number:        *sale.ReceiptNumber,
+		Date:          sale.CreatedAt,
+		BuyerName:     sale.BuyerName,
+		BuyerContact:  sale.BuyerContact,
+		BuyerLocation: sale.BuyerLocation,
+		Items:         []*Sale{sale},
+		Total:         sale.TotalPrice,
+		AmountPaid:    sale.AmountPaid,
+		Balance:       sale.Balance,
+		Currency:      sale.Currency,
+		PaymentStatus: sale.PaymentStatus,
+		Voided:        sale.VoidedAt != nil,
+	}
+	if err := s.fillReceiptHeader(receipt, companyID, sale.Seller, sale.Branch); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// GetOrderReceipt builds the receipt of a multi-line order
+func (s *SaleService) GetOrderReceipt(orderID uint, companyID uint) (*Receipt, error) {
+	order, err := s.GetOrderByID(orderID, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.ReceiptNumber == nil {
+		if order.ReceiptNumber, err = s.backfillReceiptNumber(&Order{}, order.ID, order.SellerID, "reference_id IN (SELECT id FROM sales WHERE order_id = ?)"); err != nil {
+			return nil, err
+		}
+	}
+
+	voided := len(order.Items) > 0
+	for _, item := range order.Items {
+		voided = voided && item.VoidedAt != nil
+	}
+	receipt := &Receipt{
+		Number:        *order.ReceiptNumber,
+		Date:          order.CreatedAt,
+		BuyerName:     order.BuyerName,
+		BuyerContact:  order.BuyerContact,
+		BuyerLocation: order.BuyerLocation,
+		Items:         order.Items,
+		ExtraCosts:    order.ExtraCosts,
+		Discount:      order.Discount,
+		Total:         order.TotalPrice,
+		AmountPaid:    order.AmountPaid,
+		Balance:       order.Balance,
+		Currency:      order.Currency,
+		PaymentStatus: order.PaymentStatus,
+		Voided:        voided,
+	}
+	if err := s.fillReceiptHeader(receipt, companyID, order.Seller, order.Branch); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// backfillReceiptNumber numbers a sale or order (model) recorded before receipts were
+// numbered, from the branch its stock was taken from: the branch of the sale movements
+// that movements (a condition on id) picks out, or its seller's branch when none has one
+func (s *SaleService) backfillReceiptNumber(model interface{}, id uint, sellerID uint, movements string) (*string, error) {
+	var number *string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Scanned into a struct, as Pluck cannot scan NULL into []*string
+		var row struct{ ReceiptNumber *string }
+		if err := tx.Model(model).Clauses(clause.Locking{Strength: "UPDATE"}).Select("receipt_number").Where("id = ?", id).Scan(&row).Error; err != nil {
+			return err
+		}
+		// Another request may have numbered it while this one waited for the lock
+		if row.ReceiptNumber != nil {
+			number = row.ReceiptNumber
+			return nil
+		}
+
+		branchID := movementBranchTx(tx, movements, id)
+		if branchID == nil {
+			branchID = sellerBranchTx(tx, sellerID)
+		}
+		if branchID == nil {
+			return ErrNoReceiptBranch
+		}
+		var err error
+		if number, err = nextReceiptNumberTx(tx, *branchID); err != nil {
+			return err
+		}
+		return tx.Model(model).Where("id = ?", id).Update("receipt_number", *number).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return number, nil
+}
+
+// fillReceiptHeader adds the company, branch and seller the receipt is issued by
+func (s *SaleService) fillReceiptHeader(receipt *Receipt, companyID uint, seller *UserResponse, branch *BranchResponse) error {
+	company, err := Company.GetCompanyService().GetCompanyByID(companyID)
+	if err != nil {
+		return err
+	}
+	receipt.CompanyName = company.Name
+	receipt.CompanyLines = contactLines(company.Address, company.Phone)
+
+	if seller != nil {
+		receipt.SellerName = seller.Name
+	}
+	if branch != nil {
+		receipt.BranchName = branch.Name
+		if details, err := User.GetBranchService().GetBranchByID(branch.ID, companyID); err == nil {
+			receipt.BranchLines = contactLines(details.Address, details.Phone)
+		}
+	}
+	return nil
+}
+
+func contactLines(address, phone *string) []string {
+	var lines []string
+	if address != nil && *address != "" {
+		lines = append(lines, *address)
+	}
+	if phone != nil && *phone != "" {
+		lines = append(lines, "Tel: "+*phone)
+	}
+	return lines
+}
+
+// Lines lays the receipt out for a thermal roll widthMM wide, in plain ASCII so any
+// ESC/POS printer's code page can print it
+func (r *Receipt) Lines(widthMM int) ([]string, error) {
+	columns, ok := paperColumns[widthMM]
+	if !ok {
+		return nil, ErrInvalidPaperWidth
+	}
+	w := receiptWriter{columns: columns}
+	money := func(amount float64) string {
+		return fmt.Sprintf("%.2f", amount)
+	}
+
+	w.center(strings.ToUpper(r.CompanyName))
+	for _, line := range r.CompanyLines {
+		w.center(line)
+	}
+	if r.BranchName != "" {
+		w.center(r.BranchName)
+	}
+	for _, line := range r.BranchLines {
+		w.center(line)
+	}
+	w.rule()
+
+	w.wrap("Receipt: " + r.Number)
+	w.wrap("Date: " + r.Date.Local().Format("2006-01-02 15:04"))
+	if r.SellerName != "" {
+		w.wrap("Served by: " + r.SellerName)
+	}
+	if r.BuyerName != nil && *r.BuyerName != "" {
+		w.wrap("Customer: " + *r.BuyerName)
+	}
+	if r.BuyerContact != nil && *r.BuyerContact != "" {
+		w.wrap("Contact: " + *r.BuyerContact)
+	}
+	if r.BuyerLocation != nil && *r.BuyerLocation != "" {
+		w.wrap("Location: " + *r.BuyerLocation)
+	}
+	if r.Voided {
+		w.blank()
+		w.center("*** VOIDED ***")
+	}
+	w.rule()
+
+	// Lines are shown as sold, with what was returned taken off after them
+	for _, line := range r.Items {
+		sold := line.Quantity + line.ReturnedQuantity
+		w.wrap(line.ProductName + attributeSuffix(line.ProductAttributes))
+		w.pair(fmt.Sprintf("  %d x %s", sold, money(line.UnitPrice)), money(line.UnitPrice*float64(sold)))
+		if line.ExtraCosts != 0 {
+			w.pair("  Extra costs", money(line.ExtraCosts))
+		}
+		if line.Discount != 0 {
+			w.pair("  Discount", money(-line.Discount))
+		}
+		if line.ReturnedQuantity > 0 {
+			w.pair(fmt.Sprintf("  Returned %d", line.ReturnedQuantity), money(-line.ReturnedAmount))
+		}
+	}
+	w.rule()
+
+	if r.ExtraCosts != 0 {
+		w.pair("Extra costs", money(r.ExtraCosts))
+	}
+	if r.Discount != 0 {
+		w.pair("Discount", money(-r.Discount))
+	}
+	w.pair("TOTAL "+r.Currency, money(r.Total))
+	w.pair("Paid", money(r.AmountPaid))
+	w.pair("Balance", money(r.Balance))
+	w.wrap("Status: " + strings.ReplaceAll(string(r.PaymentStatus), "_", " "))
+	w.rule()
+	w.center("Thank you!")
+	return w.lines, nil
+}
+
+// Text is the receipt as plain text for a thermal roll widthMM wide, with blank lines
+// at the end so it clears the tear bar
+func (r *Receipt) Text(widthMM int) (string, error) {
+	lines, err := r.Lines(widthMM)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n") + "\n\n\n\n", nil
+}
+
+// PDF is the receipt as a one-page PDF as wide as a thermal roll widthMM wide
+func (r *Receipt) PDF(widthMM int) ([]byte, error) {
+	lines, err := r.Lines(widthMM)
+	if err != nil {
+		return nil, err
+	}
+	return renderTextPDF(lines, float64(widthMM), paperColumns[widthMM]), nil
+}
+
+// attributeSuffix formats a variant's attributes as " (Color: Red, Size: M)"
+func attributeSuffix(attributes JSONB) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %v", key, attributes[key]))
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// receiptWriter builds fixed-width receipt lines
+type receiptWriter struct {
+	columns int
+	lines   []string
+}
+
+func (w *receiptWriter) blank() {
+	w.lines = append(w.lines, "")
+}
+
+func (w *receiptWriter) rule() {
+	w.lines = append(w.lines, strings.Repeat("-", w.columns))
+}
+
+// wrap adds text, broken at spaces (or mid-word when a word is too long) to fit the line
+func (w *receiptWriter) wrap(text string) {
+	text = asciiOnly(text)
+	for len(text) > w.columns {
+		cut := strings.LastIndex(text[:w.columns+1], " ")
+		if cut <= 0 {
+			cut = w.columns
+		}
+		w.lines = append(w.lines, strings.TrimRight(text[:cut], " "))
+		text = strings.TrimLeft(text[cut:], " ")
+	}
+	w.lines = append(w.lines, text)
+}
+
+func (w *receiptWriter) center(text string) {
+	start := len(w.lines)
+	w.wrap(text)
+	for i := start; i < len(w.lines); i++ {
+		if pad := (w.columns - len(w.lines[i])) / 2; pad > 0 {
+			w.lines[i] = strings.Repeat(" ", pad) + w.lines[i]
+		}
+	}
+}
+
+// pair puts label on the left and amount on the right of the line, moving the amount
+// to its own line when both do not fit
+func (w *receiptWriter) pair(label, amount string) {
+	label = asciiOnly(label)
+	if len(label)+1+len(amount) > w.columns {
+		w.wrap(label)
+		label = ""
+	}
+	w.lines = append(w.lines, label+strings.Repeat(" ", w.columns-len(label)-len(amount))+amount)
+}
+
+// asciiOnly replaces characters thermal printers may not have in their code page
+func asciiOnly(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		if r < 32 || r > 126 {
+			return '?'
+		}
+		return r
+	}, text)
+}
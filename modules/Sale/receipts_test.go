@@ -0,0 +1,38 @@
+package Sale
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+// A sale made before receipts were numbered is numbered from the branch its stock was
+// taken from, not the branch its seller has since moved to
+func TestBackfillReceiptNumberUsesSellingBranch(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	other := Testutil.NewBranch(t, db, a.Company.ID, "a Other")
+	product := newStockedProduct(t, db, a.Branch, 5)
+
+	sale, err := GetSaleService().CreateSale(CreateSaleRequest{ProductID: product.ID, Quantity: 1, PaymentStatus: Paid, SellerID: a.Owner.ID}, actorFor(a.Owner, a.Company.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&Sale{}).Where("id = ?", sale.ID).Update("receipt_number", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&User.UserModel{}).Where("id = ?", a.Owner.ID).Update("branch_id", other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := GetSaleService().GetReceipt(sale.ID, a.Company.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix := fmt.Sprintf("R%d-", a.Branch.ID); !strings.HasPrefix(receipt.Number, prefix) {
+		t.Errorf("receipt number %s, want one from branch %d (%s...)", receipt.Number, a.Branch.ID, prefix)
+	}
+}
@@ -0,0 +1,228 @@
+package Sale
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+)
+
+// AgingBuckets splits an outstanding amount by how many days ago the sale was made
+type AgingBuckets struct {
+	Days0To30  float64 `json:"days0To30"`
+	Days31To60 float64 `json:"days31To60"`
+	Days61To90 float64 `json:"days61To90"`
+	Over90     float64 `json:"over90"`
+	Total      float64 `json:"total"`
+}
+
+func (b *AgingBuckets) add(ageDays int, amount float64) {
+	switch {
+	case ageDays <= 30:
+		b.Days0To30 += amount
+	case ageDays <= 60:
+		b.Days31To60 += amount
+	case ageDays <= 90:
+		b.Days61To90 += amount
+	default:
+		b.Over90 += amount
+	}
+	b.Total += amount
+}
+
+// ReceivableItem is one unpaid standalone sale or order
+type ReceivableItem struct {
+	SaleID        *uint         `json:"saleId,omitempty"`
+	OrderID       *uint         `json:"orderId,omitempty"`
+	Date          time.Time     `json:"date"`
+	DueDate       *time.Time    `json:"dueDate,omitempty"`
+	AgeDays       int           `json:"ageDays"`
+	Description   string        `json:"description"`
+	TotalPrice    float64       `json:"totalPrice"`
+	AmountPaid    float64       `json:"amountPaid"`
+	Balance       float64       `json:"balance"`
+	PaymentStatus PaymentStatus `json:"paymentStatus"`
+	SellerID      uint          `json:"sellerId"`
+	BranchID      uint          `json:"branchId"`
+}
+
+// DebtorAging is the outstanding balance of one buyer in one currency
+type DebtorAging struct {
+	CustomerID   *uint            `json:"customerId,omitempty"`
+	BuyerName    string           `json:"buyerName"`
+	BuyerContact *string          `json:"buyerContact,omitempty"`
+	Currency     string           `json:"currency"`
+	Buckets      AgingBuckets     `json:"buckets"`
+	OldestDate   time.Time        `json:"oldestDate"`
+	Items        []ReceivableItem `json:"items"`
+}
+
+// AgingReport lists outstanding balances grouped by buyer, with totals per currency
+type AgingReport struct {
+	AsOf    time.Time                `json:"asOf"`
+	Debtors []*DebtorAging           `json:"debtors"`
+	Totals  map[string]*AgingBuckets `json:"totals"` // Keyed by currency
+}
+
+// AgingFilter narrows the aging report to one branch or seller
+type AgingFilter struct {
+	BranchID *uint
+	SellerID *uint
+}
+
+// receivableRow is the shape scanned from the sales and orders tables
+type receivableRow struct {
+	ID            uint
+	CreatedAt     time.Time
+	DueDate       *time.Time
+	ProductName   string
+	Quantity      int
+	ItemCount     int
+	TotalPrice    float64
+	AmountPaid    float64
+	Currency      string
+	PaymentStatus PaymentStatus
+	SellerID      uint
+	BranchID      uint
+	CustomerID    *uint
+	BuyerName     *string
+	BuyerContact  *string
+}
+
+// GetReceivablesAging returns every unpaid standalone sale and order of the company,
+// grouped by buyer and bucketed by age (0-30, 31-60, 61-90 and over 90 days since the sale).
+// Sales are tied to the company and branch through their seller, as in ListSales.
+func (s *SaleService) GetReceivablesAging(companyID uint, filter AgingFilter) (*AgingReport, error) {
+	var sales []receivableRow
+	salesQuery := s.db.Table("sales").
+		Select("sales.id, sales.created_at, sales.due_date, sales.product_name, sales.quantity, sales.total_price, sales.amount_paid, sales.currency, sales.payment_status, sales.seller_id, user_models.branch_id, sales.customer_id, sales.buyer_name, sales.buyer_contact").
+		Joins("JOIN user_models ON sales.seller_id = user_models.id").
+		Joins("JOIN branches ON user_models.branch_id = branches.id").
+		Where("branches.company_id = ?", companyID).
+		Where("sales.order_id IS NULL AND sales.deleted_at IS NULL").
+		Where("sales.total_price - sales.amount_paid > ?", priceTolerance)
+	if filter.BranchID != nil {
+		salesQuery = salesQuery.Where("user_models.branch_id = ?", *filter.BranchID)
+	}
+	if filter.SellerID != nil {
+		salesQuery = salesQuery.Where("sales.seller_id = ?", *filter.SellerID)
+	}
+	if err := salesQuery.Scan(&sales).Error; err != nil {
+		return nil, err
+	}
+
+	var orders []receivableRow
+	ordersQuery := s.db.Table("orders").
+		Select("orders.id, orders.created_at, orders.due_date, orders.total_price, orders.amount_paid, orders.currency, orders.payment_status, orders.seller_id, user_models.branch_id, orders.customer_id, orders.buyer_name, orders.buyer_contact, (SELECT COUNT(*) FROM sales WHERE sales.order_id = orders.id AND sales.deleted_at IS NULL) AS item_count").
+		Joins("JOIN user_models ON orders.seller_id = user_models.id").
+		Joins("JOIN branches ON user_models.branch_id = branches.id").
+		Where("branches.company_id = ?", companyID).
+		Where("orders.deleted_at IS NULL").
+		Where("orders.total_price - orders.amount_paid > ?", priceTolerance)
+	if filter.BranchID != nil {
+		ordersQuery = ordersQuery.Where("user_models.branch_id = ?", *filter.BranchID)
+	}
+	if filter.SellerID != nil {
+		ordersQuery = ordersQuery.Where("orders.seller_id = ?", *filter.SellerID)
+	}
+	if err := ordersQuery.Scan(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &AgingReport{
+		AsOf:    now,
+		Debtors: []*DebtorAging{},
+		Totals:  make(map[string]*AgingBuckets),
+	}
+	debtors := make(map[string]*DebtorAging)
+
+	addRow := func(row receivableRow, item ReceivableItem) {
+		item.Date = row.CreatedAt
+		item.DueDate = row.DueDate
+		item.AgeDays = int(now.Sub(row.CreatedAt).Hours() / 24)
+		item.TotalPrice = row.TotalPrice
+		item.AmountPaid = row.AmountPaid
+		item.Balance = row.TotalPrice - row.AmountPaid
+		item.PaymentStatus = derivePaymentStatus(row.TotalPrice, row.AmountPaid, row.DueDate, row.PaymentStatus, now)
+		item.SellerID = row.SellerID
+		item.BranchID = row.BranchID
+
+		key := debtorKey(row) + "|" + row.Currency
+		debtor, ok := debtors[key]
+		if !ok {
+			debtor = &DebtorAging{
+				CustomerID:   row.CustomerID,
+				BuyerName:    "Walk-in customer",
+				BuyerContact: row.BuyerContact,
+				Currency:     row.Currency,
+				OldestDate:   row.CreatedAt,
+			}
+			if row.BuyerName != nil && strings.TrimSpace(*row.BuyerName) != "" {
+				debtor.BuyerName = strings.TrimSpace(*row.BuyerName)
+			}
+			debtors[key] = debtor
+			report.Debtors = append(report.Debtors, debtor)
+		}
+		if row.CreatedAt.Before(debtor.OldestDate) {
+			debtor.OldestDate = row.CreatedAt
+		}
+		debtor.Buckets.add(item.AgeDays, item.Balance)
+		debtor.Items = append(debtor.Items, item)
+
+		totals, ok := report.Totals[row.Currency]
+		if !ok {
+			totals = &AgingBuckets{}
+			report.Totals[row.Currency] = totals
+		}
+		totals.add(item.AgeDays, item.Balance)
+	}
+
+	for _, row := range sales {
+		saleID := row.ID
+		addRow(row, ReceivableItem{
+			SaleID:      &saleID,
+			Description: fmt.Sprintf("%d x %s", row.Quantity, row.ProductName),
+		})
+	}
+	for _, row := range orders {
+		orderID := row.ID
+		addRow(row, ReceivableItem{
+			OrderID:     &orderID,
+			Description: fmt.Sprintf("Order #%d (%d items)", row.ID, row.ItemCount),
+		})
+	}
+
+	// Largest debts first; each debtor's items oldest first
+	sort.SliceStable(report.Debtors, func(i, j int) bool {
+		return report.Debtors[i].Buckets.Total > report.Debtors[j].Buckets.Total
+	})
+	for _, debtor := range report.Debtors {
+		sort.SliceStable(debtor.Items, func(i, j int) bool {
+			return debtor.Items[i].Date.Before(debtor.Items[j].Date)
+		})
+	}
+
+	return report, nil
+}
+
+// debtorKey identifies the buyer of a receivable: the linked customer, otherwise the
+// normalized contact or name. Sales without any buyer details are grouped together.
+func debtorKey(row receivableRow) string {
+	if row.CustomerID != nil {
+		return fmt.Sprintf("customer:%d", *row.CustomerID)
+	}
+	if row.BuyerContact != nil {
+		if contact := Customer.NormalizeContact(*row.BuyerContact); contact != "" {
+			return "contact:" + contact
+		}
+	}
+	if row.BuyerName != nil {
+		if name := strings.ToLower(strings.TrimSpace(*row.BuyerName)); name != "" {
+			return "name:" + name
+		}
+	}
+	return "walk-in"
+}
@@ -0,0 +1,287 @@
+package Sale
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrSaleVoided is returned when a voided sale is edited, voided or returned again
+	ErrSaleVoided = errors.New("sale has been voided")
+	// ErrVoidWindowClosed is returned when a sale is voided after the day it was made
+	ErrVoidWindowClosed = errors.New("sales can only be voided on the day they were made; record a return instead")
+	// ErrInvalidReturnQuantity is returned for return quantities that are not positive or exceed what is still sold
+	ErrInvalidReturnQuantity = errors.New("return quantity must be between one and the quantity still sold")
+	// ErrInvalidApprover is returned when a void names an approver outside the company or without sales:void
+	ErrInvalidApprover = errors.New("approver must be a user of the company who can void sales")
+)
+
+// ReturnResult is returned after a void or return, with the sale as it is now
+type ReturnResult struct {
+	Return *SaleReturn `json:"return"`
+	Sale   *Sale       `json:"sale"`
+}
+
+// VoidSale cancels a sale on the day it was made. Everything still sold goes back to
+// stock and everything paid for it is refunded. req.ApprovedByID names the approver, who
+// must hold sales:void; without it the actor, who needs sales:void to void, approves.
+func (s *SaleService) VoidSale(id uint, req VoidSaleRequest, actor SaleActor) (*ReturnResult, error) {
+	approvedByID := actor.UserID
+	if req.ApprovedByID != nil {
+		approver, err := User.GetUserService().GetCompanyUserByID(*req.ApprovedByID, actor.CompanyID)
+		if err != nil || !User.HasPermission(approver.Role, User.PermSalesVoid) {
+			return nil, ErrInvalidApprover
+		}
+		approvedByID = approver.ID
+	}
+
+	return s.reverseSale(id, func(sale *Sale) (*reversal, error) {
+		if !sameDay(sale.CreatedAt, time.Now()) {
+			return nil, ErrVoidWindowClosed
+		}
+		return &reversal{
+			kind:         KindVoid,
+			quantity:     sale.Quantity,
+			reason:       req.Reason,
+			refundMethod: req.RefundMethod,
+			approvedByID: &approvedByID,
+		}, nil
+	}, actor)
+}
+
+// ReturnSale takes back req.Quantity units of a sale. Their share of the sale's total is
+// taken off what the buyer owes, and refunded when it was already paid.
+func (s *SaleService) ReturnSale(id uint, req ReturnSaleRequest, actor SaleActor) (*ReturnResult, error) {
+	return s.reverseSale(id, func(sale *Sale) (*reversal, error) {
+		return &reversal{
+			kind:         KindReturn,
+			quantity:     req.Quantity,
+			reason:       req.Reason,
+			refundMethod: req.RefundMethod,
+		}, nil
+	}, actor)
+}
+
+// reversal is what a void or return takes back from a sale
+type reversal struct {
+	kind         ReturnKind
+	quantity     int
+	reason       string
+	refundMethod *PaymentMethod
+	approvedByID *uint
+}
+
+// reverseSale locks the sale, lets build decide what to take back and applies it
+func (s *SaleService) reverseSale(id uint, build func(*Sale) (*reversal, error), actor SaleActor) (*ReturnResult, error) {
+	var sale Sale
+	var saleReturn *SaleReturn
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(companySales(actor.CompanyID)).First(&sale, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrSaleNotFound
+			}
+			return err
+		}
+		if sale.VoidedAt != nil {
+			return ErrSaleVoided
+		}
+		r, err := build(&sale)
+		if err != nil {
+			return err
+		}
+		saleReturn, err = s.reverseSaleTx(tx, &sale, r, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.populateSale(&sale)
+	s.populateReturns([]*SaleReturn{saleReturn})
+	return &ReturnResult{Return: saleReturn, Sale: &sale}, nil
+}
+
+// reverseSaleTx puts r.quantity units of sale back into stock, takes their share of the
+// total off the sale (and its order) and refunds what was paid beyond the new total
+func (s *SaleService) reverseSaleTx(tx *gorm.DB, sale *Sale, r *reversal, actor SaleActor) (*SaleReturn, error) {
+	if r.quantity <= 0 || r.quantity > sale.Quantity {
+		return nil, ErrInvalidReturnQuantity
+	}
+	if r.refundMethod != nil && !validPaymentMethod(*r.refundMethod) {
+		return nil, ErrInvalidPaymentMethod
+	}
+
+	// The last units take whatever is left, so rounding never leaves a remainder
+	amount := sale.TotalPrice
+	cost := sale.CostTotal
+	if r.quantity < sale.Quantity {
+		amount = sale.TotalPrice * float64(r.quantity) / float64(sale.Quantity)
+		cost = sale.UnitCost * float64(r.quantity)
+	}
+
+	saleReturn := &SaleReturn{
+		SaleID:        sale.ID,
+		OrderID:       sale.OrderID,
+		Kind:          r.kind,
+		ProductID:     sale.ProductID,
+		ProductName:   sale.ProductName,
+		Quantity:      r.quantity,
+		Amount:        amount,
+		CostTotal:     cost,
+		Currency:      sale.Currency,
+		Reason:        r.reason,
+		ProcessedByID: actor.UserID,
+		ApprovedByID:  r.approvedByID,
+	}
+	if err := tx.Create(saleReturn).Error; err != nil {
+		return nil, err
+	}
+
+	change := actor.returnChange(sale, saleBranchTx(tx, sale.ID, sale.ProductID, sale.SellerID))
+	change.Reason = Product.MovementReturn
+	notes := fmt.Sprintf("%s #%d: %s", r.kind, saleReturn.ID, r.reason)
+	change.Notes = &notes
+	if _, err := Product.GetProductService().AdjustQuantityTx(tx, sale.ProductID, &actor.CompanyID, r.quantity, change); err != nil {
+		return nil, err
+	}
+
+	sale.Quantity -= r.quantity
+	sale.TotalPrice -= amount
+	sale.CostTotal -= cost
+	sale.ReturnedQuantity += r.quantity
+	sale.ReturnedAmount += amount
+	sale.ReturnedCost += cost
+	sale.Version++
+	if r.kind == KindVoid {
+		now := time.Now()
+		sale.VoidedAt = &now
+	}
+
+	var refund *Payment
+	if sale.OrderID == nil {
+		if excess := sale.AmountPaid - sale.TotalPrice; excess > priceTolerance {
+			refund = refundPayment(excess, r.refundMethod, sale.Currency, &sale.ID, nil, saleReturn, actor)
+			sale.AmountPaid -= excess
+		}
+		sale.PaymentStatus = derivePaymentStatus(sale.TotalPrice, sale.AmountPaid, sale.DueDate, sale.PaymentStatus, time.Now())
+	}
+	if err := tx.Save(sale).Error; err != nil {
+		return nil, err
+	}
+	if sale.OrderID != nil {
+		var err error
+		if refund, err = s.refundOrderExcessTx(tx, *sale.OrderID, r.refundMethod, saleReturn, actor); err != nil {
+			return nil, err
+		}
+		if err := s.recalculateOrderTx(tx, *sale.OrderID); err != nil {
+			return nil, err
+		}
+	}
+
+	if refund != nil {
+		if err := tx.Create(refund).Error; err != nil {
+			return nil, err
+		}
+		saleReturn.RefundAmount = -refund.Amount
+		saleReturn.RefundID = &refund.ID
+		if err := tx.Model(saleReturn).Updates(map[string]interface{}{
+			"refund_amount": saleReturn.RefundAmount,
+			"refund_id":     saleReturn.RefundID,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return saleReturn, nil
+}
+
+// refundOrderExcessTx takes what was paid for an order beyond its lines' new total off
+// the order and returns the refund payment for it, or nil when nothing is owed back
+func (s *SaleService) refundOrderExcessTx(tx *gorm.DB, orderID uint, method *PaymentMethod, saleReturn *SaleReturn, actor SaleActor) (*Payment, error) {
+	var order Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, "id = ?", orderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	subtotal := 0.0
+	for _, item := range order.Items {
+		subtotal += item.TotalPrice
+	}
+	excess := order.AmountPaid - (subtotal + order.ExtraCosts - order.Discount)
+	if excess <= priceTolerance {
+		return nil, nil
+	}
+	if err := tx.Model(&order).Update("amount_paid", order.AmountPaid-excess).Error; err != nil {
+		return nil, err
+	}
+	return refundPayment(excess, method, order.Currency, nil, &order.ID, saleReturn, actor), nil
+}
+
+// refundPayment builds the negative payment that records money given back for saleReturn
+func refundPayment(amount float64, method *PaymentMethod, currency string, saleID, orderID *uint, saleReturn *SaleReturn, actor SaleActor) *Payment {
+	refundMethod := Cash
+	if method != nil {
+		refundMethod = *method
+	}
+	notes := fmt.Sprintf("Refund for %s #%d", saleReturn.Kind, saleReturn.ID)
+	return &Payment{
+		SaleID:       saleID,
+		OrderID:      orderID,
+		Amount:       -amount,
+		Currency:     currency,
+		Method:       refundMethod,
+		Notes:        &notes,
+		PaidAt:       time.Now(),
+		ReceivedByID: actor.UserID,
+	}
+}
+
+// GetSaleReturns lists the voids and returns of a sale, oldest first
+func (s *SaleService) GetSaleReturns(saleID uint, companyID uint) ([]*SaleReturn, error) {
+	var sale Sale
+	if err := s.db.Scopes(companySales(companyID)).First(&sale, "id = ?", saleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSaleNotFound
+		}
+		return nil, err
+	}
+
+	var returns []*SaleReturn
+	if err := s.db.Where("sale_id = ?", saleID).Order("created_at ASC").Find(&returns).Error; err != nil {
+		return nil, err
+	}
+	s.populateReturns(returns)
+	return returns, nil
+}
+
+// populateReturns populates the users who processed returns with one query
+func (s *SaleService) populateReturns(returns []*SaleReturn) {
+	ids := make([]uint, 0, len(returns))
+	for _, saleReturn := range returns {
+		ids = append(ids, saleReturn.ProcessedByID)
+	}
+	users, err := User.GetUserService().GetUserSummaries(ids)
+	if err != nil {
+		return
+	}
+	for _, saleReturn := range returns {
+		if user, ok := users[saleReturn.ProcessedByID]; ok {
+			saleReturn.ProcessedBy = &UserResponse{ID: user.ID, Name: user.Name}
+		}
+	}
+}
+
+// sameDay reports whether a and b fall on the same calendar day in the server's time zone
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Local().Date()
+	by, bm, bd := b.Local().Date()
+	return ay == by && am == bm && ad == bd
+}
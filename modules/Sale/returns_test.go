@@ -0,0 +1,99 @@
+package Sale
+
+import (
+	"errors"
+	"testing"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newStockedProduct seeds a product holding quantity units, all of them at branch
+func newStockedProduct(t testing.TB, db *gorm.DB, branch *User.Branch, quantity int) *Product.Product {
+	t.Helper()
+	product := &Product.Product{Name: "Widget", Price: 10, Currency: "UGX", Quantity: quantity, CompanyID: branch.CompanyID}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	stock := &Product.BranchStock{ProductID: product.ID, BranchID: branch.ID, CompanyID: branch.CompanyID, Quantity: quantity}
+	if err := db.Create(stock).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func actorFor(user *User.UserModel, companyID uint) SaleActor {
+	return SaleActor{UserID: user.ID, CompanyID: companyID, BranchID: user.BranchID, Role: user.Role}
+}
+
+func branchQuantity(t testing.TB, db *gorm.DB, productID, branchID uint) int {
+	t.Helper()
+	var quantities []int
+	if err := db.Model(&Product.BranchStock{}).Where("product_id = ? AND branch_id = ?", productID, branchID).Pluck("quantity", &quantities).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(quantities) == 0 {
+		return 0
+	}
+	return quantities[0]
+}
+
+// A return puts the stock back into the branch the sale took it from, even after the
+// seller has moved to another branch
+func TestReturnRestocksSellingBranch(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	other := Testutil.NewBranch(t, db, a.Company.ID, "a Other")
+	product := newStockedProduct(t, db, a.Branch, 5)
+	actor := actorFor(a.Owner, a.Company.ID)
+
+	sale, err := GetSaleService().CreateSale(CreateSaleRequest{ProductID: product.ID, Quantity: 2, PaymentStatus: Paid, SellerID: a.Owner.ID}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&User.UserModel{}).Where("id = ?", a.Owner.ID).Update("branch_id", other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSaleService().ReturnSale(sale.ID, ReturnSaleRequest{Quantity: 2, Reason: "Wrong size"}, actor); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := branchQuantity(t, db, product.ID, a.Branch.ID); got != 5 {
+		t.Errorf("selling branch holds %d, want 5", got)
+	}
+	if got := branchQuantity(t, db, product.ID, other.ID); got != 0 {
+		t.Errorf("seller's new branch holds %d, want 0", got)
+	}
+}
+
+// A void records the approver it names, who must be able to void sales in the company
+func TestVoidApprover(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	manager := Testutil.NewUser(t, db, a.Branch, "a-manager", User.BranchManager)
+	cashier := Testutil.NewUser(t, db, a.Branch, "a-cashier", User.Cashier)
+	product := newStockedProduct(t, db, a.Branch, 5)
+	actor := actorFor(a.Owner, a.Company.ID)
+
+	sale, err := GetSaleService().CreateSale(CreateSaleRequest{ProductID: product.ID, Quantity: 1, PaymentStatus: Paid, SellerID: a.Owner.ID}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, approver := range map[string]*User.UserModel{"cashier": cashier, "other company": b.Owner} {
+		req := VoidSaleRequest{Reason: "Rung up twice", ApprovedByID: &approver.ID}
+		if _, err := GetSaleService().VoidSale(sale.ID, req, actor); !errors.Is(err, ErrInvalidApprover) {
+			t.Errorf("%s as approver: got %v, want ErrInvalidApprover", name, err)
+		}
+	}
+
+	result, err := GetSaleService().VoidSale(sale.ID, VoidSaleRequest{Reason: "Rung up twice", ApprovedByID: &manager.ID}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved := result.Return.ApprovedByID; approved == nil || *approved != manager.ID {
+		t.Errorf("approvedById = %v, want %d", approved, manager.ID)
+	}
+}
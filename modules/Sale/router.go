@@ -1,13 +1,21 @@
 package Sale
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
 	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 )
 
@@ -19,77 +27,151 @@ func GetSaleService() *SaleService {
 func RegisterRoutes(rg *gin.RouterGroup) {
 	sales := rg.Group("/sales")
 	{
-		sales.GET("", getAllSalesHandler)
-		sales.GET("/:id", getSaleHandler)
-		sales.GET("/user/:userId", getSalesByUserHandler)
-		sales.GET("/branch/:branch", getSalesByBranchHandler)
-		sales.GET("/date-range", getSalesByDateRangeHandler)
+		sales.GET("", User.RequirePermission(User.PermSalesRead), getAllSalesHandler)
+		sales.GET("/:id", User.RequirePermission(User.PermSalesRead), getSaleHandler)
+		sales.GET("/user/:userId", User.RequirePermission(User.PermSalesRead), getSalesByUserHandler)
+		sales.GET("/branch/:branch", User.RequirePermission(User.PermSalesRead), getSalesByBranchHandler)
+		sales.GET("/date-range", User.RequirePermission(User.PermSalesRead), getSalesByDateRangeHandler)
 		sales.GET("/events", salesEventsHandler) // SSE endpoint
-		sales.POST("", createSaleHandler)
-		sales.PUT("/:id", updateSaleHandler)
-		sales.DELETE("/:id", deleteSaleHandler)
+		sales.GET("/receivables/aging", User.RequirePermission(User.PermReportsRead), getReceivablesAgingHandler)
+		sales.GET("/reports/profit", User.RequirePermission(User.PermReportsRead), getProfitReportHandler)
+		sales.GET("/orders", User.RequirePermission(User.PermSalesRead), getAllOrdersHandler)
+		sales.GET("/orders/:id", User.RequirePermission(User.PermSalesRead), getOrderHandler)
+		sales.GET("/orders/:id/payments", User.RequirePermission(User.PermSalesRead), getOrderPaymentsHandler)
+		sales.POST("/orders/:id/payments", User.RequirePermission(User.PermPaymentsRecord), createOrderPaymentHandler)
+		sales.GET("/orders/:id/receipt", User.RequirePermission(User.PermSalesRead), getOrderReceiptHandler)
+		sales.GET("/:id/receipt", User.RequirePermission(User.PermSalesRead), getSaleReceiptHandler)
+		sales.GET("/:id/payments", User.RequirePermission(User.PermSalesRead), getSalePaymentsHandler)
+		sales.POST("/:id/payments", User.RequirePermission(User.PermPaymentsRecord), createSalePaymentHandler)
+		sales.POST("", User.RequirePermission(User.PermSalesCreate), Idempotency.Middleware(), createSaleHandler)
+		sales.PUT("/:id", User.RequirePermission(User.PermSalesUpdate), updateSaleHandler)
+		sales.GET("/:id/returns", User.RequirePermission(User.PermSalesRead), getSaleReturnsHandler)
+		sales.POST("/:id/returns", User.RequirePermission(User.PermSalesReturn), Idempotency.Middleware(), createSaleReturnHandler)
+		sales.POST("/:id/void", User.RequirePermission(User.PermSalesVoid), voidSaleHandler)
+		sales.DELETE("/:id", User.RequirePermission(User.PermSalesVoid), deleteSaleHandler)
 	}
 }
 
+// saleListSpec is what GET /sales and its per-user, per-branch and date-range variants sort and filter by
+var saleListSpec = Query.Spec{
+	ID: "sales.id",
+	Sorts: map[string]string{
+		"createdAt":   "sales.created_at",
+		"totalPrice":  "sales.total_price",
+		"quantity":    "sales.quantity",
+		"productName": "sales.product_name",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId":      {Kind: Query.UintFilter}, // Applied through the seller's branch
+		"sellerId":      {Column: "sales.seller_id", Kind: Query.UintFilter},
+		"productId":     {Column: "sales.product_id", Kind: Query.UintFilter},
+		"customerId":    {Column: "sales.customer_id", Kind: Query.UintFilter},
+		"orderId":       {Column: "sales.order_id", Kind: Query.UintFilter},
+		"paymentStatus": {Column: "sales.payment_status"},
+		"currency":      {Column: "sales.currency"},
+	},
+	DateColumn: "sales.created_at",
+	Search:     []string{"sales.product_name", "sales.buyer_name", "sales.buyer_contact"},
+}
+
 func getAllSalesHandler(c *gin.Context) {
-	sales, err := GetSaleService().GetAllSales()
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, saleListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	listSales(c, companyID, params)
+}
+
+func listSales(c *gin.Context, companyID uint, params *Query.Params) {
+	sales, page, err := GetSaleService().ListSales(companyID, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		Query.ErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"sales": sales})
+	c.JSON(http.StatusOK, gin.H{"sales": sales, "page": page})
 }
 
 func getSaleHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
 		return
 	}
-	sale, err := GetSaleService().GetSaleByID(uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	sale, err := GetSaleService().GetSaleByID(uint(id), companyID)
+	if err != nil || !canSeeBranch(c, sale.Branch) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrSaleNotFound.Error()})
 		return
 	}
 
+	Query.SetETag(c, sale.Version)
 	c.JSON(http.StatusOK, sale)
 }
 
 func getSalesByUserHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	userIDParam := c.Param("userId")
 	userID, err := strconv.ParseUint(userIDParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
 		return
 	}
-	sales, err := GetSaleService().GetSalesByUser(uint(userID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	params, ok := Query.FromContext(c, saleListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
 		return
 	}
+	params.Set("sellerId", uint(userID))
 
-	c.JSON(http.StatusOK, gin.H{"sales": sales})
+	listSales(c, companyID, params)
 }
 
 func getSalesByBranchHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	branchParam := c.Param("branch")
 	branchID, err := strconv.ParseUint(branchParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
 		return
 	}
-	sales, err := GetSaleService().GetSalesByBranch(uint(branchID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !User.CanAccessBranch(c, uint(branchID)) {
+		User.BranchAccessDenied(c)
+		return
+	}
+	params, ok := Query.FromContext(c, saleListSpec)
+	if !ok {
 		return
 	}
+	params.Set("branchId", uint(branchID))
 
-	c.JSON(http.StatusOK, gin.H{"sales": sales})
+	listSales(c, companyID, params)
 }
 
 func getSalesByDateRangeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	startDateStr := c.Query("startDate")
 	endDateStr := c.Query("endDate")
 
@@ -105,50 +187,160 @@ func getSalesByDateRangeHandler(c *gin.Context) {
 		return
 	}
 
-	sales, err := GetSaleService().GetSalesByDateRange(startDate, endDate)
+	params, ok := Query.FromContext(c, saleListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+	params.From = &startDate
+	params.To = &endDate
+
+	listSales(c, companyID, params)
+}
+
+// getReceivablesAgingHandler returns the company's outstanding balances grouped by buyer and age.
+// Optional branchId and sellerId query parameters narrow the report.
+func getReceivablesAgingHandler(c *gin.Context) {
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	var filter AgingFilter
+	if branchParam := c.Query("branchId"); branchParam != "" {
+		branchID, err := strconv.ParseUint(branchParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
+			return
+		}
+		id := uint(branchID)
+		filter.BranchID = &id
+	}
+	// Branch-limited roles only see their own branch's debtors
+	if limit := User.BranchLimitFromContext(c); limit != nil {
+		if filter.BranchID != nil && *filter.BranchID != *limit {
+			User.BranchAccessDenied(c)
+			return
+		}
+		filter.BranchID = limit
+	}
+	if sellerParam := c.Query("sellerId"); sellerParam != "" {
+		sellerID, err := strconv.ParseUint(sellerParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seller id"})
+			return
+		}
+		id := uint(sellerID)
+		filter.SellerID = &id
+	}
+
+	report, err := GetSaleService().GetReceivablesAging(actor.CompanyID, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"sales": sales})
+	c.JSON(http.StatusOK, report)
 }
 
+func getProfitReportHandler(c *gin.Context) {
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	var filter ProfitFilter
+	if startDateStr := c.Query("startDate"); startDateStr != "" {
+		startDate, err := time.Parse(time.RFC3339, startDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid startDate format"})
+			return
+		}
+		filter.StartDate = &startDate
+	}
+	if endDateStr := c.Query("endDate"); endDateStr != "" {
+		endDate, err := time.Parse(time.RFC3339, endDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid endDate format"})
+			return
+		}
+		filter.EndDate = &endDate
+	}
+	if branchParam := c.Query("branchId"); branchParam != "" {
+		branchID, err := strconv.ParseUint(branchParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
+			return
+		}
+		id := uint(branchID)
+		filter.BranchID = &id
+	}
+	// Branch-limited roles only see their own branch's profit
+	if limit := User.BranchLimitFromContext(c); limit != nil {
+		if filter.BranchID != nil && *filter.BranchID != *limit {
+			User.BranchAccessDenied(c)
+			return
+		}
+		filter.BranchID = limit
+	}
+
+	report, err := GetSaleService().GetProfitReport(actor.CompanyID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// createSaleHandler records a single-product sale, or a multi-line order when the body has "items"
 func createSaleHandler(c *gin.Context) {
-	var req CreateSaleRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var probe struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := c.ShouldBindBodyWith(&probe, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if len(probe.Items) > 0 && string(probe.Items) != "null" {
+		createOrderHandler(c)
+		return
+	}
 
-	// Get seller ID from token context (set by AuthMiddleware)
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user information not found"})
+	var req CreateSaleRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	sellerID, ok := userID.(uint)
+	// Get seller and company from token context (set by AuthMiddleware)
+	actor, ok := SaleActorFromContext(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user information"})
 		return
 	}
+	sellerID := actor.UserID
 
 	// Set seller ID from context (override any value sent in request for security)
 	req.SellerID = sellerID
 
-	sale, err := GetSaleService().CreateSale(req)
+	sale, err := GetSaleService().CreateSale(req, actor)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		saleErrorResponse(c, err)
 		return
 	}
 
+	AnnounceSale(actor.CompanyID, sale)
+
+	c.JSON(http.StatusCreated, sale)
+}
+
+// AnnounceSale notifies the seller of a recorded sale and streams it to the company's super admins
+func AnnounceSale(companyID uint, sale *Sale) {
 	// Create notification for sale
 	notificationService := Notification.GetNotificationService()
 	if notificationService != nil {
 		saleID := sale.ID
 		_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
-			UserID:    sellerID,
+			UserID:    sale.SellerID,
 			Type:      Notification.NotificationTypeSale,
 			Title:     "Sale Recorded",
 			Message:   fmt.Sprintf("Recorded sale of %d units of %s for %s %.2f", sale.Quantity, sale.ProductName, sale.Currency, sale.TotalPrice),
@@ -158,37 +350,292 @@ func createSaleHandler(c *gin.Context) {
 
 	// Broadcast SSE event to super admins of the company
 	sseService := GetSSEService()
-	companyID, err := GetSaleService().GetCompanyIDFromSale(sale)
-	if err == nil && companyID != nil {
-		seller, _ := User.GetUserService().GetUserByID(sellerID)
-		sellerName := ""
-		branchName := ""
-		if seller != nil {
-			sellerName = seller.Name
-			// Branch name is already populated in seller object
-			branchName = seller.Branch
-		}
+	seller, _ := User.GetUserService().GetUserByID(sale.SellerID)
+	sellerName := ""
+	branchName := ""
+	if seller != nil {
+		sellerName = seller.Name
+		// Branch name is already populated in seller object
+		branchName = seller.Branch
+	}
 
-		// If sale has branch populated, use that instead
-		if sale.Branch != nil && sale.Branch.Name != "" {
-			branchName = sale.Branch.Name
-		}
+	// If sale has branch populated, use that instead
+	if sale.Branch != nil && sale.Branch.Name != "" {
+		branchName = sale.Branch.Name
+	}
 
-		saleEvent := SaleEvent{
-			Type:        "new_sale",
-			SaleID:      sale.ID,
-			ProductName: sale.ProductName,
-			Quantity:    sale.Quantity,
-			TotalPrice:  sale.TotalPrice,
-			Currency:    sale.Currency,
-			SellerName:  sellerName,
-			BranchName:  branchName,
-			CreatedAt:   sale.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		}
-		sseService.BroadcastSaleEvent(*companyID, saleEvent)
+	saleEvent := SaleEvent{
+		Type:        "new_sale",
+		SaleID:      sale.ID,
+		ProductName: sale.ProductName,
+		Quantity:    sale.Quantity,
+		TotalPrice:  sale.TotalPrice,
+		Currency:    sale.Currency,
+		SellerName:  sellerName,
+		BranchName:  branchName,
+		CreatedAt:   sale.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
+	sseService.BroadcastSaleEvent(companyID, saleEvent)
+}
 
-	c.JSON(http.StatusCreated, sale)
+// createOrderHandler records a multi-line order with one notification and one SSE event
+func createOrderHandler(c *gin.Context) {
+	var req CreateOrderRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	// Set seller ID from context (override any value sent in request for security)
+	req.SellerID = actor.UserID
+
+	order, err := GetSaleService().CreateOrder(req, actor)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	productNames := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		productNames = append(productNames, item.ProductName)
+	}
+	summary := strings.Join(productNames, ", ")
+
+	notificationService := Notification.GetNotificationService()
+	if notificationService != nil {
+		// Point at the first line so clients that open sales by ID land on a sale of this order
+		saleID := order.Items[0].ID
+		_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
+			UserID:    actor.UserID,
+			Type:      Notification.NotificationTypeSale,
+			Title:     "Sale Recorded",
+			Message:   fmt.Sprintf("Recorded order #%d of %d items (%s) for %s %.2f", order.ID, len(order.Items), summary, order.Currency, order.TotalPrice),
+			RelatedID: &saleID,
+		})
+	}
+
+	sellerName := ""
+	branchName := ""
+	if order.Seller != nil {
+		sellerName = order.Seller.Name
+	}
+	if order.Branch != nil {
+		branchName = order.Branch.Name
+	}
+
+	quantity := 0
+	for _, item := range order.Items {
+		quantity += item.Quantity
+	}
+
+	GetSSEService().BroadcastSaleEvent(actor.CompanyID, SaleEvent{
+		Type:        "new_order",
+		SaleID:      order.Items[0].ID,
+		OrderID:     order.ID,
+		ItemCount:   len(order.Items),
+		ProductName: summary,
+		Quantity:    quantity,
+		TotalPrice:  order.TotalPrice,
+		Currency:    order.Currency,
+		SellerName:  sellerName,
+		BranchName:  branchName,
+		CreatedAt:   order.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	})
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// orderListSpec is what GET /sales/orders sorts and filters by
+var orderListSpec = Query.Spec{
+	ID: "orders.id",
+	Sorts: map[string]string{
+		"createdAt":  "orders.created_at",
+		"totalPrice": "orders.total_price",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId":      {Kind: Query.UintFilter}, // Applied through the seller's branch
+		"sellerId":      {Column: "orders.seller_id", Kind: Query.UintFilter},
+		"customerId":    {Column: "orders.customer_id", Kind: Query.UintFilter},
+		"paymentStatus": {Column: "orders.payment_status"},
+		"currency":      {Column: "orders.currency"},
+	},
+	DateColumn: "orders.created_at",
+	Search:     []string{"orders.buyer_name", "orders.buyer_contact"},
+}
+
+func getAllOrdersHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, orderListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	orders, page, err := GetSaleService().ListOrders(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"orders": orders, "page": page})
+}
+
+func getOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+	order, err := GetSaleService().GetOrderByID(uint(id), companyID)
+	if err != nil || !canSeeBranch(c, order.Branch) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrOrderNotFound.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func getSalePaymentsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+	if !checkSaleAccess(c, uint(id), companyID) {
+		return
+	}
+	payments, err := GetSaleService().GetPaymentsBySale(uint(id), companyID)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": payments})
+}
+
+func getOrderPaymentsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+	if !checkOrderAccess(c, uint(id), companyID) {
+		return
+	}
+	payments, err := GetSaleService().GetPaymentsByOrder(uint(id), companyID)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": payments})
+}
+
+// createSalePaymentHandler records a payment against a sale (or the order the sale belongs to)
+func createSalePaymentHandler(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+	var req CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if !checkSaleAccess(c, uint(id), actor.CompanyID) {
+		return
+	}
+
+	result, err := GetSaleService().RecordPayment(uint(id), req, actor)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	notifyPaymentReceived(actor.UserID, uint(id), result)
+	c.JSON(http.StatusCreated, result)
+}
+
+// createOrderPaymentHandler records a payment against a multi-line order
+func createOrderPaymentHandler(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+	var req CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if !checkOrderAccess(c, uint(id), actor.CompanyID) {
+		return
+	}
+
+	result, err := GetSaleService().RecordOrderPayment(uint(id), req, actor)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	notifyPaymentReceived(actor.UserID, uint(id), result)
+	c.JSON(http.StatusCreated, result)
+}
+
+// notifyPaymentReceived tells the receiving user that a payment was recorded
+func notifyPaymentReceived(userID uint, relatedID uint, result *PaymentResult) {
+	notificationService := Notification.GetNotificationService()
+	if notificationService == nil {
+		return
+	}
+	_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
+		UserID:    userID,
+		Type:      Notification.NotificationTypeSale,
+		Title:     "Payment Received",
+		Message:   fmt.Sprintf("Received %s %.2f by %s. Outstanding balance: %s %.2f", result.Payment.Currency, result.Payment.Amount, result.Payment.Method, result.Payment.Currency, result.Balance),
+		RelatedID: &relatedID,
+	})
 }
 
 func updateSaleHandler(c *gin.Context) {
@@ -203,13 +650,45 @@ func updateSaleHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Version == nil {
+		version, ok := Query.IfMatchVersion(c)
+		if !ok {
+			return
+		}
+		req.Version = version
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if !checkSaleAccess(c, uint(id), actor.CompanyID) {
+		return
+	}
+	// Sales can only be moved to sellers the caller may see
+	if req.SellerID != nil && User.BranchLimitFromContext(c) != nil {
+		seller, err := User.GetUserService().GetCompanyUserByID(*req.SellerID, actor.CompanyID)
+		if err != nil || seller.BranchID == nil || !User.CanAccessBranch(c, *seller.BranchID) {
+			User.BranchAccessDenied(c)
+			return
+		}
+	}
 
 	// Get sale before update to check if it's a reorder
-	oldSale, _ := GetSaleService().GetSaleByID(uint(id))
+	oldSale, _ := GetSaleService().GetSaleByID(uint(id), actor.CompanyID)
 
-	sale, err := GetSaleService().UpdateSale(uint(id), req)
+	sale, err := GetSaleService().UpdateSale(uint(id), req, actor)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if errors.Is(err, ErrVersionConflict) {
+			// Send the sale as it is now, so the client can merge its edit and retry
+			if current, loadErr := GetSaleService().GetSaleByID(uint(id), actor.CompanyID); loadErr == nil {
+				Query.SetETag(c, current.Version)
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "VERSION_CONFLICT", "current": current})
+				return
+			}
+		}
+		saleErrorResponse(c, err)
 		return
 	}
 
@@ -247,22 +726,381 @@ func updateSaleHandler(c *gin.Context) {
 		}
 	}
 
+	Query.SetETag(c, sale.Version)
 	c.JSON(http.StatusOK, sale)
 }
 
+// deleteSaleHandler voids a sale; sales are never removed, so DELETE takes the void reason
+// as ?reason= and an optional approver as ?approvedById=
 func deleteSaleHandler(c *gin.Context) {
+	req := VoidSaleRequest{Reason: strings.TrimSpace(c.Query("reason"))}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a reason is required to void a sale", "code": "REASON_REQUIRED"})
+		return
+	}
+	if approvedBy := c.Query("approvedById"); approvedBy != "" {
+		approvedByID, err := strconv.ParseUint(approvedBy, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approvedById"})
+			return
+		}
+		approver := uint(approvedByID)
+		req.ApprovedByID = &approver
+	}
+	voidSale(c, req)
+}
+
+func voidSaleHandler(c *gin.Context) {
+	var req VoidSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	voidSale(c, req)
+}
+
+func voidSale(c *gin.Context, req VoidSaleRequest) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if !checkSaleAccess(c, uint(id), actor.CompanyID) {
+		return
+	}
+
+	result, err := GetSaleService().VoidSale(uint(id), req, actor)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	announceReturn(actor.CompanyID, result)
+	c.JSON(http.StatusOK, result)
+}
+
+func createSaleReturnHandler(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+	var req ReturnSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	if !checkSaleAccess(c, uint(id), actor.CompanyID) {
+		return
+	}
+
+	result, err := GetSaleService().ReturnSale(uint(id), req, actor)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	announceReturn(actor.CompanyID, result)
+	c.JSON(http.StatusCreated, result)
+}
+
+func getSaleReturnsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
 		return
 	}
-	if err := GetSaleService().DeleteSale(uint(id)); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if !checkSaleAccess(c, uint(id), companyID) {
+		return
+	}
+	returns, err := GetSaleService().GetSaleReturns(uint(id), companyID)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"returns": returns})
+}
+
+func getSaleReceiptHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+	if !checkSaleAccess(c, uint(id), companyID) {
+		return
+	}
+	receipt, err := GetSaleService().GetReceipt(uint(id), companyID)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	writeReceipt(c, receipt)
+}
+
+func getOrderReceiptHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "sale deleted successfully"})
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+	if !checkOrderAccess(c, uint(id), companyID) {
+		return
+	}
+	receipt, err := GetSaleService().GetOrderReceipt(uint(id), companyID)
+	if err != nil {
+		saleErrorResponse(c, err)
+		return
+	}
+
+	writeReceipt(c, receipt)
+}
+
+// writeReceipt renders receipt as ?format=pdf (default) or text, for a ?width=58 or 80 mm roll
+func writeReceipt(c *gin.Context, receipt *Receipt) {
+	width := DefaultPaperWidth
+	if param := c.Query("width"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidPaperWidth.Error(), "code": "INVALID_QUERY"})
+			return
+		}
+		width = parsed
+	}
+
+	filename := "receipt-" + receipt.Number
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		pdf, err := receipt.PDF(width)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUERY"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, filename))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	case "text":
+		text, err := receipt.Text(width)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUERY"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.txt"`, filename))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or text", "code": "INVALID_QUERY"})
+	}
+}
+
+// announceReturn notifies the seller of a void or return and streams it to the company's super admins
+func announceReturn(companyID uint, result *ReturnResult) {
+	sale := result.Sale
+	saleReturn := result.Return
+
+	title := "Sale Returned"
+	eventType := "sale_returned"
+	if saleReturn.Kind == KindVoid {
+		title = "Sale Voided"
+		eventType = "sale_voided"
+	}
+	message := fmt.Sprintf("%d units of %s (%s %.2f) taken back: %s", saleReturn.Quantity, saleReturn.ProductName, saleReturn.Currency, saleReturn.Amount, saleReturn.Reason)
+	if saleReturn.RefundAmount > 0 {
+		message += fmt.Sprintf(". Refunded %s %.2f", saleReturn.Currency, saleReturn.RefundAmount)
+	}
+
+	notificationService := Notification.GetNotificationService()
+	if notificationService != nil {
+		saleID := sale.ID
+		_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
+			UserID:    sale.SellerID,
+			Type:      Notification.NotificationTypeSale,
+			Title:     title,
+			Message:   message,
+			RelatedID: &saleID,
+		})
+	}
+
+	sellerName := ""
+	if sale.Seller != nil {
+		sellerName = sale.Seller.Name
+	}
+	branchName := ""
+	if sale.Branch != nil {
+		branchName = sale.Branch.Name
+	}
+	orderID := uint(0)
+	if sale.OrderID != nil {
+		orderID = *sale.OrderID
+	}
+	GetSSEService().BroadcastSaleEvent(companyID, SaleEvent{
+		Type:        eventType,
+		SaleID:      sale.ID,
+		OrderID:     orderID,
+		ProductName: saleReturn.ProductName,
+		Quantity:    saleReturn.Quantity,
+		TotalPrice:  saleReturn.Amount,
+		Currency:    saleReturn.Currency,
+		SellerName:  sellerName,
+		BranchName:  branchName,
+		Reason:      saleReturn.Reason,
+		CreatedAt:   saleReturn.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	})
+}
+
+// SaleActorFromContext builds the SaleActor from the values set by AuthMiddleware.
+// It writes a 401 response and returns false when any of them is missing.
+func SaleActorFromContext(c *gin.Context) (SaleActor, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user information not found"})
+		return SaleActor{}, false
+	}
+
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user information"})
+		return SaleActor{}, false
+	}
+
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "company information not found"})
+		return SaleActor{}, false
+	}
+
+	companyIDPtr, ok := companyID.(*uint)
+	if !ok || companyIDPtr == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid company information"})
+		return SaleActor{}, false
+	}
+
+	role, _ := c.Get("role")
+	userRole, _ := role.(User.UserRole)
+	branchID, _ := c.Get("branch_id")
+	branchIDPtr, _ := branchID.(*uint)
+
+	return SaleActor{UserID: userIDUint, CompanyID: *companyIDPtr, BranchID: branchIDPtr, Role: userRole}, true
+}
+
+// canSeeBranch reports whether a sale or order made at branch is visible to the caller.
+// Branch-limited roles only see their own branch.
+func canSeeBranch(c *gin.Context, branch *BranchResponse) bool {
+	if User.BranchLimitFromContext(c) == nil {
+		return true
+	}
+	return branch != nil && User.CanAccessBranch(c, branch.ID)
+}
+
+// checkSaleAccess writes a 404 and returns false unless the sale exists in the company
+// and is visible to the caller
+func checkSaleAccess(c *gin.Context, id uint, companyID uint) bool {
+	sale, err := GetSaleService().GetSaleByID(id, companyID)
+	if err != nil || !canSeeBranch(c, sale.Branch) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrSaleNotFound.Error(), "code": "SALE_NOT_FOUND"})
+		return false
+	}
+	return true
+}
+
+// checkOrderAccess is checkSaleAccess for orders
+func checkOrderAccess(c *gin.Context, id uint, companyID uint) bool {
+	order, err := GetSaleService().GetOrderByID(id, companyID)
+	if err != nil || !canSeeBranch(c, order.Branch) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrOrderNotFound.Error(), "code": "ORDER_NOT_FOUND"})
+		return false
+	}
+	return true
+}
+
+// saleErrorResponse writes a service error with the status and error code matching its cause
+func saleErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, Product.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "insufficient stock for this sale", "code": "INSUFFICIENT_STOCK"})
+	case errors.Is(err, Product.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PRODUCT_NOT_FOUND"})
+	case errors.Is(err, Product.ErrVariantNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "VARIANT_NOT_FOUND"})
+	case errors.Is(err, Product.ErrVariantRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "VARIANT_REQUIRED"})
+	case errors.Is(err, ErrSaleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "SALE_NOT_FOUND"})
+	case errors.Is(err, ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUANTITY"})
+	case errors.Is(err, ErrPriceOverrideNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "PRICE_OVERRIDE_NOT_ALLOWED"})
+	case errors.Is(err, ErrOverrideReasonRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "OVERRIDE_REASON_REQUIRED"})
+	case errors.Is(err, ErrInvalidDiscount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_DISCOUNT"})
+	case errors.Is(err, ErrInvalidExtraCosts):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_EXTRA_COSTS"})
+	case errors.Is(err, ErrMixedCurrencies):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "MIXED_CURRENCIES"})
+	case errors.Is(err, ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "ORDER_NOT_FOUND"})
+	case errors.Is(err, ErrInvalidPaymentAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PAYMENT_AMOUNT"})
+	case errors.Is(err, ErrOverpayment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "OVERPAYMENT"})
+	case errors.Is(err, ErrInvalidPaymentMethod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PAYMENT_METHOD"})
+	case errors.Is(err, ErrInvalidPaymentStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PAYMENT_STATUS"})
+	case errors.Is(err, Customer.ErrCustomerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "CUSTOMER_NOT_FOUND"})
+	case errors.Is(err, Customer.ErrCreditLimitExceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "CREDIT_LIMIT_EXCEEDED"})
+	case errors.Is(err, ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "VERSION_CONFLICT"})
+	case errors.Is(err, ErrTotalBelowPaid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "TOTAL_BELOW_PAID"})
+	case errors.Is(err, ErrSaleVoided):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "SALE_VOIDED"})
+	case errors.Is(err, ErrVoidWindowClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "VOID_WINDOW_CLOSED"})
+	case errors.Is(err, ErrInvalidReturnQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_RETURN_QUANTITY"})
+	case errors.Is(err, ErrInvalidApprover):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_APPROVER"})
+	case errors.Is(err, ErrNoReceiptBranch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "NO_RECEIPT_BRANCH"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
 }
 
 // salesEventsHandler handles SSE connections for sale events
@@ -0,0 +1,74 @@
+package Sale
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+)
+
+// A company's users can neither see nor change another company's sales
+func TestSalesAreScopedToCompany(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	r := Testutil.NewRouter(RegisterRoutes)
+	own := newSale(t, db, a.Owner)
+	foreign := newSale(t, db, b.Owner)
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/v1/sales/%d", ""},
+		{http.MethodPut, "/api/v1/sales/%d", `{"quantity": 2}`},
+		{http.MethodDelete, "/api/v1/sales/%d?reason=mistake", ""},
+		{http.MethodPost, "/api/v1/sales/%d/void", `{"reason": "mistake"}`},
+		{http.MethodPost, "/api/v1/sales/%d/returns", `{"quantity": 1, "reason": "mistake"}`},
+		{http.MethodGet, "/api/v1/sales/%d/payments", ""},
+		{http.MethodPost, "/api/v1/sales/%d/payments", `{"amount": 1, "method": "cash"}`},
+		{http.MethodGet, "/api/v1/sales/%d/returns", ""},
+		{http.MethodGet, "/api/v1/sales/%d/receipt", ""},
+	} {
+		path := fmt.Sprintf(tc.path, foreign.ID)
+		w := Testutil.Serve(r, tc.method, path, a.Token, tc.body)
+		if w.Code != http.StatusNotFound && w.Code != http.StatusForbidden {
+			t.Errorf("%s %s as company A: %d %s, want 404 or 403", tc.method, path, w.Code, w.Body)
+		}
+	}
+
+	var after Sale
+	if err := db.First(&after, foreign.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Quantity != foreign.Quantity || after.VoidedAt != nil || after.AmountPaid != foreign.AmountPaid {
+		t.Errorf("company B's sale changed: %+v", after)
+	}
+
+	for _, path := range []string{
+		"/api/v1/sales",
+		fmt.Sprintf("/api/v1/sales?branchId=%d", b.Branch.ID),
+		fmt.Sprintf("/api/v1/sales/user/%d", b.Owner.ID),
+		fmt.Sprintf("/api/v1/sales/branch/%d", b.Branch.ID),
+	} {
+		w := Testutil.Serve(r, http.MethodGet, path, a.Token)
+		if w.Code == http.StatusNotFound || w.Code == http.StatusForbidden {
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s as company A: %d %s", path, w.Code, w.Body)
+			continue
+		}
+		var body struct{ Sales []*Sale }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		for _, sale := range body.Sales {
+			if sale.ID != own.ID {
+				t.Errorf("GET %s as company A listed sale %d of company B", path, sale.ID)
+			}
+		}
+		if path == "/api/v1/sales" && len(body.Sales) != 1 {
+			t.Errorf("GET %s as company A listed %d sales, want its own one", path, len(body.Sales))
+		}
+	}
+}
@@ -2,10 +2,14 @@ package Sale
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"gorm.io/gorm"
-	Branch "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Branch"
+	"gorm.io/gorm/clause"
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
 )
 
@@ -13,6 +17,19 @@ import (
 
 var saleService *SaleService
 
+var (
+	// ErrSaleNotFound is returned when a sale does not exist
+	ErrSaleNotFound = errors.New("sale not found")
+	// ErrInvalidQuantity is returned when a sale is recorded with a non-positive quantity
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrOrderNotFound is returned when an order does not exist
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrMixedCurrencies is returned when the lines of an order are priced in different currencies
+	ErrMixedCurrencies = errors.New("all items in an order must use the same currency")
+	// ErrVersionConflict is returned when a sale is updated against a version that someone else has since changed
+	ErrVersionConflict = errors.New("sale was changed by someone else; reload it and try again")
+)
+
 type SaleService struct {
 	db *gorm.DB
 }
@@ -32,79 +49,66 @@ func InitializeService(db *gorm.DB) {
 	// TODO: Update all methods to use database instead of in-memory storage
 }
 
-func (s *SaleService) GetSaleByID(id uint) (*Sale, error) {
+func (s *SaleService) GetSaleByID(id uint, companyID uint) (*Sale, error) {
 	var sale Sale
-	if err := s.db.First(&sale, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(companySales(companyID)).First(&sale, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("sale not found")
+			return nil, ErrSaleNotFound
 		}
 		return nil, err
 	}
-	s.populateSeller(&sale)
+	s.populateSale(&sale)
 	return &sale, nil
 }
 
-func (s *SaleService) GetAllSales() ([]*Sale, error) {
-	var sales []*Sale
-	if err := s.db.Find(&sales).Error; err != nil {
-		return nil, err
+// ListSales returns one page of the company's sales matching params.
+// The branchId filter matches the seller's branch.
+func (s *SaleService) ListSales(companyID uint, params *Query.Params) ([]*Sale, *Query.Page, error) {
+	query := s.db.Model(&Sale{}).Scopes(companySales(companyID))
+	if branchID := params.Uint("branchId"); branchID != nil {
+		query = query.Scopes(sellerBranch("sales.seller_id", *branchID))
 	}
-	for i := range sales {
-		s.populateSeller(sales[i])
-	}
-	return sales, nil
-}
 
-func (s *SaleService) GetSalesByUser(userID uint) ([]*Sale, error) {
 	var sales []*Sale
-	if err := s.db.Where("seller_id = ?", userID).Find(&sales).Error; err != nil {
-		return nil, err
-	}
-	for i := range sales {
-		s.populateSeller(sales[i])
+	page, err := Query.Paginate(query, params, &sales)
+	if err != nil {
+		return nil, nil, err
 	}
-	return sales, nil
+	s.PopulateSales(sales)
+	return sales, page, nil
 }
 
-func (s *SaleService) GetSalesByBranch(branchID uint) ([]*Sale, error) {
-	// Get sales by finding users in the branch, then their sales
-	var sales []*Sale
-	if err := s.db.Joins("JOIN user_models ON sales.seller_id = user_models.id").
-		Where("user_models.branch_id = ?", branchID).
-		Find(&sales).Error; err != nil {
+// CreateSale records a sale and decrements the product's stock in a single transaction.
+// The product must belong to the actor's company; the sale is rejected if there is not enough stock.
+// Name, currency and unit price come from the product - client prices are treated as overrides.
+func (s *SaleService) CreateSale(req CreateSaleRequest, actor SaleActor) (*Sale, error) {
+	var sale *Sale
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		sale, err = s.CreateSaleTx(tx, req, actor)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	for i := range sales {
-		s.populateSeller(sales[i])
-	}
-	return sales, nil
+
+	// Populate seller and branch information before returning
+	s.populateSale(sale)
+	return sale, nil
 }
 
-func (s *SaleService) GetSalesByDateRange(startDate, endDate time.Time) ([]*Sale, error) {
-	var sales []*Sale
-	if err := s.db.Where("created_at >= ? AND created_at <= ?", startDate, endDate).Find(&sales).Error; err != nil {
-		return nil, err
-	}
-	for i := range sales {
-		s.populateSeller(sales[i])
+// CreateSaleTx records a sale like CreateSale inside tx, for callers that write other
+// rows in the same transaction. Seller and branch information is not populated.
+func (s *SaleService) CreateSaleTx(tx *gorm.DB, req CreateSaleRequest, actor SaleActor) (*Sale, error) {
+	if req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
 	}
-	return sales, nil
-}
 
-func (s *SaleService) CreateSale(req CreateSaleRequest) (*Sale, error) {
-	// Use provided total price (allows manual override from frontend)
-	// Frontend sends calculated total or overridden total
-	finalTotalPrice := req.TotalPrice
-	
 	sale := &Sale{
 		ProductID:         req.ProductID,
-		ProductName:       req.ProductName,
 		ProductAttributes: JSONB(req.ProductAttributes),
 		Quantity:          req.Quantity,
-		UnitPrice:         req.UnitPrice,
 		ExtraCosts:        req.ExtraCosts,
-		TotalPrice:        finalTotalPrice, // Use provided total (calculated or overridden)
-		Currency:          req.Currency,
 		SellerID:          req.SellerID,
 		PaymentStatus:     req.PaymentStatus,
 		BuyerName:         req.BuyerName,
@@ -117,123 +121,637 @@ func (s *SaleService) CreateSale(req CreateSaleRequest) (*Sale, error) {
 		sale.ProductAttributes = make(JSONB)
 	}
 
-	if err := s.db.Create(sale).Error; err != nil {
+	if err := resolveVariantTx(tx, sale, req.VariantID, actor); err != nil {
+		return nil, err
+	}
+	// Lock the product row first; the stock is taken once the sale has an ID for the ledger
+	product, err := Product.GetProductService().LockProductTx(tx, sale.ProductID, &actor.CompanyID)
+	if err != nil {
 		return nil, err
 	}
+	if product.Quantity < req.Quantity {
+		return nil, Product.ErrInsufficientStock
+	}
 
-	// Populate seller and branch information before returning
-	s.populateSeller(sale)
-	return sale, nil
-}
+	sale.ProductName = product.Name
+	sale.Currency = product.Currency
+	sale.ListPrice = product.Price
+	sale.UnitPrice = product.Price
+	if err := applyPricing(sale, priceInput{
+		UnitPrice:      req.UnitPrice,
+		Discount:       req.Discount,
+		TotalPrice:     req.TotalPrice,
+		OverrideReason: req.OverrideReason,
+	}, actor); err != nil {
+		return nil, err
+	}
 
-func (s *SaleService) UpdateSale(id uint, req UpdateSaleRequest) (*Sale, error) {
-	var sale Sale
-	if err := s.db.First(&sale, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("sale not found")
-		}
+	amountPaid, err := openingPayment(req.PaymentStatus, req.AmountPaid, req.PaymentMethod, sale.TotalPrice)
+	if err != nil {
 		return nil, err
 	}
+	sale.AmountPaid = amountPaid
+	sale.DueDate = req.DueDate
+	sale.PaymentStatus = derivePaymentStatus(sale.TotalPrice, sale.AmountPaid, sale.DueDate, req.PaymentStatus, time.Now())
 
-	if req.ProductID != nil {
-		sale.ProductID = *req.ProductID
+	customer, err := Customer.GetCustomerService().ResolveCustomerTx(tx, actor.CompanyID, req.CustomerID, req.BuyerName, req.BuyerContact, req.BuyerLocation)
+	if err != nil {
+		return nil, err
+	}
+	if err := Customer.GetCustomerService().CheckCreditLimitTx(tx, customer, sale.TotalPrice-sale.AmountPaid); err != nil {
+		return nil, err
+	}
+	sale.CustomerID, sale.BuyerName, sale.BuyerContact, sale.BuyerLocation = customerBuyer(customer, sale.BuyerName, sale.BuyerContact, sale.BuyerLocation)
+	if sale.ReceiptNumber, err = issueReceiptNumberTx(tx, actor.BranchID); err != nil {
+		return nil, err
 	}
-	if req.ProductName != nil {
-		sale.ProductName = *req.ProductName
+
+	if err := tx.Create(sale).Error; err != nil {
+		return nil, err
 	}
-	if req.ProductAttributes != nil {
-		sale.ProductAttributes = JSONB(req.ProductAttributes)
+	_, movement, err := Product.GetProductService().AdjustStockTx(tx, sale.ProductID, &actor.CompanyID, -sale.Quantity, actor.stockChange(Product.MovementSale, &sale.ID, actor.BranchID))
+	if err != nil {
+		return nil, err
 	}
-	if req.Quantity != nil {
-		sale.Quantity = *req.Quantity
+	if err := snapshotCostTx(tx, sale, movement); err != nil {
+		return nil, err
 	}
-	if req.UnitPrice != nil {
-		sale.UnitPrice = *req.UnitPrice
+	if amountPaid > 0 {
+		if err := tx.Create(openingPaymentRow(amountPaid, req.PaymentMethod, sale.Currency, &sale.ID, nil, actor)).Error; err != nil {
+			return nil, err
+		}
 	}
-	if req.ExtraCosts != nil {
-		sale.ExtraCosts = *req.ExtraCosts
+	return sale, nil
+}
+
+// UpdateSale applies req to a sale. Changes to the product or quantity move stock
+// between the old and new product in the same transaction as the sale update, and
+// the total is re-derived with the same override rules as CreateSale. An update made
+// against an older req.Version returns ErrVersionConflict.
+func (s *SaleService) UpdateSale(id uint, req UpdateSaleRequest, actor SaleActor) (*Sale, error) {
+	if req.Quantity != nil && *req.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
 	}
-	if req.TotalPrice != nil {
-		sale.TotalPrice = *req.TotalPrice
-	} else if req.UnitPrice != nil || req.Quantity != nil || req.ExtraCosts != nil {
-		// Recalculate total if any component changed
-		unitPrice := sale.UnitPrice
-		quantity := sale.Quantity
-		extraCosts := sale.ExtraCosts
-		if req.UnitPrice != nil {
-			unitPrice = *req.UnitPrice
+
+	var sale Sale
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(companySales(actor.CompanyID)).First(&sale, "id = ?", id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrSaleNotFound
+			}
+			return err
+		}
+		if sale.VoidedAt != nil {
+			return ErrSaleVoided
+		}
+		if req.Version != nil && *req.Version != sale.Version {
+			return ErrVersionConflict
+		}
+		sale.Version++
+
+		oldProductID := sale.ProductID
+		oldQuantity := sale.Quantity
+		oldSellerID := sale.SellerID
+		oldBalance := sale.TotalPrice - sale.AmountPaid
+		oldUnitPrice, oldExtraCosts, oldDiscount := sale.UnitPrice, sale.ExtraCosts, sale.Discount
+		if sale.ListPrice == 0 {
+			// Sales recorded before list prices were captured keep their original unit price
+			sale.ListPrice = sale.UnitPrice
+		}
+
+		if req.ProductID != nil || req.VariantID != nil || req.ProductAttributes != nil {
+			// Pick the variant again among the product's (or the sold variant's parent's) variants
+			if req.ProductID != nil {
+				sale.ProductID = *req.ProductID
+			} else if sale.ParentProductID != nil {
+				sale.ProductID = *sale.ParentProductID
+			}
+			if req.ProductAttributes != nil {
+				sale.ProductAttributes = JSONB(req.ProductAttributes)
+			}
+			if err := resolveVariantTx(tx, &sale, req.VariantID, actor); err != nil {
+				return err
+			}
 		}
 		if req.Quantity != nil {
-			quantity = *req.Quantity
+			sale.Quantity = *req.Quantity
 		}
 		if req.ExtraCosts != nil {
-			extraCosts = *req.ExtraCosts
+			sale.ExtraCosts = *req.ExtraCosts
 		}
-		sale.TotalPrice = (unitPrice * float64(quantity)) + extraCosts
-	}
-	if req.Currency != nil {
-		sale.Currency = *req.Currency
+		if req.SellerID != nil {
+			if _, err := User.GetUserService().GetCompanyUserByID(*req.SellerID, actor.CompanyID); err != nil {
+				return err
+			}
+			sale.SellerID = *req.SellerID
+		}
+		if req.PaymentStatus != nil {
+			// Paid states are derived from recorded payments; only the unpaid terms can be edited
+			if *req.PaymentStatus != Credit && *req.PaymentStatus != Promised {
+				return ErrInvalidPaymentStatus
+			}
+			sale.PaymentStatus = *req.PaymentStatus
+		}
+		if req.DueDate != nil {
+			sale.DueDate = req.DueDate
+		}
+		if req.BuyerName != nil {
+			sale.BuyerName = req.BuyerName
+		}
+		if req.BuyerContact != nil {
+			sale.BuyerContact = req.BuyerContact
+		}
+		if req.BuyerLocation != nil {
+			sale.BuyerLocation = req.BuyerLocation
+		}
+
+		productService := Product.GetProductService()
+		// The stock stays with the branch it was taken from unless the sale changes hands
+		oldBranchID := saleBranchTx(tx, sale.ID, oldProductID, oldSellerID)
+		branchID := oldBranchID
+		if sale.SellerID != oldSellerID {
+			branchID = sellerBranchTx(tx, sale.SellerID)
+		}
+		if sale.ProductID != oldProductID || !sameBranch(oldBranchID, branchID) {
+			// Return the stock to the old product and branch and take it from the new ones
+			if _, err := productService.AdjustQuantityTx(tx, oldProductID, &actor.CompanyID, oldQuantity, actor.returnChange(&sale, oldBranchID)); err != nil {
+				return err
+			}
+			product, movement, err := productService.AdjustStockTx(tx, sale.ProductID, &actor.CompanyID, -sale.Quantity, actor.stockChange(Product.MovementSale, &sale.ID, branchID))
+			if err != nil {
+				return err
+			}
+			sale.UnitCost = *movement.UnitCost
+			sale.CostTotal = sale.UnitCost * float64(sale.Quantity)
+			if sale.ProductID != oldProductID {
+				sale.ProductName = product.Name
+				sale.Currency = product.Currency
+				sale.ListPrice = product.Price
+				sale.UnitPrice = product.Price
+				sale.Discount = 0
+			}
+		} else if sale.Quantity > oldQuantity {
+			// The extra units are costed like a new sale
+			_, movement, err := productService.AdjustStockTx(tx, sale.ProductID, &actor.CompanyID, oldQuantity-sale.Quantity, actor.stockChange(Product.MovementSale, &sale.ID, branchID))
+			if err != nil {
+				return err
+			}
+			sale.CostTotal += *movement.UnitCost * float64(sale.Quantity-oldQuantity)
+			sale.UnitCost = sale.CostTotal / float64(sale.Quantity)
+		} else if sale.Quantity < oldQuantity {
+			// Units given back return to stock at the cost they were sold at
+			if _, err := productService.AdjustQuantityTx(tx, sale.ProductID, &actor.CompanyID, oldQuantity-sale.Quantity, actor.returnChange(&sale, branchID)); err != nil {
+				return err
+			}
+			sale.CostTotal = sale.UnitCost * float64(sale.Quantity)
+		}
+
+		// An overridden price stands until the edit touches what it was priced from
+		keepTotal := sale.PriceOverridden && sale.ProductID == oldProductID && sale.Quantity == oldQuantity &&
+			!pricesDiffer(sale.UnitPrice, oldUnitPrice) && !pricesDiffer(sale.ExtraCosts, oldExtraCosts) && !pricesDiffer(sale.Discount, oldDiscount)
+		if err := applyPricing(&sale, priceInput{
+			UnitPrice:      req.UnitPrice,
+			Discount:       req.Discount,
+			TotalPrice:     req.TotalPrice,
+			OverrideReason: req.OverrideReason,
+			KeepTotal:      keepTotal,
+		}, actor); err != nil {
+			return err
+		}
+
+		if sale.OrderID == nil {
+			if sale.AmountPaid-sale.TotalPrice > priceTolerance {
+				return ErrTotalBelowPaid
+			}
+			sale.PaymentStatus = derivePaymentStatus(sale.TotalPrice, sale.AmountPaid, sale.DueDate, sale.PaymentStatus, time.Now())
+
+			// Keep the linked customer unless the request names another one or gives an unlinked sale a contact
+			customerService := Customer.GetCustomerService()
+			customerID := sale.CustomerID
+			if req.CustomerID != nil {
+				customerID = req.CustomerID
+			}
+			var customer *Customer.Customer
+			if customerID != nil || req.BuyerContact != nil {
+				var err error
+				customer, err = customerService.ResolveCustomerTx(tx, actor.CompanyID, customerID, sale.BuyerName, sale.BuyerContact, sale.BuyerLocation)
+				if err != nil {
+					return err
+				}
+			}
+			// The sale's current balance only counts towards the limit if it was already charged to this customer
+			additionalBalance := sale.TotalPrice - sale.AmountPaid
+			if customer != nil && sale.CustomerID != nil && *sale.CustomerID == customer.ID {
+				additionalBalance -= oldBalance
+			}
+			if err := customerService.CheckCreditLimitTx(tx, customer, additionalBalance); err != nil {
+				return err
+			}
+			sale.CustomerID, sale.BuyerName, sale.BuyerContact, sale.BuyerLocation = customerBuyer(customer, sale.BuyerName, sale.BuyerContact, sale.BuyerLocation)
+		}
+
+		if err := tx.Save(&sale).Error; err != nil {
+			return err
+		}
+		if sale.OrderID != nil {
+			return s.recalculateOrderTx(tx, *sale.OrderID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if req.SellerID != nil {
-		sale.SellerID = *req.SellerID
+
+	return &sale, nil
+}
+
+func (s *SaleService) GetOrderByID(id uint, companyID uint) (*Order, error) {
+	var order Order
+	if err := s.db.Scopes(companyOrders(companyID)).Preload("Items").First(&order, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
 	}
-	if req.PaymentStatus != nil {
-		sale.PaymentStatus = *req.PaymentStatus
+	s.populateOrder(&order)
+	return &order, nil
+}
+
+// ListOrders returns one page of the company's orders matching params, with their lines
+func (s *SaleService) ListOrders(companyID uint, params *Query.Params) ([]*Order, *Query.Page, error) {
+	query := s.db.Model(&Order{}).Scopes(companyOrders(companyID))
+	if branchID := params.Uint("branchId"); branchID != nil {
+		query = query.Scopes(sellerBranch("orders.seller_id", *branchID))
 	}
-	if req.BuyerName != nil {
-		sale.BuyerName = req.BuyerName
+
+	var orders []*Order
+	page, err := Query.Paginate(query, params, &orders, "Items")
+	if err != nil {
+		return nil, nil, err
 	}
-	if req.BuyerContact != nil {
-		sale.BuyerContact = req.BuyerContact
+	s.populateOrders(orders)
+	return orders, page, nil
+}
+
+// CreateOrder records a multi-line sale in one transaction: every line's stock is taken,
+// every line is priced like CreateSale, and the order total adds the order-level
+// extra costs and discount. Lines are stored as Sale rows linked to the order.
+func (s *SaleService) CreateOrder(req CreateOrderRequest, actor SaleActor) (*Order, error) {
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
 	}
-	if req.BuyerLocation != nil {
-		sale.BuyerLocation = req.BuyerLocation
+
+	order := &Order{
+		SellerID:      req.SellerID,
+		ExtraCosts:    req.ExtraCosts,
+		PaymentStatus: req.PaymentStatus,
+		BuyerName:     req.BuyerName,
+		BuyerContact:  req.BuyerContact,
+		BuyerLocation: req.BuyerLocation,
 	}
 
-	if err := s.db.Save(&sale).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lines of products with variants are sold from the variant they name
+		resolved := make([]*Sale, len(req.Items))
+		for i, item := range req.Items {
+			resolved[i] = &Sale{ProductID: item.ProductID, ProductAttributes: JSONB(item.ProductAttributes)}
+			if err := resolveVariantTx(tx, resolved[i], item.VariantID, actor); err != nil {
+				return err
+			}
+		}
+
+		// Lock products in product ID order so concurrent orders lock rows in the same sequence.
+		// The stock is taken once the lines have IDs for the ledger.
+		lockOrder := make([]int, len(req.Items))
+		for i := range lockOrder {
+			lockOrder[i] = i
+		}
+		sort.SliceStable(lockOrder, func(a, b int) bool {
+			return resolved[lockOrder[a]].ProductID < resolved[lockOrder[b]].ProductID
+		})
+
+		products := make([]*Product.Product, len(req.Items))
+		for _, i := range lockOrder {
+			product, err := Product.GetProductService().LockProductTx(tx, resolved[i].ProductID, &actor.CompanyID)
+			if err != nil {
+				return err
+			}
+			products[i] = product
+		}
+
+		order.Items = make([]*Sale, len(req.Items))
+		for i, item := range req.Items {
+			product := products[i]
+			if order.Currency == "" {
+				order.Currency = product.Currency
+			} else if order.Currency != product.Currency {
+				return ErrMixedCurrencies
+			}
+
+			line := &Sale{
+				ProductID:         product.ID,
+				ParentProductID:   resolved[i].ParentProductID,
+				ProductName:       product.Name,
+				ProductAttributes: resolved[i].ProductAttributes,
+				Quantity:          item.Quantity,
+				ListPrice:         product.Price,
+				UnitPrice:         product.Price,
+				Currency:          product.Currency,
+				SellerID:          req.SellerID,
+				PaymentStatus:     req.PaymentStatus,
+				BuyerName:         req.BuyerName,
+				BuyerContact:      req.BuyerContact,
+				BuyerLocation:     req.BuyerLocation,
+			}
+			if line.ProductAttributes == nil {
+				line.ProductAttributes = make(JSONB)
+			}
+			if err := applyPricing(line, priceInput{
+				UnitPrice:      item.UnitPrice,
+				Discount:       item.Discount,
+				TotalPrice:     item.TotalPrice,
+				OverrideReason: req.OverrideReason,
+			}, actor); err != nil {
+				return err
+			}
+			order.Items[i] = line
+		}
+
+		if err := applyOrderPricing(order, req.Discount, req.OverrideReason, actor); err != nil {
+			return err
+		}
+
+		amountPaid, err := openingPayment(req.PaymentStatus, req.AmountPaid, req.PaymentMethod, order.TotalPrice)
+		if err != nil {
+			return err
+		}
+		order.AmountPaid = amountPaid
+		order.DueDate = req.DueDate
+		order.PaymentStatus = derivePaymentStatus(order.TotalPrice, order.AmountPaid, order.DueDate, req.PaymentStatus, time.Now())
+
+		customer, err := Customer.GetCustomerService().ResolveCustomerTx(tx, actor.CompanyID, req.CustomerID, req.BuyerName, req.BuyerContact, req.BuyerLocation)
+		if err != nil {
+			return err
+		}
+		if err := Customer.GetCustomerService().CheckCreditLimitTx(tx, customer, order.TotalPrice-order.AmountPaid); err != nil {
+			return err
+		}
+		order.CustomerID, order.BuyerName, order.BuyerContact, order.BuyerLocation = customerBuyer(customer, order.BuyerName, order.BuyerContact, order.BuyerLocation)
+
+		for _, line := range order.Items {
+			line.PaymentStatus = order.PaymentStatus
+			line.CustomerID = order.CustomerID
+			line.BuyerName = order.BuyerName
+			line.BuyerContact = order.BuyerContact
+			line.BuyerLocation = order.BuyerLocation
+		}
+		if order.ReceiptNumber, err = issueReceiptNumberTx(tx, actor.BranchID); err != nil {
+			return err
+		}
+
+		// Creates the order and its lines (with OrderID set) together
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		for _, i := range lockOrder {
+			line := order.Items[i]
+			_, movement, err := Product.GetProductService().AdjustStockTx(tx, line.ProductID, &actor.CompanyID, -line.Quantity, actor.stockChange(Product.MovementSale, &line.ID, actor.BranchID))
+			if err != nil {
+				return err
+			}
+			if err := snapshotCostTx(tx, line, movement); err != nil {
+				return err
+			}
+			order.CostTotal += line.CostTotal
+		}
+		if err := tx.Model(order).Update("cost_total", order.CostTotal).Error; err != nil {
+			return err
+		}
+		if amountPaid > 0 {
+			return tx.Create(openingPaymentRow(amountPaid, req.PaymentMethod, order.Currency, nil, &order.ID, actor)).Error
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &sale, nil
+	s.populateOrder(order)
+	return order, nil
 }
 
-func (s *SaleService) DeleteSale(id uint) error {
-	var sale Sale
-	if err := s.db.First(&sale, "id = ?", id).Error; err != nil {
+// resolveVariantTx points sale at the variant its product and attributes (or variantID) pick,
+// and fills in the variant's attributes
+func resolveVariantTx(tx *gorm.DB, sale *Sale, variantID *uint, actor SaleActor) error {
+	product, attributes, err := Product.GetProductService().ResolveVariantTx(tx, actor.CompanyID, sale.ProductID, variantID, sale.ProductAttributes)
+	if err != nil {
+		return err
+	}
+	sale.ProductID = product.ID
+	sale.ParentProductID = product.ParentID
+	sale.ProductAttributes = JSONB(attributes)
+	if sale.ProductAttributes == nil {
+		sale.ProductAttributes = make(JSONB)
+	}
+	return nil
+}
+
+// snapshotCostTx stores the cost of the stock a new sale took
+func snapshotCostTx(tx *gorm.DB, sale *Sale, movement *Product.StockMovement) error {
+	sale.UnitCost = *movement.UnitCost
+	sale.CostTotal = sale.UnitCost * float64(sale.Quantity)
+	return tx.Model(sale).Updates(map[string]interface{}{
+		"unit_cost":  sale.UnitCost,
+		"cost_total": sale.CostTotal,
+	}).Error
+}
+
+// sellerBranchTx returns the branch of a sale's seller, which holds the stock the sale takes
+func sellerBranchTx(tx *gorm.DB, sellerID uint) *uint {
+	var branchIDs []*uint
+	if err := tx.Table("user_models").Where("id = ?", sellerID).Pluck("branch_id", &branchIDs).Error; err != nil || len(branchIDs) == 0 {
+		return nil
+	}
+	return branchIDs[0]
+}
+
+// saleBranchTx returns the branch a sale's stock of productID was last taken from, as
+// booked on its sale movement, or its seller's branch when no movement names a branch
+func saleBranchTx(tx *gorm.DB, saleID uint, productID uint, sellerID uint) *uint {
+	if branchID := movementBranchTx(tx, "reference_id = ? AND product_id = ?", saleID, productID); branchID != nil {
+		return branchID
+	}
+	return sellerBranchTx(tx, sellerID)
+}
+
+// movementBranchTx returns the branch of the latest sale movement matching query, or nil
+// when none names a branch
+func movementBranchTx(tx *gorm.DB, query string, args ...interface{}) *uint {
+	var branchIDs []*uint
+	if err := tx.Model(&Product.StockMovement{}).
+		Where("reason = ? AND branch_id IS NOT NULL", Product.MovementSale).
+		Where(query, args...).
+		Order("id DESC").
+		Limit(1).
+		Pluck("branch_id", &branchIDs).Error; err != nil || len(branchIDs) == 0 {
+		return nil
+	}
+	return branchIDs[0]
+}
+
+func sameBranch(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// recalculateOrderTx re-totals an order after one of its lines was edited or deleted
+func (s *SaleService) recalculateOrderTx(tx *gorm.DB, orderID uint) error {
+	var order Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, "id = ?", orderID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return errors.New("sale not found")
+			return ErrOrderNotFound
 		}
 		return err
 	}
-	if err := s.db.Delete(&sale).Error; err != nil {
+
+	order.Subtotal = 0
+	order.CostTotal = 0
+	for _, item := range order.Items {
+		order.Subtotal += item.TotalPrice
+		order.CostTotal += item.CostTotal
+	}
+	order.TotalPrice = order.Subtotal + order.ExtraCosts - order.Discount
+	if order.AmountPaid-order.TotalPrice > priceTolerance {
+		return ErrTotalBelowPaid
+	}
+	order.PaymentStatus = derivePaymentStatus(order.TotalPrice, order.AmountPaid, order.DueDate, order.PaymentStatus, time.Now())
+
+	if err := tx.Model(&order).Updates(map[string]interface{}{
+		"subtotal":       order.Subtotal,
+		"total_price":    order.TotalPrice,
+		"cost_total":     order.CostTotal,
+		"payment_status": order.PaymentStatus,
+	}).Error; err != nil {
 		return err
 	}
-	return nil
+	return tx.Model(&Sale{}).Where("order_id = ?", order.ID).Update("payment_status", order.PaymentStatus).Error
 }
 
-// populateSeller populates seller information from FK relationship
-func (s *SaleService) populateSeller(sale *Sale) {
-	if sale.SellerID == 0 {
-		return
+// companySales limits a sales query to sales made by sellers of the company
+func companySales(companyID uint) func(*gorm.DB) *gorm.DB {
+	return User.CompanyUserScope("sales.seller_id", companyID)
+}
+
+// companyOrders limits an orders query to orders made by sellers of the company
+func companyOrders(companyID uint) func(*gorm.DB) *gorm.DB {
+	return User.CompanyUserScope("orders.seller_id", companyID)
+}
+
+// sellerBranch limits a query to rows whose seller works at branchID
+func sellerBranch(column string, branchID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN (SELECT id FROM user_models WHERE branch_id = ?)", branchID)
 	}
-	
-	user, err := User.GetUserService().GetUserByID(sale.SellerID)
-	if err == nil && user != nil {
-		sale.Seller = &UserResponse{
-			ID:   user.ID,
-			Name: user.Name,
-		}
-		// Populate branch from seller's branch
-		if user.BranchID != nil {
-			var branch Branch.Branch
-			if err := s.db.First(&branch, "id = ?", *user.BranchID).Error; err == nil {
-				sale.Branch = &BranchResponse{
-					ID:   branch.ID,
-					Name: branch.Name,
-				}
-			}
+}
+
+// customerBuyer links the buyer fields to customer, filling in any the request left empty
+func customerBuyer(customer *Customer.Customer, name, contact, location *string) (*uint, *string, *string, *string) {
+	if customer == nil {
+		return nil, name, contact, location
+	}
+	customerID := customer.ID
+	if name == nil {
+		name = &customer.Name
+	}
+	if contact == nil {
+		contact = customer.Contact
+	}
+	if location == nil {
+		location = customer.Location
+	}
+	return &customerID, name, contact, location
+}
+
+// populateSale populates seller/branch information and the computed payment fields
+func (s *SaleService) populateSale(sale *Sale) {
+	s.PopulateSales([]*Sale{sale})
+}
+
+// PopulateSales populates seller/branch information and the computed payment fields of
+// many sales, loading every seller with one query
+func (s *SaleService) PopulateSales(sales []*Sale) {
+	sellerIDs := make([]uint, 0, len(sales))
+	for _, sale := range sales {
+		sellerIDs = append(sellerIDs, sale.SellerID)
+	}
+	sellers := s.loadSellers(sellerIDs)
+	now := time.Now()
+	for _, sale := range sales {
+		sale.Seller, sale.Branch = sellers.responses(sale.SellerID)
+		populateBalance(sale, now)
+	}
+}
+
+// populateOrder populates seller and branch information on an order and its lines
+func (s *SaleService) populateOrder(order *Order) {
+	s.populateOrders([]*Order{order})
+}
+
+// populateOrders populates seller and branch information on many orders and their lines,
+// loading every seller with one query
+func (s *SaleService) populateOrders(orders []*Order) {
+	sellerIDs := make([]uint, 0, len(orders))
+	for _, order := range orders {
+		sellerIDs = append(sellerIDs, order.SellerID)
+	}
+	sellers := s.loadSellers(sellerIDs)
+	now := time.Now()
+	for _, order := range orders {
+		populateOrderBalance(order, now)
+		order.Seller, order.Branch = sellers.responses(order.SellerID)
+		for _, item := range order.Items {
+			item.Seller = order.Seller
+			item.Branch = order.Branch
+		}
+	}
+}
+
+// sellerSummaries are the sellers of a batch of sales or orders, keyed by user id
+type sellerSummaries map[uint]*User.UserSummary
+
+// loadSellers loads the sellers of ids and their branches. Sellers that cannot be
+// loaded are left out, so their sales are returned without seller information.
+func (s *SaleService) loadSellers(ids []uint) sellerSummaries {
+	unique := make([]uint, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
 		}
 	}
+	summaries, err := User.GetUserService().GetUserSummaries(unique)
+	if err != nil {
+		return sellerSummaries{}
+	}
+	return summaries
+}
+
+// responses returns the seller and branch of a sale or order made by sellerID
+func (s sellerSummaries) responses(sellerID uint) (*UserResponse, *BranchResponse) {
+	seller, ok := s[sellerID]
+	if !ok {
+		return nil, nil
+	}
+	var branch *BranchResponse
+	if seller.BranchID != nil && seller.BranchName != nil {
+		branch = &BranchResponse{ID: *seller.BranchID, Name: *seller.BranchName}
+	}
+	return &UserResponse{ID: seller.ID, Name: seller.Name}, branch
 }
 
 // GetCompanyIDFromSale returns the company ID for a given sale
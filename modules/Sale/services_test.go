@@ -0,0 +1,137 @@
+package Sale
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a throwaway database with the sale tables and initializes the services on it
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t,
+		&Notification.Notification{}, &Idempotency.IdempotencyKey{},
+		&Product.Category{}, &Product.Product{}, &Product.StockMovement{}, &Product.CostLayer{},
+		&Product.ProductBarcode{}, &Product.BranchStock{}, &Customer.Customer{},
+		&Order{}, &Sale{}, &Payment{}, &SaleReturn{}, &ReceiptSequence{},
+	)
+	Notification.InitializeService(db)
+	Idempotency.InitializeService(db)
+	Product.InitializeService(db)
+	Customer.InitializeService(db)
+	InitializeService(db)
+	return db
+}
+
+// newSale records a paid sale by seller directly, without touching stock
+func newSale(t testing.TB, db *gorm.DB, seller *User.UserModel) *Sale {
+	t.Helper()
+	sale := &Sale{
+		ProductID:     1,
+		ProductName:   "Widget",
+		Quantity:      1,
+		UnitPrice:     10,
+		TotalPrice:    10,
+		AmountPaid:    10,
+		Currency:      "UGX",
+		SellerID:      seller.ID,
+		PaymentStatus: Paid,
+	}
+	if err := db.Create(sale).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sale
+}
+
+// Listing sales loads their sellers in one query, so a page of many sales from many
+// sellers costs no more queries than a page of one
+func TestListSalesQueryCount(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	r := Testutil.NewRouter(RegisterRoutes)
+
+	list := func() int {
+		return Testutil.CountQueries(t, db, func() {
+			if w := Testutil.Serve(r, http.MethodGet, "/api/v1/sales", a.Token); w.Code != http.StatusOK {
+				t.Fatalf("GET /sales: %d %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	newSale(t, db, a.Owner)
+	one := list()
+	for i := 0; i < 10; i++ {
+		newSale(t, db, Testutil.NewUser(t, db, a.Branch, fmt.Sprintf("a-seller-%d", i), User.Cashier))
+	}
+	if many := list(); many != one {
+		t.Errorf("listing 11 sales ran %d queries, listing 1 ran %d", many, one)
+	}
+}
+
+// Listing a sale's payments loads everyone who received them in one query
+func TestSalePaymentsQueryCount(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	r := Testutil.NewRouter(RegisterRoutes)
+	sale := newSale(t, db, a.Owner)
+	path := fmt.Sprintf("/api/v1/sales/%d/payments", sale.ID)
+
+	list := func() int {
+		return Testutil.CountQueries(t, db, func() {
+			if w := Testutil.Serve(r, http.MethodGet, path, a.Token); w.Code != http.StatusOK {
+				t.Fatalf("GET %s: %d %s", path, w.Code, w.Body)
+			}
+		})
+	}
+	pay := func(receiver *User.UserModel) {
+		payment := &Payment{SaleID: &sale.ID, Amount: 1, Currency: "UGX", Method: Cash, PaidAt: sale.CreatedAt, ReceivedByID: receiver.ID}
+		if err := db.Create(payment).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pay(a.Owner)
+	one := list()
+	for i := 0; i < 10; i++ {
+		pay(Testutil.NewUser(t, db, a.Branch, fmt.Sprintf("a-cashier-%d", i), User.Cashier))
+	}
+	if many := list(); many != one {
+		t.Errorf("listing 11 payments ran %d queries, listing 1 ran %d", many, one)
+	}
+}
+
+// BenchmarkListSales lists a page of sales from as many sellers. The queries per list,
+// reported as queries/op, stay the same from 1 row to 100.
+func BenchmarkListSales(b *testing.B) {
+	for _, rows := range []int{1, 100} {
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			db := newTestDB(b)
+			a := Testutil.NewTenant(b, db, "a")
+			r := Testutil.NewRouter(RegisterRoutes)
+			newSale(b, db, a.Owner)
+			for i := 1; i < rows; i++ {
+				newSale(b, db, Testutil.NewUser(b, db, a.Branch, fmt.Sprintf("a-seller-%d", i), User.Cashier))
+			}
+			list := func() {
+				if w := Testutil.Serve(r, http.MethodGet, "/api/v1/sales?limit=100", a.Token); w.Code != http.StatusOK {
+					b.Fatalf("GET /sales: %d %s", w.Code, w.Body)
+				}
+			}
+
+			queries := Testutil.CountQueries(b, db, list)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				list()
+			}
+			b.ReportMetric(float64(queries), "queries/op")
+		})
+	}
+}
@@ -115,13 +115,16 @@ func (s *SSEService) BroadcastSaleEvent(companyID uint, saleEvent SaleEvent) {
 
 // SaleEvent represents a sale event to be broadcast
 type SaleEvent struct {
-	Type      string  `json:"type"` // "new_sale"
+	Type      string  `json:"type"` // "new_sale", "new_order", "sale_voided" or "sale_returned"
 	SaleID    uint    `json:"saleId"`
+	OrderID   uint    `json:"orderId,omitempty"`
+	ItemCount int     `json:"itemCount,omitempty"`
 	ProductName string `json:"productName"`
 	Quantity   int    `json:"quantity"`
 	TotalPrice float64 `json:"totalPrice"`
 	Currency   string  `json:"currency"`
 	SellerName string  `json:"sellerName"`
 	BranchName string  `json:"branchName,omitempty"`
+	Reason     string  `json:"reason,omitempty"` // Why a sale was voided or returned
 	CreatedAt  string  `json:"createdAt"`
 }
@@ -0,0 +1,94 @@
+package StockTake
+
+import (
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	"gorm.io/gorm"
+)
+
+type StockTakeStatus string
+
+const (
+	Open      StockTakeStatus = "open"      // Staff are counting
+	Submitted StockTakeStatus = "submitted" // Counting finished, awaiting approval
+	Approved  StockTakeStatus = "approved"  // Variances posted to stock
+	Cancelled StockTakeStatus = "cancelled"
+)
+
+// StockTake is a physical count of a branch's stock, reconciled with the system quantities
+type StockTake struct {
+	gorm.Model
+	CompanyID uint            `json:"companyId" gorm:"not null;index"`
+	BranchID  uint            `json:"branchId" gorm:"not null;index"`
+	Status    StockTakeStatus `json:"status" gorm:"not null;default:'open';index"`
+	Notes     *string         `json:"notes,omitempty"`
+
+	CreatedByID   uint       `json:"createdById" gorm:"not null"`
+	SubmittedByID *uint      `json:"submittedById,omitempty"`
+	SubmittedAt   *time.Time `json:"submittedAt,omitempty"`
+	ApprovedByID  *uint      `json:"approvedById,omitempty"`
+	ApprovedAt    *time.Time `json:"approvedAt,omitempty"`
+	CancelledByID *uint      `json:"cancelledById,omitempty"`
+	CancelledAt   *time.Time `json:"cancelledAt,omitempty"`
+
+	// Ledger reason and explanation the variances were posted with
+	AdjustmentReason *Product.MovementReason `json:"adjustmentReason,omitempty"`
+	AdjustmentNotes  *string                 `json:"adjustmentNotes,omitempty"`
+
+	Items []*StockTakeItem `json:"items" gorm:"foreignKey:StockTakeID"`
+
+	// Variance totals (for JSON response - computed from the items)
+	CountedItems  int `json:"countedItems" gorm:"-"`
+	TotalVariance int `json:"totalVariance" gorm:"-"`
+
+	// Relationship (for JSON response - computed from FK)
+	Branch *BranchResponse `json:"branch,omitempty" gorm:"-"`
+}
+
+// StockTakeItem is the count of one product. SystemQuantity is the branch's stock when the
+// line was last counted, so sales made while counting do not show up as variance.
+type StockTakeItem struct {
+	gorm.Model
+	StockTakeID     uint       `json:"stockTakeId" gorm:"not null;index"`
+	ProductID       uint       `json:"productId" gorm:"not null;index"`
+	ProductName     string     `json:"productName" gorm:"not null"`
+	SystemQuantity  int        `json:"systemQuantity" gorm:"not null"`
+	CountedQuantity *int       `json:"countedQuantity,omitempty"` // Nil until counted
+	Variance        int        `json:"variance" gorm:"default:0"` // CountedQuantity - SystemQuantity; negative when stock is missing
+	CountedByID     *uint      `json:"countedById,omitempty"`
+	CountedAt       *time.Time `json:"countedAt,omitempty"`
+	Note            *string    `json:"note,omitempty"`
+	MovementID      *uint      `json:"movementId,omitempty"` // Ledger entry the variance was posted as
+}
+
+// BranchResponse is used for JSON serialization
+type BranchResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	AdminUserID *uint  `json:"adminUserId,omitempty"`
+}
+
+// CreateStockTakeRequest opens a session. Without productIds every product of the company is listed.
+type CreateStockTakeRequest struct {
+	BranchID   *uint   `json:"branchId,omitempty"` // Defaults to the caller's branch
+	ProductIDs []uint  `json:"productIds,omitempty"`
+	Notes      *string `json:"notes,omitempty"`
+}
+
+// CountRequest is the counted quantity of one product. Products not yet on the session are added.
+type CountRequest struct {
+	ProductID       uint    `json:"productId" binding:"required"`
+	CountedQuantity int     `json:"countedQuantity"`
+	Note            *string `json:"note,omitempty"`
+}
+
+type SubmitCountsRequest struct {
+	Counts []CountRequest `json:"counts" binding:"required,min=1,dive"`
+}
+
+// ApproveStockTakeRequest posts the variances with a ledger reason, which defaults to adjustment
+type ApproveStockTakeRequest struct {
+	Reason *Product.MovementReason `json:"reason,omitempty"`
+	Notes  string                  `json:"notes" binding:"required"`
+}
@@ -0,0 +1,274 @@
+package StockTake
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+func RegisterRoutes(rg *gin.RouterGroup) {
+	stockTakes := rg.Group("/stock-takes")
+	{
+		stockTakes.GET("", User.RequirePermission(User.PermStockTakesRead), getStockTakesHandler)
+		stockTakes.GET("/:id", User.RequirePermission(User.PermStockTakesRead), getStockTakeHandler)
+		stockTakes.POST("", User.RequirePermission(User.PermStockTakesCount), createStockTakeHandler)
+		stockTakes.POST("/:id/counts", User.RequirePermission(User.PermStockTakesCount), submitCountsHandler)
+		stockTakes.POST("/:id/submit", User.RequirePermission(User.PermStockTakesCount), submitStockTakeHandler)
+		stockTakes.POST("/:id/approve", User.RequirePermission(User.PermStockTakesApprove), approveStockTakeHandler)
+		stockTakes.POST("/:id/cancel", User.RequirePermission(User.PermStockTakesApprove), cancelStockTakeHandler)
+	}
+}
+
+// stockTakeListSpec is what GET /stock-takes sorts and filters by
+var stockTakeListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"createdAt": "created_at",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId": {Column: "branch_id", Kind: Query.UintFilter},
+		"status":   {Column: "status"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"notes"},
+}
+
+// getStockTakesHandler lists the company's stock-takes. Branch-limited roles only see
+// their own branch's.
+func getStockTakesHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, stockTakeListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	stockTakes, page, err := GetStockTakeService().ListStockTakes(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stockTakes": stockTakes, "page": page})
+}
+
+func getStockTakeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	stockTake, ok := visibleStockTake(c, companyID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, stockTake)
+}
+
+func createStockTakeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreateStockTakeRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID, branchID := callerFromContext(c)
+	if req.BranchID != nil {
+		branchID = req.BranchID
+	}
+	if branchID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId is required"})
+		return
+	}
+	if !User.CanAccessBranch(c, *branchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	stockTake, err := GetStockTakeService().CreateStockTake(companyID, userID, *branchID, req)
+	if err != nil {
+		stockTakeErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, stockTake)
+}
+
+// submitCountsHandler records counted quantities; it can be called as often as needed while the stock-take is open
+func submitCountsHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req SubmitCountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, ok := visibleStockTake(c, companyID)
+	if !ok {
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	stockTake, err := GetStockTakeService().SubmitCounts(existing.ID, companyID, userID, req)
+	if err != nil {
+		stockTakeErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stockTake)
+}
+
+func submitStockTakeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visibleStockTake(c, companyID)
+	if !ok {
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	stockTake, err := GetStockTakeService().SubmitStockTake(existing.ID, companyID, userID)
+	if err != nil {
+		stockTakeErrorResponse(c, err)
+		return
+	}
+
+	notifyBranchAdmin(stockTake, "Stock-Take Submitted", fmt.Sprintf("Stock-take #%d at %s is ready for approval: %d products counted, variance %+d units", stockTake.ID, branchName(stockTake.Branch), stockTake.CountedItems, stockTake.TotalVariance))
+	c.JSON(http.StatusOK, stockTake)
+}
+
+func approveStockTakeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req ApproveStockTakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, ok := visibleStockTake(c, companyID)
+	if !ok {
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	stockTake, err := GetStockTakeService().ApproveStockTake(existing.ID, companyID, userID, req)
+	if err != nil {
+		stockTakeErrorResponse(c, err)
+		return
+	}
+
+	notifyBranchAdmin(stockTake, "Stock-Take Approved", fmt.Sprintf("Stock-take #%d at %s was approved and %+d units were posted to stock", stockTake.ID, branchName(stockTake.Branch), stockTake.TotalVariance))
+	c.JSON(http.StatusOK, stockTake)
+}
+
+func cancelStockTakeHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visibleStockTake(c, companyID)
+	if !ok {
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	stockTake, err := GetStockTakeService().CancelStockTake(existing.ID, companyID, userID)
+	if err != nil {
+		stockTakeErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stockTake)
+}
+
+// visibleStockTake loads the stock-take named by the :id parameter. Stock-takes of other
+// companies, or of another branch than a branch-limited caller's, are not found.
+func visibleStockTake(c *gin.Context, companyID uint) (*StockTake, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stock-take id"})
+		return nil, false
+	}
+
+	stockTake, err := GetStockTakeService().GetStockTakeByID(uint(id), companyID)
+	if err != nil || !User.CanAccessBranch(c, stockTake.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrStockTakeNotFound.Error(), "code": "STOCK_TAKE_NOT_FOUND"})
+		return nil, false
+	}
+	return stockTake, true
+}
+
+// callerFromContext returns the authenticated user and their branch
+func callerFromContext(c *gin.Context) (uint, *uint) {
+	userID, _ := c.Get("user_id")
+	userIDUint, _ := userID.(uint)
+	branchID, _ := c.Get("branch_id")
+	branchIDPtr, _ := branchID.(*uint)
+	return userIDUint, branchIDPtr
+}
+
+// notifyBranchAdmin sends an inventory notification to the admin of the stock-take's branch
+func notifyBranchAdmin(stockTake *StockTake, title string, message string) {
+	notificationService := Notification.GetNotificationService()
+	if notificationService == nil || stockTake.Branch == nil || stockTake.Branch.AdminUserID == nil {
+		return
+	}
+
+	stockTakeID := stockTake.ID
+	_, _ = notificationService.CreateNotification(Notification.CreateNotificationRequest{
+		UserID:    *stockTake.Branch.AdminUserID,
+		Type:      Notification.NotificationTypeInventory,
+		Title:     title,
+		Message:   message,
+		RelatedID: &stockTakeID,
+	})
+}
+
+func branchName(branch *BranchResponse) string {
+	if branch == nil {
+		return "a branch"
+	}
+	return branch.Name
+}
+
+// stockTakeErrorResponse writes a service error with its status and code
+func stockTakeErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrStockTakeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "STOCK_TAKE_NOT_FOUND"})
+	case errors.Is(err, ErrBranchNotFound), errors.Is(err, Product.ErrBranchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "BRANCH_NOT_FOUND"})
+	case errors.Is(err, Product.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PRODUCT_NOT_FOUND"})
+	case errors.Is(err, ErrStockTakeInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "STOCK_TAKE_IN_PROGRESS"})
+	case errors.Is(err, Product.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INSUFFICIENT_STOCK"})
+	case errors.Is(err, ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_TRANSITION"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,362 @@
+package StockTake
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var stockTakeService *StockTakeService
+
+var (
+	// ErrStockTakeNotFound is returned when a stock-take does not exist in the caller's company
+	ErrStockTakeNotFound = errors.New("stock-take not found")
+	// ErrBranchNotFound is returned when the branch is not in the caller's company
+	ErrBranchNotFound = errors.New("branch not found")
+	// ErrStockTakeInProgress is returned when the branch already has an open or submitted stock-take
+	ErrStockTakeInProgress = errors.New("branch already has a stock-take in progress")
+	// ErrInvalidCount is returned for negative counted quantities
+	ErrInvalidCount = errors.New("counted quantity cannot be negative")
+	// ErrNothingCounted is returned when a stock-take without any counted line is submitted
+	ErrNothingCounted = errors.New("no products have been counted")
+	// ErrInvalidReason is returned for adjustment reasons other than adjustment, damage or return
+	ErrInvalidReason = errors.New("reason must be adjustment, damage or return")
+	// ErrInvalidTransition is returned when a stock-take is not in the status an action needs
+	ErrInvalidTransition = errors.New("stock-take cannot be changed in its current status")
+)
+
+type StockTakeService struct {
+	db *gorm.DB
+}
+
+func NewStockTakeService() *StockTakeService {
+	return &StockTakeService{}
+}
+
+// InitializeService initializes the stock-take service with a database connection
+func InitializeService(db *gorm.DB) {
+	stockTakeService = &StockTakeService{db: db}
+}
+
+// GetStockTakeService returns the initialized stock-take service
+func GetStockTakeService() *StockTakeService {
+	return stockTakeService
+}
+
+func (s *StockTakeService) GetStockTakeByID(id uint, companyID uint) (*StockTake, error) {
+	var stockTake StockTake
+	if err := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("product_name")
+	}).Where("company_id = ?", companyID).First(&stockTake, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrStockTakeNotFound
+		}
+		return nil, err
+	}
+	s.populate(&stockTake)
+	return &stockTake, nil
+}
+
+// ListStockTakes returns one page of the company's stock-takes matching params
+func (s *StockTakeService) ListStockTakes(companyID uint, params *Query.Params) ([]*StockTake, *Query.Page, error) {
+	query := s.db.Model(&StockTake{}).Where("company_id = ?", companyID)
+
+	var stockTakes []*StockTake
+	page, err := Query.Paginate(query, params, &stockTakes, "Items")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, stockTake := range stockTakes {
+		s.populate(stockTake)
+	}
+	return stockTakes, page, nil
+}
+
+// CreateStockTake opens a stock-take at branchID listing req.ProductIDs, or every product
+// of the company, with the branch's current quantities
+func (s *StockTakeService) CreateStockTake(companyID uint, userID uint, branchID uint, req CreateStockTakeRequest) (*StockTake, error) {
+	if _, err := User.GetBranchService().GetBranchByID(branchID, companyID); err != nil {
+		return nil, ErrBranchNotFound
+	}
+
+	stockTake := &StockTake{
+		CompanyID:   companyID,
+		BranchID:    branchID,
+		Status:      Open,
+		Notes:       req.Notes,
+		CreatedByID: userID,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Two sessions at once would post the same variance twice
+		var inProgress int64
+		if err := tx.Model(&StockTake{}).
+			Where("branch_id = ? AND status IN ?", branchID, []StockTakeStatus{Open, Submitted}).
+			Count(&inProgress).Error; err != nil {
+			return err
+		}
+		if inProgress > 0 {
+			return ErrStockTakeInProgress
+		}
+
+		query := tx.Where("company_id = ?", companyID)
+		if len(req.ProductIDs) > 0 {
+			query = query.Where("id IN ?", req.ProductIDs)
+		}
+		var products []*Product.Product
+		if err := query.Order("name").Find(&products).Error; err != nil {
+			return err
+		}
+		if len(req.ProductIDs) > 0 && len(products) != len(uniqueIDs(req.ProductIDs)) {
+			return Product.ErrProductNotFound
+		}
+
+		for _, product := range products {
+			quantity, err := Product.GetProductService().BranchQuantityTx(tx, product.ID, branchID)
+			if err != nil {
+				return err
+			}
+			stockTake.Items = append(stockTake.Items, &StockTakeItem{
+				ProductID:      product.ID,
+				ProductName:    product.Name,
+				SystemQuantity: quantity,
+			})
+		}
+		return tx.Create(stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.populate(stockTake)
+	return stockTake, nil
+}
+
+// SubmitCounts records counted quantities on an open stock-take. Counting a line again
+// replaces the earlier count, and the system quantity is read again at the same moment.
+func (s *StockTakeService) SubmitCounts(id uint, companyID uint, userID uint, req SubmitCountsRequest) (*StockTake, error) {
+	for _, count := range req.Counts {
+		if count.CountedQuantity < 0 {
+			return nil, ErrInvalidCount
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stockTake, err := s.lockStockTakeTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if stockTake.Status != Open {
+			return ErrInvalidTransition
+		}
+
+		lines := make(map[uint]*StockTakeItem, len(stockTake.Items))
+		for _, item := range stockTake.Items {
+			lines[item.ProductID] = item
+		}
+
+		now := time.Now()
+		for _, count := range req.Counts {
+			item, ok := lines[count.ProductID]
+			if !ok {
+				// Stock found that the session did not list
+				var product Product.Product
+				if err := tx.Where("company_id = ?", companyID).First(&product, "id = ?", count.ProductID).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return Product.ErrProductNotFound
+					}
+					return err
+				}
+				item = &StockTakeItem{StockTakeID: stockTake.ID, ProductID: product.ID, ProductName: product.Name}
+				lines[product.ID] = item
+			}
+
+			system, err := Product.GetProductService().BranchQuantityTx(tx, item.ProductID, stockTake.BranchID)
+			if err != nil {
+				return err
+			}
+			counted := count.CountedQuantity
+			item.SystemQuantity = system
+			item.CountedQuantity = &counted
+			item.Variance = counted - system
+			item.CountedByID = &userID
+			item.CountedAt = &now
+			if count.Note != nil {
+				item.Note = count.Note
+			}
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStockTakeByID(id, companyID)
+}
+
+// SubmitStockTake closes counting and hands the stock-take to a manager for approval
+func (s *StockTakeService) SubmitStockTake(id uint, companyID uint, userID uint) (*StockTake, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stockTake, err := s.lockStockTakeTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if stockTake.Status != Open {
+			return ErrInvalidTransition
+		}
+		counted := false
+		for _, item := range stockTake.Items {
+			if item.CountedQuantity != nil {
+				counted = true
+				break
+			}
+		}
+		if !counted {
+			return ErrNothingCounted
+		}
+
+		now := time.Now()
+		stockTake.Status = Submitted
+		stockTake.SubmittedByID = &userID
+		stockTake.SubmittedAt = &now
+		return tx.Omit("Items").Save(stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStockTakeByID(id, companyID)
+}
+
+// ApproveStockTake posts each counted line's variance to the branch's stock as a ledger
+// movement. Lines that were not counted are left alone.
+func (s *StockTakeService) ApproveStockTake(id uint, companyID uint, userID uint, req ApproveStockTakeRequest) (*StockTake, error) {
+	reason := Product.MovementAdjustment
+	if req.Reason != nil {
+		reason = *req.Reason
+	}
+	if reason != Product.MovementAdjustment && reason != Product.MovementDamage && reason != Product.MovementReturn {
+		return nil, ErrInvalidReason
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stockTake, err := s.lockStockTakeTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if stockTake.Status != Submitted {
+			return ErrInvalidTransition
+		}
+
+		notes := fmt.Sprintf("Stock-take #%d: %s", stockTake.ID, req.Notes)
+		for _, item := range sortedItems(stockTake) {
+			if item.CountedQuantity == nil || item.Variance == 0 {
+				continue
+			}
+			_, movement, err := Product.GetProductService().AdjustStockTx(tx, item.ProductID, &companyID, item.Variance, Product.StockChange{
+				Reason:      reason,
+				ReferenceID: &stockTake.ID,
+				UserID:      &userID,
+				BranchID:    &stockTake.BranchID,
+				Notes:       &notes,
+			})
+			if err != nil {
+				return err
+			}
+			item.MovementID = &movement.ID
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		stockTake.Status = Approved
+		stockTake.ApprovedByID = &userID
+		stockTake.ApprovedAt = &now
+		stockTake.AdjustmentReason = &reason
+		stockTake.AdjustmentNotes = &req.Notes
+		return tx.Omit("Items").Save(stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStockTakeByID(id, companyID)
+}
+
+// CancelStockTake abandons an open or submitted stock-take without touching stock
+func (s *StockTakeService) CancelStockTake(id uint, companyID uint, userID uint) (*StockTake, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stockTake, err := s.lockStockTakeTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if stockTake.Status != Open && stockTake.Status != Submitted {
+			return ErrInvalidTransition
+		}
+
+		now := time.Now()
+		stockTake.Status = Cancelled
+		stockTake.CancelledByID = &userID
+		stockTake.CancelledAt = &now
+		return tx.Omit("Items").Save(stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetStockTakeByID(id, companyID)
+}
+
+func (s *StockTakeService) lockStockTakeTx(tx *gorm.DB, id uint, companyID uint) (*StockTake, error) {
+	var stockTake StockTake
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("company_id = ?", companyID).First(&stockTake, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrStockTakeNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Where("stock_take_id = ?", stockTake.ID).Find(&stockTake.Items).Error; err != nil {
+		return nil, err
+	}
+	return &stockTake, nil
+}
+
+// populate adds the branch and the variance totals
+func (s *StockTakeService) populate(stockTake *StockTake) {
+	if branch, err := User.GetBranchService().GetBranchByID(stockTake.BranchID, stockTake.CompanyID); err == nil {
+		stockTake.Branch = &BranchResponse{ID: branch.ID, Name: branch.Name, AdminUserID: branch.AdminUserID}
+	}
+	stockTake.CountedItems = 0
+	stockTake.TotalVariance = 0
+	for _, item := range stockTake.Items {
+		if item.CountedQuantity != nil {
+			stockTake.CountedItems++
+			stockTake.TotalVariance += item.Variance
+		}
+	}
+}
+
+// sortedItems returns the lines in product ID order so concurrent stock changes lock rows in the same sequence
+func sortedItems(stockTake *StockTake) []*StockTakeItem {
+	items := make([]*StockTakeItem, len(stockTake.Items))
+	copy(items, stockTake.Items)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ProductID < items[j].ProductID
+	})
+	return items
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
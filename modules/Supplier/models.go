@@ -0,0 +1,116 @@
+package Supplier
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Supplier is a vendor the company buys stock from
+type Supplier struct {
+	gorm.Model
+	CompanyID uint    `json:"companyId" gorm:"not null;index"`
+	Name      string  `json:"name" gorm:"not null"`
+	Contact   *string `json:"contact,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Address   *string `json:"address,omitempty"`
+	Notes     *string `json:"notes,omitempty"`
+}
+
+type PurchaseOrderStatus string
+
+const (
+	Draft             PurchaseOrderStatus = "draft"
+	Sent              PurchaseOrderStatus = "sent"
+	PartiallyReceived PurchaseOrderStatus = "partially_received"
+	Received          PurchaseOrderStatus = "received"
+	Cancelled         PurchaseOrderStatus = "cancelled"
+)
+
+// PurchaseOrder is stock ordered from a supplier for one branch
+type PurchaseOrder struct {
+	gorm.Model
+	CompanyID  uint                `json:"companyId" gorm:"not null;index"`
+	SupplierID uint                `json:"supplierId" gorm:"not null;index"`
+	BranchID   uint                `json:"branchId" gorm:"not null;index"` // Branch the stock is delivered to
+	Status     PurchaseOrderStatus `json:"status" gorm:"not null;default:'draft';index"`
+	Currency   string              `json:"currency" gorm:"not null"`
+	TotalCost  float64             `json:"totalCost" gorm:"default:0"` // Sum of ordered quantity x unit cost
+	ExpectedAt *time.Time          `json:"expectedAt,omitempty"`
+	Notes      *string             `json:"notes,omitempty"`
+
+	CreatedByID uint       `json:"createdById" gorm:"not null"`
+	SentAt      *time.Time `json:"sentAt,omitempty"`
+	ReceivedAt  *time.Time `json:"receivedAt,omitempty"` // When the last outstanding line arrived
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+
+	Items []*PurchaseOrderItem `json:"items" gorm:"foreignKey:PurchaseOrderID"`
+
+	// Relationship (for JSON response - computed from FK)
+	Supplier *Supplier `json:"supplier,omitempty" gorm:"foreignKey:SupplierID"`
+}
+
+// PurchaseOrderItem is one product line of a purchase order
+type PurchaseOrderItem struct {
+	gorm.Model
+	PurchaseOrderID  uint    `json:"purchaseOrderId" gorm:"not null;index"`
+	ProductID        uint    `json:"productId" gorm:"not null;index"`
+	ProductName      string  `json:"productName" gorm:"not null"`
+	QuantityOrdered  int     `json:"quantityOrdered" gorm:"not null"`
+	QuantityReceived int     `json:"quantityReceived" gorm:"default:0"`
+	UnitCost         float64 `json:"unitCost" gorm:"not null"` // Agreed cost; updated to the cost of the latest delivery
+}
+
+type CreateSupplierRequest struct {
+	CompanyID uint    `json:"-"`
+	Name      string  `json:"name" binding:"required"`
+	Contact   *string `json:"contact,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Address   *string `json:"address,omitempty"`
+	Notes     *string `json:"notes,omitempty"`
+}
+
+type UpdateSupplierRequest struct {
+	Name    *string `json:"name,omitempty"`
+	Contact *string `json:"contact,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Address *string `json:"address,omitempty"`
+	Notes   *string `json:"notes,omitempty"`
+}
+
+type PurchaseOrderItemRequest struct {
+	ProductID uint    `json:"productId" binding:"required"`
+	Quantity  int     `json:"quantity" binding:"required"`
+	UnitCost  float64 `json:"unitCost"`
+}
+
+type CreatePurchaseOrderRequest struct {
+	SupplierID uint                       `json:"supplierId" binding:"required"`
+	BranchID   *uint                      `json:"branchId,omitempty"` // Defaults to the caller's branch
+	Currency   string                     `json:"currency" binding:"required"`
+	ExpectedAt *time.Time                 `json:"expectedAt,omitempty"`
+	Notes      *string                    `json:"notes,omitempty"`
+	Items      []PurchaseOrderItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// UpdatePurchaseOrderRequest edits a draft. Items, when given, replace every line.
+type UpdatePurchaseOrderRequest struct {
+	SupplierID *uint                      `json:"supplierId,omitempty"`
+	Currency   *string                    `json:"currency,omitempty"`
+	ExpectedAt *time.Time                 `json:"expectedAt,omitempty"`
+	Notes      *string                    `json:"notes,omitempty"`
+	Items      []PurchaseOrderItemRequest `json:"items,omitempty" binding:"omitempty,dive"`
+}
+
+// ReceiveItemRequest is one delivered line. UnitCost overrides the agreed cost for this delivery.
+type ReceiveItemRequest struct {
+	ItemID   uint     `json:"itemId" binding:"required"`
+	Quantity int      `json:"quantity" binding:"required"`
+	UnitCost *float64 `json:"unitCost,omitempty"`
+}
+
+// ReceivePurchaseOrderRequest records a delivery. Without items every outstanding quantity is received.
+type ReceivePurchaseOrderRequest struct {
+	Items []ReceiveItemRequest `json:"items" binding:"omitempty,dive"`
+	Notes *string              `json:"notes,omitempty"`
+}
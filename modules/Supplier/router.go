@@ -0,0 +1,420 @@
+package Supplier
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+func RegisterRoutes(rg *gin.RouterGroup) {
+	suppliers := rg.Group("/suppliers")
+	{
+		suppliers.GET("", User.RequirePermission(User.PermPurchasingRead), getAllSuppliersHandler)
+		suppliers.GET("/:id", User.RequirePermission(User.PermPurchasingRead), getSupplierHandler)
+		suppliers.POST("", User.RequirePermission(User.PermPurchasingWrite), createSupplierHandler)
+		suppliers.PUT("/:id", User.RequirePermission(User.PermPurchasingWrite), updateSupplierHandler)
+		suppliers.DELETE("/:id", User.RequirePermission(User.PermPurchasingWrite), deleteSupplierHandler)
+	}
+
+	purchaseOrders := rg.Group("/purchase-orders")
+	{
+		purchaseOrders.GET("", User.RequirePermission(User.PermPurchasingRead), getPurchaseOrdersHandler)
+		purchaseOrders.GET("/:id", User.RequirePermission(User.PermPurchasingRead), getPurchaseOrderHandler)
+		purchaseOrders.POST("", User.RequirePermission(User.PermPurchasingWrite), createPurchaseOrderHandler)
+		purchaseOrders.PUT("/:id", User.RequirePermission(User.PermPurchasingWrite), updatePurchaseOrderHandler)
+		purchaseOrders.POST("/:id/send", User.RequirePermission(User.PermPurchasingWrite), sendPurchaseOrderHandler)
+		purchaseOrders.POST("/:id/receive", User.RequirePermission(User.PermPurchasingWrite), receivePurchaseOrderHandler)
+		purchaseOrders.POST("/:id/cancel", User.RequirePermission(User.PermPurchasingWrite), cancelPurchaseOrderHandler)
+	}
+}
+
+// supplierListSpec is what GET /suppliers sorts and filters by
+var supplierListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"name":      "name",
+		"createdAt": "created_at",
+	},
+	DefaultSort: "name",
+	DateColumn:  "created_at",
+	Search:      []string{"name", "contact", "email"},
+}
+
+func getAllSuppliersHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	params, ok := Query.FromContext(c, supplierListSpec)
+	if !ok {
+		return
+	}
+
+	suppliers, page, err := GetSupplierService().ListSuppliers(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suppliers": suppliers, "page": page})
+}
+
+func getSupplierHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid supplier id"})
+		return
+	}
+
+	supplier, err := GetSupplierService().GetSupplierByID(uint(id), companyID)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, supplier)
+}
+
+func createSupplierHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreateSupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.CompanyID = companyID
+
+	supplier, err := GetSupplierService().CreateSupplier(req)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, supplier)
+}
+
+func updateSupplierHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid supplier id"})
+		return
+	}
+
+	var req UpdateSupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	supplier, err := GetSupplierService().UpdateSupplier(uint(id), companyID, req)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, supplier)
+}
+
+func deleteSupplierHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid supplier id"})
+		return
+	}
+
+	if err := GetSupplierService().DeleteSupplier(uint(id), companyID); err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "supplier deleted successfully"})
+}
+
+// purchaseOrderListSpec is what GET /purchase-orders sorts and filters by
+var purchaseOrderListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"createdAt":  "created_at",
+		"expectedAt": "expected_at",
+		"totalCost":  "total_cost",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId":   {Column: "branch_id", Kind: Query.UintFilter},
+		"supplierId": {Column: "supplier_id", Kind: Query.UintFilter},
+		"status":     {Column: "status"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"notes"},
+}
+
+// getPurchaseOrdersHandler lists purchase orders.
+// Branch-limited roles only see orders delivered to their branch.
+func getPurchaseOrdersHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, purchaseOrderListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	orders, page, err := GetSupplierService().ListPurchaseOrders(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purchaseOrders": orders, "page": page})
+}
+
+func getPurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	order, ok := visiblePurchaseOrder(c, companyID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func createPurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, branchID := callerFromContext(c)
+	if req.BranchID != nil {
+		branchID = req.BranchID
+	}
+	if branchID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId is required"})
+		return
+	}
+	if !User.CanAccessBranch(c, *branchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	order, err := GetSupplierService().CreatePurchaseOrder(companyID, userID, *branchID, req)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+func updatePurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, ok := visiblePurchaseOrder(c, companyID)
+	if !ok {
+		return
+	}
+
+	order, err := GetSupplierService().UpdatePurchaseOrder(existing.ID, companyID, req)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func sendPurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visiblePurchaseOrder(c, companyID)
+	if !ok {
+		return
+	}
+
+	order, err := GetSupplierService().SendPurchaseOrder(existing.ID, companyID)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// receivePurchaseOrderHandler records a delivery and notifies the receiver and the branch admin
+func receivePurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req ReceivePurchaseOrderRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	existing, ok := visiblePurchaseOrder(c, companyID)
+	if !ok {
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	order, err := GetSupplierService().ReceivePurchaseOrder(existing.ID, companyID, userID, req)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+
+	// Units received by this delivery, per line
+	received := 0
+	previous := make(map[uint]int, len(existing.Items))
+	for _, item := range existing.Items {
+		previous[item.ID] = item.QuantityReceived
+	}
+	for _, item := range order.Items {
+		received += item.QuantityReceived - previous[item.ID]
+	}
+
+	supplierName := "supplier"
+	if order.Supplier != nil {
+		supplierName = order.Supplier.Name
+	}
+	message := fmt.Sprintf("Received %d units from %s on purchase order #%d", received, supplierName, order.ID)
+	if order.Status == PartiallyReceived {
+		message += "; some items are still outstanding"
+	}
+	notifyReceipt(order, userID, "Stock Received", message)
+
+	c.JSON(http.StatusOK, order)
+}
+
+func cancelPurchaseOrderHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visiblePurchaseOrder(c, companyID)
+	if !ok {
+		return
+	}
+
+	order, err := GetSupplierService().CancelPurchaseOrder(existing.ID, companyID)
+	if err != nil {
+		supplierErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// visiblePurchaseOrder loads the purchase order named by the :id parameter. Orders of
+// other companies, or delivered to another branch than a branch-limited caller's, are not found.
+func visiblePurchaseOrder(c *gin.Context, companyID uint) (*PurchaseOrder, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid purchase order id"})
+		return nil, false
+	}
+
+	order, err := GetSupplierService().GetPurchaseOrderByID(uint(id), companyID)
+	if err != nil || !User.CanAccessBranch(c, order.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrPurchaseOrderNotFound.Error(), "code": "PURCHASE_ORDER_NOT_FOUND"})
+		return nil, false
+	}
+	return order, true
+}
+
+// callerFromContext returns the authenticated user and their branch
+func callerFromContext(c *gin.Context) (uint, *uint) {
+	userID, _ := c.Get("user_id")
+	userIDUint, _ := userID.(uint)
+	branchID, _ := c.Get("branch_id")
+	branchIDPtr, _ := branchID.(*uint)
+	return userIDUint, branchIDPtr
+}
+
+// notifyReceipt sends an inventory notification to the receiver and the receiving branch's admin
+func notifyReceipt(order *PurchaseOrder, userID uint, title string, message string) {
+	notificationService := Notification.GetNotificationService()
+	if notificationService == nil {
+		return
+	}
+
+	userIDs := []uint{userID}
+	if branch, err := User.GetBranchService().GetBranchByID(order.BranchID, order.CompanyID); err == nil && branch.AdminUserID != nil && *branch.AdminUserID != userID {
+		userIDs = append(userIDs, *branch.AdminUserID)
+	}
+
+	orderID := order.ID
+	_, _ = notificationService.CreateNotificationForUsers(userIDs, Notification.CreateNotificationRequest{
+		Type:      Notification.NotificationTypeInventory,
+		Title:     title,
+		Message:   message,
+		RelatedID: &orderID,
+	})
+}
+
+// supplierErrorResponse writes a service error with its status and code
+func supplierErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrSupplierNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "SUPPLIER_NOT_FOUND"})
+	case errors.Is(err, ErrPurchaseOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PURCHASE_ORDER_NOT_FOUND"})
+	case errors.Is(err, ErrBranchNotFound), errors.Is(err, Product.ErrBranchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "BRANCH_NOT_FOUND"})
+	case errors.Is(err, Product.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PRODUCT_NOT_FOUND"})
+	case errors.Is(err, ErrItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "ITEM_NOT_FOUND"})
+	case errors.Is(err, ErrSupplierInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "SUPPLIER_IN_USE"})
+	case errors.Is(err, ErrOverReceipt):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "OVER_RECEIPT"})
+	case errors.Is(err, ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_TRANSITION"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,440 @@
+package Supplier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var supplierService *SupplierService
+
+var (
+	// ErrSupplierNotFound is returned when a supplier does not exist in the caller's company
+	ErrSupplierNotFound = errors.New("supplier not found")
+	// ErrSupplierInUse is returned when deleting a supplier with open purchase orders
+	ErrSupplierInUse = errors.New("supplier has open purchase orders")
+	// ErrPurchaseOrderNotFound is returned when a purchase order does not exist in the caller's company
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	// ErrBranchNotFound is returned when the receiving branch is not in the caller's company
+	ErrBranchNotFound = errors.New("branch not found")
+	// ErrInvalidQuantity is returned for line quantities that are not positive
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrInvalidUnitCost is returned for negative unit costs
+	ErrInvalidUnitCost = errors.New("unit cost cannot be negative")
+	// ErrItemNotFound is returned when a received line is not part of the purchase order
+	ErrItemNotFound = errors.New("purchase order item not found")
+	// ErrOverReceipt is returned when a delivery is more than the outstanding quantity of a line
+	ErrOverReceipt = errors.New("received quantity is more than the quantity outstanding")
+	// ErrInvalidTransition is returned when a purchase order is not in the status an action needs
+	ErrInvalidTransition = errors.New("purchase order cannot be changed in its current status")
+)
+
+type SupplierService struct {
+	db *gorm.DB
+}
+
+func NewSupplierService() *SupplierService {
+	return &SupplierService{}
+}
+
+// InitializeService initializes the supplier service with a database connection
+func InitializeService(db *gorm.DB) {
+	supplierService = &SupplierService{db: db}
+}
+
+// GetSupplierService returns the initialized supplier service
+func GetSupplierService() *SupplierService {
+	return supplierService
+}
+
+func (s *SupplierService) GetSupplierByID(id uint, companyID uint) (*Supplier, error) {
+	var supplier Supplier
+	if err := s.db.Where("id = ? AND company_id = ?", id, companyID).First(&supplier).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSupplierNotFound
+		}
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+// ListSuppliers returns one page of the company's suppliers matching params
+func (s *SupplierService) ListSuppliers(companyID uint, params *Query.Params) ([]*Supplier, *Query.Page, error) {
+	query := s.db.Model(&Supplier{}).Where("company_id = ?", companyID)
+
+	var suppliers []*Supplier
+	page, err := Query.Paginate(query, params, &suppliers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return suppliers, page, nil
+}
+
+func (s *SupplierService) CreateSupplier(req CreateSupplierRequest) (*Supplier, error) {
+	supplier := &Supplier{
+		CompanyID: req.CompanyID,
+		Name:      strings.TrimSpace(req.Name),
+		Contact:   req.Contact,
+		Email:     req.Email,
+		Address:   req.Address,
+		Notes:     req.Notes,
+	}
+	if err := s.db.Create(supplier).Error; err != nil {
+		return nil, err
+	}
+	return supplier, nil
+}
+
+func (s *SupplierService) UpdateSupplier(id uint, companyID uint, req UpdateSupplierRequest) (*Supplier, error) {
+	supplier, err := s.GetSupplierByID(id, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		supplier.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Contact != nil {
+		supplier.Contact = req.Contact
+	}
+	if req.Email != nil {
+		supplier.Email = req.Email
+	}
+	if req.Address != nil {
+		supplier.Address = req.Address
+	}
+	if req.Notes != nil {
+		supplier.Notes = req.Notes
+	}
+
+	if err := s.db.Save(supplier).Error; err != nil {
+		return nil, err
+	}
+	return supplier, nil
+}
+
+// DeleteSupplier removes a supplier that has no open purchase orders
+func (s *SupplierService) DeleteSupplier(id uint, companyID uint) error {
+	supplier, err := s.GetSupplierByID(id, companyID)
+	if err != nil {
+		return err
+	}
+
+	var open int64
+	if err := s.db.Model(&PurchaseOrder{}).
+		Where("supplier_id = ? AND status IN ?", supplier.ID, []PurchaseOrderStatus{Draft, Sent, PartiallyReceived}).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrSupplierInUse
+	}
+	return s.db.Delete(supplier).Error
+}
+
+func (s *SupplierService) GetPurchaseOrderByID(id uint, companyID uint) (*PurchaseOrder, error) {
+	var order PurchaseOrder
+	if err := s.db.Preload("Items").Preload("Supplier").Where("company_id = ?", companyID).First(&order, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrPurchaseOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListPurchaseOrders returns one page of the company's purchase orders matching params
+func (s *SupplierService) ListPurchaseOrders(companyID uint, params *Query.Params) ([]*PurchaseOrder, *Query.Page, error) {
+	query := s.db.Model(&PurchaseOrder{}).Where("company_id = ?", companyID)
+
+	var orders []*PurchaseOrder
+	page, err := Query.Paginate(query, params, &orders, "Items", "Supplier")
+	if err != nil {
+		return nil, nil, err
+	}
+	return orders, page, nil
+}
+
+// CreatePurchaseOrder records a draft purchase order delivered to branchID
+func (s *SupplierService) CreatePurchaseOrder(companyID uint, userID uint, branchID uint, req CreatePurchaseOrderRequest) (*PurchaseOrder, error) {
+	if _, err := s.GetSupplierByID(req.SupplierID, companyID); err != nil {
+		return nil, err
+	}
+	if _, err := User.GetBranchService().GetBranchByID(branchID, companyID); err != nil {
+		return nil, ErrBranchNotFound
+	}
+
+	order := &PurchaseOrder{
+		CompanyID:   companyID,
+		SupplierID:  req.SupplierID,
+		BranchID:    branchID,
+		Status:      Draft,
+		Currency:    req.Currency,
+		ExpectedAt:  req.ExpectedAt,
+		Notes:       req.Notes,
+		CreatedByID: userID,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		items, err := s.buildItemsTx(tx, companyID, req.Items)
+		if err != nil {
+			return err
+		}
+		order.Items = items
+		order.TotalCost = totalCost(items)
+		return tx.Create(order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPurchaseOrderByID(order.ID, companyID)
+}
+
+// UpdatePurchaseOrder edits a draft purchase order
+func (s *SupplierService) UpdatePurchaseOrder(id uint, companyID uint, req UpdatePurchaseOrderRequest) (*PurchaseOrder, error) {
+	if req.SupplierID != nil {
+		if _, err := s.GetSupplierByID(*req.SupplierID, companyID); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := s.lockPurchaseOrderTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if order.Status != Draft {
+			return ErrInvalidTransition
+		}
+
+		if req.SupplierID != nil {
+			order.SupplierID = *req.SupplierID
+		}
+		if req.Currency != nil {
+			order.Currency = *req.Currency
+		}
+		if req.ExpectedAt != nil {
+			order.ExpectedAt = req.ExpectedAt
+		}
+		if req.Notes != nil {
+			order.Notes = req.Notes
+		}
+		if req.Items != nil {
+			items, err := s.buildItemsTx(tx, companyID, req.Items)
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&PurchaseOrderItem{}).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				item.PurchaseOrderID = order.ID
+			}
+			if len(items) > 0 {
+				if err := tx.Create(&items).Error; err != nil {
+					return err
+				}
+			}
+			order.TotalCost = totalCost(items)
+		}
+		return tx.Omit("Items", "Supplier").Save(order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPurchaseOrderByID(id, companyID)
+}
+
+// SendPurchaseOrder marks a draft as sent to the supplier
+func (s *SupplierService) SendPurchaseOrder(id uint, companyID uint) (*PurchaseOrder, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := s.lockPurchaseOrderTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if order.Status != Draft {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		order.Status = Sent
+		order.SentAt = &now
+		return tx.Omit("Items", "Supplier").Save(order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPurchaseOrderByID(id, companyID)
+}
+
+// ReceivePurchaseOrder adds a delivery to the receiving branch's stock. Each line's stock
+// movement records the unit cost paid, and the order becomes partially received or
+// received depending on what is still outstanding.
+func (s *SupplierService) ReceivePurchaseOrder(id uint, companyID uint, userID uint, req ReceivePurchaseOrderRequest) (*PurchaseOrder, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := s.lockPurchaseOrderTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if order.Status != Sent && order.Status != PartiallyReceived {
+			return ErrInvalidTransition
+		}
+
+		// Without items the whole outstanding quantity arrives at the agreed cost
+		deliveries := req.Items
+		if len(deliveries) == 0 {
+			for _, item := range order.Items {
+				if outstanding := item.QuantityOrdered - item.QuantityReceived; outstanding > 0 {
+					deliveries = append(deliveries, ReceiveItemRequest{ItemID: item.ID, Quantity: outstanding})
+				}
+			}
+		}
+
+		items := make(map[uint]*PurchaseOrderItem, len(order.Items))
+		for _, item := range order.Items {
+			items[item.ID] = item
+		}
+		for _, delivery := range deliveries {
+			if _, ok := items[delivery.ItemID]; !ok {
+				return ErrItemNotFound
+			}
+		}
+		// Take stock in product ID order so concurrent receipts lock rows in the same sequence
+		sort.SliceStable(deliveries, func(i, j int) bool {
+			return items[deliveries[i].ItemID].ProductID < items[deliveries[j].ItemID].ProductID
+		})
+
+		notes := fmt.Sprintf("Purchase order #%d received", order.ID)
+		if req.Notes != nil {
+			notes += ": " + *req.Notes
+		}
+		for _, delivery := range deliveries {
+			item := items[delivery.ItemID]
+			if delivery.Quantity <= 0 {
+				return ErrInvalidQuantity
+			}
+			if item.QuantityReceived+delivery.Quantity > item.QuantityOrdered {
+				return ErrOverReceipt
+			}
+			unitCost := item.UnitCost
+			if delivery.UnitCost != nil {
+				if *delivery.UnitCost < 0 {
+					return ErrInvalidUnitCost
+				}
+				unitCost = *delivery.UnitCost
+			}
+
+			if _, err := Product.GetProductService().AdjustQuantityTx(tx, item.ProductID, &companyID, delivery.Quantity, Product.StockChange{
+				Reason:      Product.MovementRestock,
+				ReferenceID: &order.ID,
+				UserID:      &userID,
+				BranchID:    &order.BranchID,
+				UnitCost:    &unitCost,
+				Notes:       &notes,
+			}); err != nil {
+				return err
+			}
+
+			item.QuantityReceived += delivery.Quantity
+			item.UnitCost = unitCost
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+
+		order.Status = Received
+		for _, item := range order.Items {
+			if item.QuantityReceived < item.QuantityOrdered {
+				order.Status = PartiallyReceived
+			}
+		}
+		if order.Status == Received {
+			now := time.Now()
+			order.ReceivedAt = &now
+		}
+		order.TotalCost = totalCost(order.Items)
+		return tx.Omit("Items", "Supplier").Save(order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPurchaseOrderByID(id, companyID)
+}
+
+// CancelPurchaseOrder cancels an order that has not been fully received. Stock already
+// received stays in the branch; only the outstanding quantities are dropped.
+func (s *SupplierService) CancelPurchaseOrder(id uint, companyID uint) (*PurchaseOrder, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := s.lockPurchaseOrderTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if order.Status == Received || order.Status == Cancelled {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		order.Status = Cancelled
+		order.CancelledAt = &now
+		return tx.Omit("Items", "Supplier").Save(order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPurchaseOrderByID(id, companyID)
+}
+
+// buildItemsTx validates requested lines against the company's products
+func (s *SupplierService) buildItemsTx(tx *gorm.DB, companyID uint, requested []PurchaseOrderItemRequest) ([]*PurchaseOrderItem, error) {
+	items := make([]*PurchaseOrderItem, len(requested))
+	for i, req := range requested {
+		if req.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
+		if req.UnitCost < 0 {
+			return nil, ErrInvalidUnitCost
+		}
+		var product Product.Product
+		if err := tx.Where("company_id = ?", companyID).First(&product, "id = ?", req.ProductID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, Product.ErrProductNotFound
+			}
+			return nil, err
+		}
+		items[i] = &PurchaseOrderItem{
+			ProductID:       product.ID,
+			ProductName:     product.Name,
+			QuantityOrdered: req.Quantity,
+			UnitCost:        req.UnitCost,
+		}
+	}
+	return items, nil
+}
+
+func (s *SupplierService) lockPurchaseOrderTx(tx *gorm.DB, id uint, companyID uint) (*PurchaseOrder, error) {
+	var order PurchaseOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("company_id = ?", companyID).First(&order, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrPurchaseOrderNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Where("purchase_order_id = ?", order.ID).Find(&order.Items).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func totalCost(items []*PurchaseOrderItem) float64 {
+	total := 0.0
+	for _, item := range items {
+		total += float64(item.QuantityOrdered) * item.UnitCost
+	}
+	return total
+}
@@ -0,0 +1,113 @@
+package Sync
+
+import (
+	"encoding/json"
+	"time"
+
+	Expense "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Expense"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Sale "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sale"
+)
+
+// Entity is a kind of record a device can sync
+type Entity string
+
+const (
+	EntitySale    Entity = "sale"
+	EntityExpense Entity = "expense"
+	EntityProduct Entity = "product"
+)
+
+// Operation is what a queued change does to its record
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update" // Products only; needs the record's serverId
+)
+
+// ResultStatus is the outcome of one pushed change
+type ResultStatus string
+
+const (
+	Accepted  ResultStatus = "accepted"  // Applied now
+	Duplicate ResultStatus = "duplicate" // Applied by an earlier push with the same clientId
+	Rejected  ResultStatus = "rejected"  // Not applied; the device may fix it and push it again
+	Conflict  ResultStatus = "conflict"  // Made against an older version; the record is the server's current state
+)
+
+// MergeRule says how a field of a product update made against an older version is
+// merged with the product as it is now
+type MergeRule string
+
+const (
+	MergeReject MergeRule = "reject" // The change is a conflict (default)
+	MergeClient MergeRule = "client" // The device's value overwrites the server's
+	MergeServer MergeRule = "server" // The server's value is kept and the device's dropped
+	MergeDelta  MergeRule = "delta"  // Quantity only: the device's change from its base is added to the stock
+)
+
+// SyncRecord remembers every change accepted from a device, so that a push replayed
+// after a dropped connection is answered from here instead of being applied twice
+type SyncRecord struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	CompanyID uint      `json:"companyId" gorm:"not null;uniqueIndex:idx_sync_company_client"`
+	ClientID  string    `json:"clientId" gorm:"not null;uniqueIndex:idx_sync_company_client"` // Generated by the device
+	DeviceID  string    `json:"deviceId" gorm:"not null;index"`
+	UserID    uint      `json:"userId" gorm:"not null"`
+	Entity    Entity    `json:"entity" gorm:"not null"`
+	Operation Operation `json:"operation" gorm:"not null"`
+	ServerID  uint      `json:"serverId"` // ID of the sale, expense or product
+}
+
+// Change is one record queued on a device while it was offline. Data is the body the
+// matching online endpoint takes: POST /sales (single product), POST /expenses,
+// POST /products or PUT /products/:id.
+type Change struct {
+	ClientID   string          `json:"clientId" binding:"required,max=64"`
+	Entity     Entity          `json:"entity" binding:"required"`
+	Operation  Operation       `json:"operation"` // Default create
+	ServerID   *uint           `json:"serverId,omitempty"`
+	Data       json.RawMessage `json:"data" binding:"required"`
+	RecordedAt *time.Time      `json:"recordedAt,omitempty"` // When the sale or expense happened on the device
+	Base       json.RawMessage `json:"base,omitempty"`       // Values the device edited from, for delta merges
+}
+
+// PushRequest is a device's queue, applied in order
+type PushRequest struct {
+	DeviceID string    `json:"deviceId" binding:"required,max=64"`
+	Changes  []*Change `json:"changes" binding:"required,max=500,dive"`
+	// Rules by field (e.g. "price") for product updates made against an older version,
+	// on top of DefaultMergeRules
+	MergeRules map[string]MergeRule `json:"mergeRules,omitempty"`
+}
+
+// ChangeResult is the outcome of one pushed change
+type ChangeResult struct {
+	ClientID string       `json:"clientId"`
+	Entity   Entity       `json:"entity"`
+	Status   ResultStatus `json:"status"`
+	ServerID *uint        `json:"serverId,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Code     string       `json:"code,omitempty"`
+	Record   interface{}  `json:"record,omitempty"` // The record as stored on the server
+}
+
+// Tombstone marks a record deleted on the server since the device's cursor
+type Tombstone struct {
+	Entity    Entity    `json:"entity"`
+	ID        uint      `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// PullResponse holds the records changed since the device's cursor, oldest first.
+// HasMore is set when a limit was hit; pull again with Cursor to get the rest.
+type PullResponse struct {
+	Products []*Product.Product `json:"products"`
+	Sales    []*Sale.Sale       `json:"sales"`
+	Expenses []*Expense.Expense `json:"expenses"`
+	Deleted  []Tombstone        `json:"deleted"`
+	Cursor   string             `json:"cursor"`
+	HasMore  bool               `json:"hasMore"`
+}
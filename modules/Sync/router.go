@@ -0,0 +1,79 @@
+package Sync
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	Sale "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sale"
+)
+
+// RegisterRoutes registers the offline sync endpoints. Each pushed change is checked
+// against the permission of its online endpoint, and a pull only returns the entities
+// the caller may read, so the routes need no permission of their own.
+func RegisterRoutes(rg *gin.RouterGroup) {
+	sync := rg.Group("/sync")
+	{
+		sync.POST("/push", pushHandler)
+		sync.GET("/pull", pullHandler)
+	}
+}
+
+// pushHandler applies a device's queued changes and answers with one result per change
+func pushHandler(c *gin.Context) {
+	var req PushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, ok := Sale.SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	results, err := GetSyncService().Push(req, actor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_MERGE_RULE"})
+		return
+	}
+	for _, result := range results {
+		// Replays were announced when they were first accepted
+		if sale, ok := result.Record.(*Sale.Sale); ok && result.Status == Accepted {
+			Sale.AnnounceSale(actor.CompanyID, sale)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// pullHandler returns the records changed since ?cursor=, up to ?limit= of each entity
+func pullHandler(c *gin.Context) {
+	actor, ok := Sale.SaleActorFromContext(c)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if limitParam := c.Query("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLimit.Error(), "code": "INVALID_QUERY"})
+			return
+		}
+		limit = parsed
+	}
+
+	response, err := GetSyncService().Pull(c.Query("cursor"), limit, actor)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidLimit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_QUERY"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,618 @@
+package Sync
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+	Expense "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Expense"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Sale "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sale"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var syncService *SyncService
+
+const (
+	// DefaultPullLimit is how many records of each entity a pull returns by default
+	DefaultPullLimit = 200
+	// MaxPullLimit is the largest limit a pull accepts
+	MaxPullLimit = 500
+)
+
+var (
+	// ErrInvalidChange is returned for changes whose data does not decode into the entity's request
+	ErrInvalidChange = errors.New("change data is invalid for its entity")
+	// ErrUnsupportedChange is returned for entity and operation pairs that cannot be synced
+	ErrUnsupportedChange = errors.New("entity and operation cannot be synced")
+	// ErrServerIDRequired is returned for updates without the record's serverId
+	ErrServerIDRequired = errors.New("serverId is required for updates")
+	// ErrClientIDReused is returned when a clientId was already used for a different change
+	ErrClientIDReused = errors.New("clientId was already used for a different change")
+	// ErrPermissionDenied is returned when the user's role may not make the change
+	ErrPermissionDenied = errors.New("you do not have permission to perform this action")
+	// ErrBranchRequired is returned for expenses pushed by users without a branch
+	ErrBranchRequired = errors.New("user must have a branch")
+	// ErrInvalidCursor is returned for pull cursors that were not issued by the server
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidLimit is returned for pull limits outside 1..MaxPullLimit
+	ErrInvalidLimit = errors.New("limit must be between 1 and 500")
+	// ErrInvalidMergeRule is returned for unknown merge rules, or delta rules on fields other than quantity
+	ErrInvalidMergeRule = errors.New("merge rules must be reject, client, server or (for quantity) delta")
+)
+
+// DefaultMergeRules apply to the fields a push sets no rule for; any other field of a
+// product update made against an older version makes it a conflict. Stock is merged as
+// a delta because sales and transfers change it without an edit of the product.
+var DefaultMergeRules = map[string]MergeRule{
+	"quantity": MergeDelta,
+}
+
+// mergeMetadataFields are fields of a product update that describe the edit rather
+// than change the product, so they never conflict
+var mergeMetadataFields = map[string]bool{
+	"version":       true,
+	"quantityDelta": true,
+	"branchId":      true,
+	"stockReason":   true,
+	"stockNotes":    true,
+}
+
+type SyncService struct {
+	db *gorm.DB
+}
+
+// InitializeService initializes the sync service with a database connection
+func InitializeService(db *gorm.DB) {
+	syncService = &SyncService{db: db}
+}
+
+// GetSyncService returns the initialized sync service
+func GetSyncService() *SyncService {
+	return syncService
+}
+
+// Push applies a device's queued changes in order, each in its own transaction, so
+// one rejected change does not hold back the rest. A change whose clientId was
+// already accepted is not applied again; its result points at the stored record.
+// Rejected changes are not remembered and can be pushed again once fixed.
+func (s *SyncService) Push(req PushRequest, actor Sale.SaleActor) ([]*ChangeResult, error) {
+	for field, rule := range req.MergeRules {
+		switch rule {
+		case MergeReject, MergeClient, MergeServer:
+		case MergeDelta:
+			if field != "quantity" {
+				return nil, ErrInvalidMergeRule
+			}
+		default:
+			return nil, ErrInvalidMergeRule
+		}
+	}
+
+	results := make([]*ChangeResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		results = append(results, s.pushChange(req, change, actor))
+	}
+	return results, nil
+}
+
+func (s *SyncService) pushChange(req PushRequest, change *Change, actor Sale.SaleActor) *ChangeResult {
+	if change.Operation == "" {
+		change.Operation = OperationCreate
+	}
+	result := &ChangeResult{ClientID: change.ClientID, Entity: change.Entity}
+
+	var serverID uint
+	duplicate := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		record := &SyncRecord{
+			CompanyID: actor.CompanyID,
+			ClientID:  change.ClientID,
+			DeviceID:  req.DeviceID,
+			UserID:    actor.UserID,
+			Entity:    change.Entity,
+			Operation: change.Operation,
+		}
+		// The unique index makes a concurrent replay wait for this transaction, then find the record
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		if insert.RowsAffected == 0 {
+			var existing SyncRecord
+			if err := tx.Where("company_id = ? AND client_id = ?", actor.CompanyID, change.ClientID).First(&existing).Error; err != nil {
+				return err
+			}
+			if existing.Entity != change.Entity || existing.Operation != change.Operation {
+				return ErrClientIDReused
+			}
+			serverID = existing.ServerID
+			duplicate = true
+			return nil
+		}
+
+		id, err := s.applyChangeTx(tx, change, req.MergeRules, actor)
+		if err != nil {
+			return err
+		}
+		serverID = id
+		return tx.Model(record).Update("server_id", id).Error
+	})
+	if errors.Is(err, Product.ErrVersionConflict) {
+		result.Status = Conflict
+		result.Error = err.Error()
+		result.Code = "VERSION_CONFLICT"
+		if record, err := s.loadRecord(change.Entity, *change.ServerID, actor); err == nil {
+			result.Record = record
+		}
+		return result
+	}
+	if err != nil {
+		result.Status = Rejected
+		result.Error = err.Error()
+		result.Code = changeErrorCode(err)
+		return result
+	}
+
+	result.Status = Accepted
+	if duplicate {
+		result.Status = Duplicate
+	}
+	result.ServerID = &serverID
+	if record, err := s.loadRecord(change.Entity, serverID, actor); err == nil {
+		result.Record = record
+	}
+	return result
+}
+
+// applyChangeTx decodes change the way the matching online endpoint binds its body,
+// applies it and marks the record as synced
+func (s *SyncService) applyChangeTx(tx *gorm.DB, change *Change, rules map[string]MergeRule, actor Sale.SaleActor) (uint, error) {
+	switch {
+	case change.Entity == EntitySale && change.Operation == OperationCreate:
+		if !User.HasPermission(actor.Role, User.PermSalesCreate) {
+			return 0, ErrPermissionDenied
+		}
+		var req Sale.CreateSaleRequest
+		if err := decodeChange(change.Data, &req, nil); err != nil {
+			return 0, err
+		}
+		req.SellerID = actor.UserID
+		sale, err := Sale.GetSaleService().CreateSaleTx(tx, req, actor)
+		if err != nil {
+			return 0, err
+		}
+		return sale.ID, markSyncedTx(tx, &Sale.Sale{}, sale.ID, Sale.Synced, change.RecordedAt)
+
+	case change.Entity == EntityExpense && change.Operation == OperationCreate:
+		if !User.HasPermission(actor.Role, User.PermExpensesWrite) {
+			return 0, ErrPermissionDenied
+		}
+		if actor.BranchID == nil {
+			return 0, ErrBranchRequired
+		}
+		var req Expense.CreateExpenseRequest
+		if err := decodeChange(change.Data, &req, nil); err != nil {
+			return 0, err
+		}
+		req.UserID = actor.UserID
+		req.BranchID = *actor.BranchID
+		expense, err := Expense.GetExpenseService().CreateExpenseTx(tx, req)
+		if err != nil {
+			return 0, err
+		}
+		return expense.ID, markSyncedTx(tx, &Expense.Expense{}, expense.ID, Expense.Synced, change.RecordedAt)
+
+	case change.Entity == EntityProduct && change.Operation == OperationCreate:
+		if !User.HasPermission(actor.Role, User.PermProductsWrite) {
+			return 0, ErrPermissionDenied
+		}
+		var req Product.CreateProductRequest
+		if err := decodeChange(change.Data, &req, func() { req.CompanyID = actor.CompanyID }); err != nil {
+			return 0, err
+		}
+		req.UserID = &actor.UserID
+		if req.BranchID == nil {
+			req.BranchID = actor.BranchID
+		} else if !canAccessBranch(actor, *req.BranchID) {
+			return 0, ErrPermissionDenied
+		}
+		product, err := Product.GetProductService().CreateProductTx(tx, req)
+		if err != nil {
+			return 0, err
+		}
+		return product.ID, markSyncedTx(tx, &Product.Product{}, product.ID, Product.Synced, nil)
+
+	case change.Entity == EntityProduct && change.Operation == OperationUpdate:
+		if !User.HasPermission(actor.Role, User.PermProductsWrite) {
+			return 0, ErrPermissionDenied
+		}
+		if change.ServerID == nil {
+			return 0, ErrServerIDRequired
+		}
+		data, err := mergeProductChangeTx(tx, change, rules, actor)
+		if err != nil {
+			return 0, err
+		}
+		var req Product.UpdateProductRequest
+		if err := decodeChange(data, &req, nil); err != nil {
+			return 0, err
+		}
+		if req.StockReason != nil && !Product.ValidMovementReason(*req.StockReason) {
+			return 0, ErrInvalidChange
+		}
+		if req.BranchID != nil && !canAccessBranch(actor, *req.BranchID) {
+			return 0, ErrPermissionDenied
+		}
+		// Like PUT /products/:id, branch-limited roles only set their own branch's stock
+		if branchLimit(actor) != nil && req.ChangesProduct() {
+			return 0, ErrPermissionDenied
+		}
+		req.CompanyID = nil
+		stockChange := Product.StockChange{UserID: &actor.UserID, BranchID: actor.BranchID}
+		product, err := Product.GetProductService().UpdateProductTx(tx, *change.ServerID, &actor.CompanyID, req, stockChange)
+		if err != nil {
+			return 0, err
+		}
+		return product.ID, markSyncedTx(tx, &Product.Product{}, product.ID, Product.Synced, nil)
+	}
+	return 0, ErrUnsupportedChange
+}
+
+// mergeProductChangeTx resolves an offline product edit against the product as it is now.
+// A field with a delta rule and a value in the change's base becomes a relative change.
+// When the edit was made against an older version, every other field is merged by its
+// rule, and a field whose rule is reject makes the change a conflict.
+func mergeProductChangeTx(tx *gorm.DB, change *Change, rules map[string]MergeRule, actor Sale.SaleActor) (json.RawMessage, error) {
+	var fields, base map[string]json.RawMessage
+	if err := json.Unmarshal(change.Data, &fields); err != nil {
+		return nil, ErrInvalidChange
+	}
+	if len(change.Base) > 0 {
+		if err := json.Unmarshal(change.Base, &base); err != nil {
+			return nil, ErrInvalidChange
+		}
+	}
+
+	quantity, edited := fields["quantity"]
+	from, based := base["quantity"]
+	if edited && based && mergeRule(rules, "quantity") == MergeDelta {
+		var to, was int
+		if json.Unmarshal(quantity, &to) != nil || json.Unmarshal(from, &was) != nil {
+			return nil, ErrInvalidChange
+		}
+		delete(fields, "quantity")
+		fields["quantityDelta"] = json.RawMessage(strconv.Itoa(to - was))
+	}
+
+	rawVersion, ok := fields["version"]
+	if !ok {
+		// Without a version the edit is applied like an online update
+		return json.Marshal(fields)
+	}
+	var version uint
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		return nil, ErrInvalidChange
+	}
+	product, err := Product.GetProductService().LockProductTx(tx, *change.ServerID, &actor.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	if version == product.Version {
+		return json.Marshal(fields)
+	}
+
+	for field := range fields {
+		if mergeMetadataFields[field] {
+			continue
+		}
+		switch mergeRule(rules, field) {
+		case MergeClient:
+		case MergeServer:
+			delete(fields, field)
+		default:
+			return nil, Product.ErrVersionConflict
+		}
+	}
+	fields["version"] = json.RawMessage(strconv.FormatUint(uint64(product.Version), 10))
+	return json.Marshal(fields)
+}
+
+// mergeRule is the rule the push sets for field, or its default
+func mergeRule(rules map[string]MergeRule, field string) MergeRule {
+	if rule, ok := rules[field]; ok {
+		return rule
+	}
+	if rule, ok := DefaultMergeRules[field]; ok {
+		return rule
+	}
+	return MergeReject
+}
+
+// decodeChange unmarshals data into req and validates it with the binding rules of the
+// online endpoint. override runs between the two, for fields set by the server.
+func decodeChange(data json.RawMessage, req interface{}, override func()) error {
+	if err := json.Unmarshal(data, req); err != nil {
+		return ErrInvalidChange
+	}
+	if override != nil {
+		override()
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return err
+	}
+	return nil
+}
+
+// markSyncedTx sets the sync status of the record id of model's table and, for changes
+// recorded on the device in the past, backdates it to when it happened
+func markSyncedTx(tx *gorm.DB, model interface{}, id uint, status interface{}, recordedAt *time.Time) error {
+	updates := map[string]interface{}{"sync_status": status}
+	if recordedAt != nil && recordedAt.Before(time.Now()) {
+		updates["created_at"] = *recordedAt
+	}
+	return tx.Model(model).Where("id = ?", id).UpdateColumns(updates).Error
+}
+
+// canAccessBranch reports whether actor may write records of branchID.
+// Branch-limited roles only write to their own branch.
+func canAccessBranch(actor Sale.SaleActor, branchID uint) bool {
+	limit := branchLimit(actor)
+	return limit == nil || *limit == branchID
+}
+
+// branchLimit is the branch a branch-limited actor is pinned to, nil for company-wide roles
+func branchLimit(actor Sale.SaleActor) *uint {
+	if User.HasCompanyWideAccess(actor.Role) {
+		return nil
+	}
+	if actor.BranchID != nil {
+		return actor.BranchID
+	}
+	none := uint(0)
+	return &none
+}
+
+// loadRecord returns the stored sale, expense or product id, populated like the online endpoints
+func (s *SyncService) loadRecord(entity Entity, id uint, actor Sale.SaleActor) (interface{}, error) {
+	switch entity {
+	case EntitySale:
+		return Sale.GetSaleService().GetSaleByID(id, actor.CompanyID)
+	case EntityExpense:
+		return Expense.GetExpenseService().GetExpenseByID(id, actor.CompanyID)
+	case EntityProduct:
+		product, err := Product.GetProductService().GetProductByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := populateStock([]*Product.Product{product}, actor); err != nil {
+			return nil, err
+		}
+		return product, nil
+	}
+	return nil, ErrUnsupportedChange
+}
+
+// populateStock adds the stock at the actor's branch to products and, for company-wide
+// roles, the per-branch breakdown
+func populateStock(products []*Product.Product, actor Sale.SaleActor) error {
+	branchID := branchLimit(actor)
+	breakdown := branchID == nil
+	if breakdown {
+		branchID = actor.BranchID
+	}
+	return Product.GetProductService().PopulateStock(products, branchID, breakdown)
+}
+
+// changeErrorCode is the error code of a rejected change, matching the codes of the online endpoints
+func changeErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidChange):
+		return "INVALID_CHANGE"
+	case errors.Is(err, ErrUnsupportedChange):
+		return "UNSUPPORTED_CHANGE"
+	case errors.Is(err, ErrServerIDRequired):
+		return "SERVER_ID_REQUIRED"
+	case errors.Is(err, ErrClientIDReused):
+		return "CLIENT_ID_REUSED"
+	case errors.Is(err, ErrPermissionDenied):
+		return "PERMISSION_DENIED"
+	case errors.Is(err, ErrBranchRequired):
+		return "BRANCH_REQUIRED"
+	case errors.Is(err, Product.ErrInsufficientStock):
+		return "INSUFFICIENT_STOCK"
+	case errors.Is(err, Product.ErrProductNotFound):
+		return "PRODUCT_NOT_FOUND"
+	case errors.Is(err, Product.ErrVariantNotFound):
+		return "VARIANT_NOT_FOUND"
+	case errors.Is(err, Product.ErrVariantRequired):
+		return "VARIANT_REQUIRED"
+	case errors.Is(err, Product.ErrDuplicateSKU):
+		return "DUPLICATE_SKU"
+	case errors.Is(err, Product.ErrHasVariants):
+		return "HAS_VARIANTS"
+	case errors.Is(err, Product.ErrQuantityAndDelta):
+		return "QUANTITY_AND_DELTA"
+	case errors.Is(err, Product.ErrCategoryNotFound):
+		return "CATEGORY_NOT_FOUND"
+	case errors.Is(err, Product.ErrBranchNotFound):
+		return "BRANCH_NOT_FOUND"
+	case errors.Is(err, Sale.ErrInvalidQuantity):
+		return "INVALID_QUANTITY"
+	case errors.Is(err, Sale.ErrPriceOverrideNotAllowed):
+		return "PRICE_OVERRIDE_NOT_ALLOWED"
+	case errors.Is(err, Sale.ErrOverrideReasonRequired):
+		return "OVERRIDE_REASON_REQUIRED"
+	case errors.Is(err, Sale.ErrInvalidDiscount):
+		return "INVALID_DISCOUNT"
+	case errors.Is(err, Sale.ErrInvalidExtraCosts):
+		return "INVALID_EXTRA_COSTS"
+	case errors.Is(err, Customer.ErrCustomerNotFound):
+		return "CUSTOMER_NOT_FOUND"
+	case errors.Is(err, Customer.ErrCreditLimitExceeded):
+		return "CREDIT_LIMIT_EXCEEDED"
+	}
+	return ""
+}
+
+// pullPosition is how far a device has pulled one entity: the change time and ID of
+// the last record it received
+type pullPosition struct {
+	ChangedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+// pullCursor holds the position of every entity. It is handed out base64url-encoded.
+type pullCursor map[Entity]pullPosition
+
+func decodePullCursor(raw string) (pullCursor, error) {
+	cursor := pullCursor{}
+	if raw == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (c pullCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// changedAt is when a row last changed; soft deletes do not touch updated_at
+const changedAt = "GREATEST(updated_at, COALESCE(deleted_at, updated_at))"
+
+// Pull returns the products, sales and expenses changed since cursor that actor may
+// read, up to limit of each, with deleted records as tombstones. Branch-limited
+// roles only get the sales and expenses of their branch.
+func (s *SyncService) Pull(rawCursor string, limit int, actor Sale.SaleActor) (*PullResponse, error) {
+	if limit == 0 {
+		limit = DefaultPullLimit
+	}
+	if limit < 1 || limit > MaxPullLimit {
+		return nil, ErrInvalidLimit
+	}
+	cursor, err := decodePullCursor(rawCursor)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PullResponse{
+		Products: []*Product.Product{},
+		Sales:    []*Sale.Sale{},
+		Expenses: []*Expense.Expense{},
+		Deleted:  []Tombstone{},
+	}
+	branch := branchLimit(actor)
+
+	if User.HasPermission(actor.Role, User.PermProductsRead) {
+		var products []*Product.Product
+		query := s.db.Unscoped().Model(&Product.Product{}).Where("company_id = ?", actor.CompanyID)
+		more, err := pullChanges(query, cursor, EntityProduct, limit, &products)
+		if err != nil {
+			return nil, err
+		}
+		response.HasMore = response.HasMore || more
+		live := make([]*Product.Product, 0, len(products))
+		for _, product := range products {
+			cursor.advance(EntityProduct, product.ID, product.UpdatedAt, product.DeletedAt)
+			if response.tombstone(EntityProduct, product.ID, product.DeletedAt) {
+				continue
+			}
+			live = append(live, product)
+		}
+		if err := populateStock(live, actor); err != nil {
+			return nil, err
+		}
+		response.Products = live
+	}
+
+	if User.HasPermission(actor.Role, User.PermSalesRead) {
+		var sales []*Sale.Sale
+		query := s.db.Unscoped().Model(&Sale.Sale{}).Scopes(User.CompanyUserScope("seller_id", actor.CompanyID))
+		if branch != nil {
+			query = query.Where("seller_id IN (SELECT id FROM user_models WHERE branch_id = ?)", *branch)
+		}
+		more, err := pullChanges(query, cursor, EntitySale, limit, &sales)
+		if err != nil {
+			return nil, err
+		}
+		response.HasMore = response.HasMore || more
+		for _, sale := range sales {
+			cursor.advance(EntitySale, sale.ID, sale.UpdatedAt, sale.DeletedAt)
+			if !response.tombstone(EntitySale, sale.ID, sale.DeletedAt) {
+				response.Sales = append(response.Sales, sale)
+			}
+		}
+		Sale.GetSaleService().PopulateSales(response.Sales)
+	}
+
+	if User.HasPermission(actor.Role, User.PermExpensesRead) {
+		var expenses []*Expense.Expense
+		query := s.db.Unscoped().Model(&Expense.Expense{}).Scopes(User.CompanyBranchScope("branch_id", actor.CompanyID))
+		if branch != nil {
+			query = query.Where("branch_id = ?", *branch)
+		}
+		more, err := pullChanges(query, cursor, EntityExpense, limit, &expenses)
+		if err != nil {
+			return nil, err
+		}
+		response.HasMore = response.HasMore || more
+		for _, expense := range expenses {
+			cursor.advance(EntityExpense, expense.ID, expense.UpdatedAt, expense.DeletedAt)
+			if !response.tombstone(EntityExpense, expense.ID, expense.DeletedAt) {
+				response.Expenses = append(response.Expenses, expense)
+			}
+		}
+		Expense.GetExpenseService().PopulateExpenses(response.Expenses)
+	}
+
+	response.Cursor = cursor.encode()
+	return response, nil
+}
+
+// pullChanges loads up to limit rows of query changed after the entity's cursor
+// position, oldest first, and reports whether there are more
+func pullChanges[T any](query *gorm.DB, cursor pullCursor, entity Entity, limit int, dest *[]*T) (bool, error) {
+	if position, ok := cursor[entity]; ok {
+		query = query.Where("("+changedAt+", id) > (?, ?)", position.ChangedAt, position.ID)
+	}
+	if err := query.Order(changedAt + ", id").Limit(limit + 1).Find(dest).Error; err != nil {
+		return false, err
+	}
+	if len(*dest) > limit {
+		*dest = (*dest)[:limit]
+		return true, nil
+	}
+	return false, nil
+}
+
+// advance moves the entity's position past the row id
+func (c pullCursor) advance(entity Entity, id uint, updatedAt time.Time, deletedAt gorm.DeletedAt) {
+	changed := updatedAt
+	if deletedAt.Valid && deletedAt.Time.After(changed) {
+		changed = deletedAt.Time
+	}
+	c[entity] = pullPosition{ChangedAt: changed, ID: id}
+}
+
+// tombstone records the row id as deleted and reports whether it was
+func (r *PullResponse) tombstone(entity Entity, id uint, deletedAt gorm.DeletedAt) bool {
+	if !deletedAt.Valid {
+		return false
+	}
+	r.Deleted = append(r.Deleted, Tombstone{Entity: entity, ID: id, DeletedAt: deletedAt.Time})
+	return true
+}
@@ -0,0 +1,259 @@
+package Sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	Customer "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Customer"
+	Expense "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Expense"
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Sale "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Sale"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a throwaway database with every synced table and initializes the services on it
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t,
+		&Notification.Notification{}, &Idempotency.IdempotencyKey{},
+		&Product.Category{}, &Product.Product{}, &Product.StockMovement{}, &Product.CostLayer{},
+		&Product.ProductBarcode{}, &Product.BranchStock{}, &Customer.Customer{},
+		&Sale.Order{}, &Sale.Sale{}, &Sale.Payment{}, &Sale.SaleReturn{}, &Sale.ReceiptSequence{},
+		&Expense.Expense{}, &SyncRecord{},
+	)
+	Notification.InitializeService(db)
+	Idempotency.InitializeService(db)
+	Product.InitializeService(db)
+	Customer.InitializeService(db)
+	Sale.InitializeService(db)
+	Expense.InitializeService(db)
+	InitializeService(db)
+	return db
+}
+
+func actorFor(user *User.UserModel, companyID uint) Sale.SaleActor {
+	return Sale.SaleActor{UserID: user.ID, CompanyID: companyID, BranchID: user.BranchID, Role: user.Role}
+}
+
+// newProduct creates a product priced at 10 with quantity units at branch, and edits its
+// name once so that its version is 2
+func newProduct(t testing.TB, branch *User.Branch, quantity int) *Product.Product {
+	t.Helper()
+	branchID := branch.ID
+	product, err := Product.GetProductService().CreateProduct(Product.CreateProductRequest{
+		Name: "Widget", Price: 10, Currency: "UGX", CompanyID: branch.CompanyID, Quantity: quantity, BranchID: &branchID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "Blue widget"
+	if product, err = Product.GetProductService().UpdateProduct(product.ID, Product.UpdateProductRequest{Name: &name}, Product.StockChange{}); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func expenseChange(clientID string) *Change {
+	return &Change{ClientID: clientID, Entity: EntityExpense, Data: json.RawMessage(`{"amount": 5, "description": "Airtime", "currency": "UGX"}`)}
+}
+
+func push(t *testing.T, actor Sale.SaleActor, rules map[string]MergeRule, changes ...*Change) []*ChangeResult {
+	t.Helper()
+	results, err := GetSyncService().Push(PushRequest{DeviceID: "device-1", Changes: changes, MergeRules: rules}, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// A change pushed again with the same clientId is answered from the first push instead
+// of being applied twice, and a clientId cannot be reused for another kind of change
+func TestPushReplaysClientID(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	actor := actorFor(a.Owner, a.Company.ID)
+
+	first := push(t, actor, nil, expenseChange("c1"))[0]
+	if first.Status != Accepted || first.ServerID == nil {
+		t.Fatalf("first push: %+v", first)
+	}
+	again := push(t, actor, nil, expenseChange("c1"))[0]
+	if again.Status != Duplicate || again.ServerID == nil || *again.ServerID != *first.ServerID {
+		t.Errorf("replayed push: %+v, want duplicate of expense %d", again, *first.ServerID)
+	}
+	var count int64
+	db.Model(&Expense.Expense{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d expenses stored, want 1", count)
+	}
+
+	reused := &Change{ClientID: "c1", Entity: EntitySale, Data: json.RawMessage(`{}`)}
+	if result := push(t, actor, nil, reused)[0]; result.Status != Rejected || result.Code != "CLIENT_ID_REUSED" {
+		t.Errorf("clientId reused for a sale: %+v, want rejected CLIENT_ID_REUSED", result)
+	}
+}
+
+// A product update made against an older version is merged field by field: reject makes
+// it a conflict, client applies the device's value, server keeps the current value and
+// delta adds the device's stock change to the current stock
+func TestPushMergeRules(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	actor := actorFor(a.Owner, a.Company.ID)
+
+	update := func(clientID string, productID uint, data, base string) *Change {
+		change := &Change{ClientID: clientID, Entity: EntityProduct, Operation: OperationUpdate, ServerID: &productID, Data: json.RawMessage(data)}
+		if base != "" {
+			change.Base = json.RawMessage(base)
+		}
+		return change
+	}
+	stored := func(id uint) *Product.Product {
+		t.Helper()
+		product, err := Product.GetProductService().GetProductByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return product
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		product := newProduct(t, a.Branch, 10)
+		result := push(t, actor, nil, update("reject", product.ID, `{"price": 15, "version": 1}`, ""))[0]
+		if result.Status != Conflict || result.Code != "VERSION_CONFLICT" || result.Record == nil {
+			t.Errorf("stale price edit without a rule: %+v, want a conflict with the current record", result)
+		}
+		if price := stored(product.ID).Price; price != 10 {
+			t.Errorf("price = %v, want 10", price)
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		product := newProduct(t, a.Branch, 10)
+		result := push(t, actor, map[string]MergeRule{"price": MergeClient}, update("client", product.ID, `{"price": 15, "version": 1}`, ""))[0]
+		if result.Status != Accepted {
+			t.Fatalf("stale price edit with the client rule: %+v", result)
+		}
+		if price := stored(product.ID).Price; price != 15 {
+			t.Errorf("price = %v, want the device's 15", price)
+		}
+	})
+
+	t.Run("server", func(t *testing.T) {
+		product := newProduct(t, a.Branch, 10)
+		result := push(t, actor, map[string]MergeRule{"price": MergeServer}, update("server", product.ID, `{"price": 15, "version": 1}`, ""))[0]
+		if result.Status != Accepted {
+			t.Fatalf("stale price edit with the server rule: %+v", result)
+		}
+		if price := stored(product.ID).Price; price != 10 {
+			t.Errorf("price = %v, want the server's 10", price)
+		}
+	})
+
+	t.Run("delta", func(t *testing.T) {
+		product := newProduct(t, a.Branch, 10)
+		// Two units sell on the server while the device counts two more in
+		if _, err := Product.GetProductService().AdjustQuantityTx(db, product.ID, &a.Company.ID, -2, Product.StockChange{Reason: Product.MovementSale, BranchID: &a.Branch.ID}); err != nil {
+			t.Fatal(err)
+		}
+		result := push(t, actor, nil, update("delta", product.ID, `{"quantity": 12, "version": 1}`, `{"quantity": 10}`))[0]
+		if result.Status != Accepted {
+			t.Fatalf("stale stock edit with the default delta rule: %+v", result)
+		}
+		if quantity := stored(product.ID).Quantity; quantity != 10 {
+			t.Errorf("quantity = %d, want 8 on the server plus the device's 2", quantity)
+		}
+	})
+}
+
+// A pull pages through changes with its cursor, oldest first, and later pulls only
+// return what changed since, including deletions
+func TestPullCursorPaging(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	actor := actorFor(a.Owner, a.Company.ID)
+	for i := 0; i < 3; i++ {
+		push(t, actor, nil, expenseChange(fmt.Sprintf("c%d", i)))
+	}
+
+	first, err := GetSyncService().Pull("", 2, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Expenses) != 2 || !first.HasMore {
+		t.Fatalf("first pull: %d expenses, hasMore %v, want 2 and more", len(first.Expenses), first.HasMore)
+	}
+	second, err := GetSyncService().Pull(first.Cursor, 2, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Expenses) != 1 || second.HasMore {
+		t.Fatalf("second pull: %d expenses, hasMore %v, want the last 1", len(second.Expenses), second.HasMore)
+	}
+	seen := map[uint]bool{}
+	for _, expense := range append(first.Expenses, second.Expenses...) {
+		if seen[expense.ID] {
+			t.Errorf("expense %d pulled twice", expense.ID)
+		}
+		seen[expense.ID] = true
+	}
+
+	deleted := second.Expenses[0].ID
+	if err := db.Delete(&Expense.Expense{}, deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	third, err := GetSyncService().Pull(second.Cursor, 2, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(third.Expenses) != 0 || len(third.Deleted) != 1 || third.Deleted[0].ID != deleted {
+		t.Errorf("pull after a delete: %d expenses, deleted %+v, want only the tombstone of %d", len(third.Expenses), third.Deleted, deleted)
+	}
+
+	if _, err := GetSyncService().Pull("not-a-cursor", 2, actor); err != ErrInvalidCursor {
+		t.Errorf("invalid cursor: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+// A pull only returns the caller's company, and a branch manager only gets their branch
+func TestPullIsScopedToCompanyAndBranch(t *testing.T) {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	other := Testutil.NewBranch(t, db, a.Company.ID, "a Other")
+	manager := Testutil.NewUser(t, db, other, "a-manager", User.BranchManager)
+
+	newProduct(t, b.Branch, 5)
+	push(t, actorFor(b.Owner, b.Company.ID), nil, expenseChange("b1"))
+	own := push(t, actorFor(a.Owner, a.Company.ID), nil, expenseChange("a1"))[0]
+	managed := push(t, actorFor(manager, a.Company.ID), nil, expenseChange("a2"))[0]
+
+	pull, err := GetSyncService().Pull("", 0, actorFor(a.Owner, a.Company.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pull.Products) != 0 {
+		t.Errorf("company A pulled %d products of company B", len(pull.Products))
+	}
+	if len(pull.Expenses) != 2 {
+		t.Errorf("company A's owner pulled %d expenses, want its own 2", len(pull.Expenses))
+	}
+	for _, expense := range pull.Expenses {
+		if expense.ID != *own.ServerID && expense.ID != *managed.ServerID {
+			t.Errorf("company A pulled expense %d of company B", expense.ID)
+		}
+	}
+
+	pull, err = GetSyncService().Pull("", 0, actorFor(manager, a.Company.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pull.Expenses) != 1 || pull.Expenses[0].ID != *managed.ServerID {
+		t.Errorf("branch manager pulled %d expenses, want only their branch's %d", len(pull.Expenses), *managed.ServerID)
+	}
+}
@@ -0,0 +1,177 @@
+// Package Testutil holds the fixtures the module tests share: a throwaway database,
+// seeded companies and users, and helpers for calling routes and counting queries.
+// Only _test.go files import it.
+package Testutil
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	Company "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	// Receipt numbering and the stock backfills stamp rows with Postgres' NOW()
+	if err := sqlitedriver.RegisterScalarFunction("now", 0, func(*sqlitedriver.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now(), nil
+	}); err != nil {
+		panic(err)
+	}
+	// Sync pulls order rows by Postgres' GREATEST of two timestamps
+	if err := sqlitedriver.RegisterScalarFunction("greatest", 2, func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if later(args[1], args[0]) {
+			return args[1], nil
+		}
+		return args[0], nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// later reports whether timestamp a is after b. SQLite hands them over as times or as
+// text in one layout, which sorts in time order.
+func later(a, b driver.Value) bool {
+	switch a := a.(type) {
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.After(b)
+	case string:
+		b, ok := b.(string)
+		return ok && a > b
+	}
+	return false
+}
+
+// Tenant is a company seeded for tests, with one branch and its owner
+type Tenant struct {
+	Company *Company.Company
+	Branch  *User.Branch
+	Owner   *User.UserModel
+	Token   string // Bearer token for Owner
+}
+
+// NewDB opens a throwaway database with the company and user tables plus models, and
+// initializes the company and user services on it. Callers initialize their own services.
+func NewDB(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := append([]interface{}{&Company.Company{}, &User.Branch{}, &User.UserModel{}, &User.NotificationPreferences{}}, models...)
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+
+	Company.InitializeService(db)
+	User.InitializeService(db)
+	return db
+}
+
+// NewTenant seeds a company with a main branch and an owner who can do everything
+func NewTenant(t testing.TB, db *gorm.DB, name string) *Tenant {
+	t.Helper()
+	company := &Company.Company{Name: name, Email: name + "@example.com"}
+	if err := db.Create(company).Error; err != nil {
+		t.Fatal(err)
+	}
+	branch := NewBranch(t, db, company.ID, name+" Main")
+	owner := NewUser(t, db, branch, name+"-owner", User.SuperAdmin)
+	return &Tenant{Company: company, Branch: branch, Owner: owner, Token: Token(t, owner)}
+}
+
+// NewBranch seeds a branch of the company
+func NewBranch(t testing.TB, db *gorm.DB, companyID uint, name string) *User.Branch {
+	t.Helper()
+	branch := &User.Branch{Name: name, CompanyID: companyID}
+	if err := db.Create(branch).Error; err != nil {
+		t.Fatal(err)
+	}
+	return branch
+}
+
+// NewUser seeds a user with role at branch
+func NewUser(t testing.TB, db *gorm.DB, branch *User.Branch, username string, role User.UserRole) *User.UserModel {
+	t.Helper()
+	branchID := branch.ID
+	user := &User.UserModel{Name: username, Username: username, Password: "x", Role: role, BranchID: &branchID}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// Token signs a bearer token for user
+func Token(t testing.TB, user *User.UserModel) string {
+	t.Helper()
+	token, err := User.GenerateJWT(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// NewRouter mounts each module's routes under /api/v1 behind the auth middleware, like main.go
+func NewRouter(routes ...func(*gin.RouterGroup)) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api/v1")
+	protected.Use(User.AuthMiddleware())
+	for _, register := range routes {
+		register(protected)
+	}
+	return r
+}
+
+// NewRequest builds a request authorized with token. A body is sent as JSON.
+func NewRequest(method, path, token string, body ...string) *http.Request {
+	var req *http.Request
+	if len(body) > 0 {
+		req = httptest.NewRequest(method, path, strings.NewReader(body[0]))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// Serve sends a request authorized with token through r and records the response.
+// A body is sent as JSON.
+func Serve(r http.Handler, method, path, token string, body ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, NewRequest(method, path, token, body...))
+	return w
+}
+
+// CountQueries returns how many statements run reads while fn runs
+func CountQueries(t testing.TB, db *gorm.DB, fn func()) int {
+	t.Helper()
+	count := 0
+	counter := func(*gorm.DB) { count++ }
+	name := fmt.Sprintf("test:count_queries_%p", &count)
+	if err := db.Callback().Query().After("gorm:query").Register(name, counter); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Row().After("gorm:row").Register(name, counter); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		db.Callback().Query().Remove(name)
+		db.Callback().Row().Remove(name)
+	}()
+	fn()
+	return count
+}
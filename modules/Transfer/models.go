@@ -0,0 +1,83 @@
+package Transfer
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TransferStatus string
+
+const (
+	Pending   TransferStatus = "pending"    // Created, stock still at the source branch
+	InTransit TransferStatus = "in_transit" // Dispatched, stock taken from the source branch
+	Received  TransferStatus = "received"   // Confirmed by the destination branch
+	Cancelled TransferStatus = "cancelled"
+)
+
+// Transfer moves stock of one or more products from one branch of a company to another
+type Transfer struct {
+	gorm.Model
+	CompanyID    uint           `json:"companyId" gorm:"not null;index"`
+	FromBranchID uint           `json:"fromBranchId" gorm:"not null;index"`
+	ToBranchID   uint           `json:"toBranchId" gorm:"not null;index"`
+	Status       TransferStatus `json:"status" gorm:"not null;default:'pending';index"`
+	Notes        *string        `json:"notes,omitempty"`
+
+	CreatedByID    uint       `json:"createdById" gorm:"not null"`
+	DispatchedByID *uint      `json:"dispatchedById,omitempty"`
+	DispatchedAt   *time.Time `json:"dispatchedAt,omitempty"`
+	ReceivedByID   *uint      `json:"receivedById,omitempty"`
+	ReceivedAt     *time.Time `json:"receivedAt,omitempty"`
+	CancelledByID  *uint      `json:"cancelledById,omitempty"`
+	CancelledAt    *time.Time `json:"cancelledAt,omitempty"`
+
+	Items []*TransferItem `json:"items" gorm:"foreignKey:TransferID"`
+
+	// Relationships (for JSON response - computed from FK)
+	FromBranch *BranchResponse `json:"fromBranch,omitempty" gorm:"-"`
+	ToBranch   *BranchResponse `json:"toBranch,omitempty" gorm:"-"`
+}
+
+// TransferItem is one product line of a transfer
+type TransferItem struct {
+	gorm.Model
+	TransferID       uint    `json:"transferId" gorm:"not null;index"`
+	ProductID        uint    `json:"productId" gorm:"not null;index"`
+	ProductName      string  `json:"productName" gorm:"not null"`
+	Quantity         int     `json:"quantity" gorm:"not null"`     // Sent by the source branch
+	QuantityReceived *int    `json:"quantityReceived,omitempty"`   // Counted by the destination branch
+	Discrepancy      int     `json:"discrepancy" gorm:"default:0"` // Quantity - QuantityReceived; positive when short
+	DiscrepancyNote  *string `json:"discrepancyNote,omitempty"`
+}
+
+// BranchResponse is used for JSON serialization
+type BranchResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	AdminUserID *uint  `json:"adminUserId,omitempty"`
+}
+
+type TransferItemRequest struct {
+	ProductID uint `json:"productId" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required"`
+}
+
+type CreateTransferRequest struct {
+	FromBranchID *uint                 `json:"fromBranchId,omitempty"` // Defaults to the caller's branch
+	ToBranchID   uint                  `json:"toBranchId" binding:"required"`
+	Items        []TransferItemRequest `json:"items" binding:"required,min=1,dive"`
+	Notes        *string               `json:"notes,omitempty"`
+	Dispatch     bool                  `json:"dispatch,omitempty"` // Dispatch immediately instead of leaving the transfer pending
+}
+
+// ReceivedItemRequest reports the counted quantity of one line. Lines left out are received in full.
+type ReceivedItemRequest struct {
+	ItemID           uint    `json:"itemId" binding:"required"`
+	QuantityReceived int     `json:"quantityReceived"`
+	Note             *string `json:"note,omitempty"`
+}
+
+type ReceiveTransferRequest struct {
+	Items []ReceivedItemRequest `json:"items"`
+}
@@ -0,0 +1,298 @@
+package Transfer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+func RegisterRoutes(rg *gin.RouterGroup) {
+	transfers := rg.Group("/transfers")
+	{
+		transfers.GET("", User.RequirePermission(User.PermTransfersRead), getTransfersHandler)
+		transfers.GET("/:id", User.RequirePermission(User.PermTransfersRead), getTransferHandler)
+		transfers.POST("", User.RequirePermission(User.PermTransfersWrite), createTransferHandler)
+		transfers.POST("/:id/dispatch", User.RequirePermission(User.PermTransfersWrite), dispatchTransferHandler)
+		transfers.POST("/:id/receive", User.RequirePermission(User.PermTransfersWrite), receiveTransferHandler)
+		transfers.POST("/:id/cancel", User.RequirePermission(User.PermTransfersWrite), cancelTransferHandler)
+	}
+}
+
+// transferListSpec is what GET /transfers sorts and filters by
+var transferListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"createdAt": "created_at",
+	},
+	DefaultSort: "-createdAt",
+	Filters: map[string]Query.Filter{
+		"branchId":     {Kind: Query.UintFilter}, // From or to the branch
+		"fromBranchId": {Column: "from_branch_id", Kind: Query.UintFilter},
+		"toBranchId":   {Column: "to_branch_id", Kind: Query.UintFilter},
+		"status":       {Column: "status"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"notes"},
+}
+
+// getTransfersHandler lists the company's transfers. Branch-limited roles only see
+// transfers from or to their branch.
+func getTransfersHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, transferListSpec)
+	if !ok || !User.LimitToBranch(c, params) {
+		return
+	}
+
+	transfers, page, err := GetTransferService().ListTransfers(companyID, params)
+	if err != nil {
+		Query.ErrorResponse(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers, "page": page})
+}
+
+func getTransferHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	transfer, ok := visibleTransfer(c, companyID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+func createTransferHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req CreateTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, branchID := callerFromContext(c)
+	if req.FromBranchID != nil {
+		branchID = req.FromBranchID
+	}
+	if branchID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fromBranchId is required"})
+		return
+	}
+	// Only the source branch can send its stock
+	if !User.CanAccessBranch(c, *branchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	transfer, err := GetTransferService().CreateTransfer(companyID, userID, *branchID, req)
+	if err != nil {
+		transferErrorResponse(c, err)
+		return
+	}
+
+	if transfer.Status == InTransit {
+		notifyBranchAdmins(transfer, "Transfer Dispatched", fmt.Sprintf("Transfer #%d of %s is on its way from %s to %s", transfer.ID, itemSummary(transfer), branchName(transfer.FromBranch), branchName(transfer.ToBranch)))
+	} else {
+		notifyBranchAdmins(transfer, "Transfer Created", fmt.Sprintf("Transfer #%d of %s from %s to %s is awaiting dispatch", transfer.ID, itemSummary(transfer), branchName(transfer.FromBranch), branchName(transfer.ToBranch)))
+	}
+	c.JSON(http.StatusCreated, transfer)
+}
+
+func dispatchTransferHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visibleTransfer(c, companyID)
+	if !ok {
+		return
+	}
+	if !User.CanAccessBranch(c, existing.FromBranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	transfer, err := GetTransferService().DispatchTransfer(existing.ID, companyID, userID)
+	if err != nil {
+		transferErrorResponse(c, err)
+		return
+	}
+
+	notifyBranchAdmins(transfer, "Transfer Dispatched", fmt.Sprintf("Transfer #%d of %s is on its way from %s to %s", transfer.ID, itemSummary(transfer), branchName(transfer.FromBranch), branchName(transfer.ToBranch)))
+	c.JSON(http.StatusOK, transfer)
+}
+
+// receiveTransferHandler confirms receipt at the destination branch. Lines not listed
+// in the body are received in full.
+func receiveTransferHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req ReceiveTransferRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	existing, ok := visibleTransfer(c, companyID)
+	if !ok {
+		return
+	}
+	if !User.CanAccessBranch(c, existing.ToBranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	transfer, err := GetTransferService().ReceiveTransfer(existing.ID, companyID, userID, req)
+	if err != nil {
+		transferErrorResponse(c, err)
+		return
+	}
+
+	message := fmt.Sprintf("Transfer #%d from %s was received at %s", transfer.ID, branchName(transfer.FromBranch), branchName(transfer.ToBranch))
+	short := 0
+	for _, item := range transfer.Items {
+		short += item.Discrepancy
+	}
+	if short != 0 {
+		message += fmt.Sprintf(" with a discrepancy of %d units", short)
+	}
+	notifyBranchAdmins(transfer, "Transfer Received", message)
+	c.JSON(http.StatusOK, transfer)
+}
+
+func cancelTransferHandler(c *gin.Context) {
+	companyID, ok := User.CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	existing, ok := visibleTransfer(c, companyID)
+	if !ok {
+		return
+	}
+	if !User.CanAccessBranch(c, existing.FromBranchID) {
+		User.BranchAccessDenied(c)
+		return
+	}
+
+	userID, _ := callerFromContext(c)
+	transfer, err := GetTransferService().CancelTransfer(existing.ID, companyID, userID)
+	if err != nil {
+		transferErrorResponse(c, err)
+		return
+	}
+
+	notifyBranchAdmins(transfer, "Transfer Cancelled", fmt.Sprintf("Transfer #%d from %s to %s was cancelled", transfer.ID, branchName(transfer.FromBranch), branchName(transfer.ToBranch)))
+	c.JSON(http.StatusOK, transfer)
+}
+
+// visibleTransfer loads the transfer named by the :id parameter. Transfers of other
+// companies, or that do not involve a branch-limited caller's branch, are not found.
+func visibleTransfer(c *gin.Context, companyID uint) (*Transfer, bool) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transfer id"})
+		return nil, false
+	}
+
+	transfer, err := GetTransferService().GetTransferByID(uint(id), companyID)
+	if err != nil || (!User.CanAccessBranch(c, transfer.FromBranchID) && !User.CanAccessBranch(c, transfer.ToBranchID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrTransferNotFound.Error(), "code": "TRANSFER_NOT_FOUND"})
+		return nil, false
+	}
+	return transfer, true
+}
+
+// callerFromContext returns the authenticated user and their branch
+func callerFromContext(c *gin.Context) (uint, *uint) {
+	userID, _ := c.Get("user_id")
+	userIDUint, _ := userID.(uint)
+	branchID, _ := c.Get("branch_id")
+	branchIDPtr, _ := branchID.(*uint)
+	return userIDUint, branchIDPtr
+}
+
+// notifyBranchAdmins sends an inventory notification to the admins of both branches
+func notifyBranchAdmins(transfer *Transfer, title string, message string) {
+	notificationService := Notification.GetNotificationService()
+	if notificationService == nil {
+		return
+	}
+
+	var userIDs []uint
+	for _, branch := range []*BranchResponse{transfer.FromBranch, transfer.ToBranch} {
+		if branch == nil || branch.AdminUserID == nil {
+			continue
+		}
+		if len(userIDs) == 1 && userIDs[0] == *branch.AdminUserID {
+			continue
+		}
+		userIDs = append(userIDs, *branch.AdminUserID)
+	}
+
+	transferID := transfer.ID
+	_, _ = notificationService.CreateNotificationForUsers(userIDs, Notification.CreateNotificationRequest{
+		Type:      Notification.NotificationTypeInventory,
+		Title:     title,
+		Message:   message,
+		RelatedID: &transferID,
+	})
+}
+
+func itemSummary(transfer *Transfer) string {
+	units := 0
+	for _, item := range transfer.Items {
+		units += item.Quantity
+	}
+	if len(transfer.Items) == 1 {
+		return fmt.Sprintf("%d units of %s", units, transfer.Items[0].ProductName)
+	}
+	return fmt.Sprintf("%d units across %d products", units, len(transfer.Items))
+}
+
+func branchName(branch *BranchResponse) string {
+	if branch == nil {
+		return "another branch"
+	}
+	return branch.Name
+}
+
+// transferErrorResponse writes a service error with its status and code
+func transferErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "TRANSFER_NOT_FOUND"})
+	case errors.Is(err, ErrBranchNotFound), errors.Is(err, Product.ErrBranchNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "BRANCH_NOT_FOUND"})
+	case errors.Is(err, Product.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "PRODUCT_NOT_FOUND"})
+	case errors.Is(err, Product.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INSUFFICIENT_STOCK"})
+	case errors.Is(err, ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_TRANSITION"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
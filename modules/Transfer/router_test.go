@@ -0,0 +1,193 @@
+package Transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	Idempotency "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Idempotency"
+	Notification "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Notification"
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a throwaway database with the transfer tables and initializes the services on it
+func newTestDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db := Testutil.NewDB(t,
+		&Notification.Notification{}, &Idempotency.IdempotencyKey{},
+		&Product.Category{}, &Product.Product{}, &Product.StockMovement{}, &Product.CostLayer{},
+		&Product.ProductBarcode{}, &Product.BranchStock{}, &Transfer{}, &TransferItem{},
+	)
+	Notification.InitializeService(db)
+	Idempotency.InitializeService(db)
+	Product.InitializeService(db)
+	InitializeService(db)
+	return db
+}
+
+// newProduct creates a product with quantity units at branch
+func newProduct(t testing.TB, branch *User.Branch, quantity int) *Product.Product {
+	t.Helper()
+	branchID := branch.ID
+	product, err := Product.GetProductService().CreateProduct(Product.CreateProductRequest{
+		Name: "Widget", Price: 10, Currency: "UGX", CompanyID: branch.CompanyID, Quantity: quantity, BranchID: &branchID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func branchQuantity(t testing.TB, productID, branchID uint) int {
+	t.Helper()
+	quantity, err := Product.GetProductService().BranchQuantityTx(GetTransferService().db, productID, branchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return quantity
+}
+
+// transferFlow is a company with a product at its main branch and a manager at the main
+// branch and at a second one, mounted behind the transfer routes
+type transferFlow struct {
+	tenant  *Testutil.Tenant
+	to      *User.Branch
+	product *Product.Product
+	from    string // Bearer token of the main branch's manager
+	dest    string // Bearer token of the second branch's manager
+	serve   func(method, path, token, body string) (int, *Transfer)
+}
+
+func newTransferFlow(t *testing.T) *transferFlow {
+	db := newTestDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	to := Testutil.NewBranch(t, db, a.Company.ID, "a Other")
+	r := Testutil.NewRouter(RegisterRoutes)
+	return &transferFlow{
+		tenant:  a,
+		to:      to,
+		product: newProduct(t, a.Branch, 10),
+		from:    Testutil.Token(t, Testutil.NewUser(t, db, a.Branch, "a-main-manager", User.BranchManager)),
+		dest:    Testutil.Token(t, Testutil.NewUser(t, db, to, "a-other-manager", User.BranchManager)),
+		serve: func(method, path, token, body string) (int, *Transfer) {
+			t.Helper()
+			w := Testutil.Serve(r, method, path, token, body)
+			var transfer Transfer
+			if w.Code < 300 {
+				if err := json.Unmarshal(w.Body.Bytes(), &transfer); err != nil {
+					t.Fatalf("%s %s: %v", method, path, err)
+				}
+			}
+			return w.Code, &transfer
+		},
+	}
+}
+
+// create makes a pending transfer of quantity units from the main branch to the second one
+func (f *transferFlow) create(t *testing.T, quantity int) *Transfer {
+	t.Helper()
+	body := fmt.Sprintf(`{"toBranchId": %d, "items": [{"productId": %d, "quantity": %d}]}`, f.to.ID, f.product.ID, quantity)
+	code, transfer := f.serve(http.MethodPost, "/api/v1/transfers", f.from, body)
+	if code != http.StatusCreated || transfer.Status != Pending {
+		t.Fatalf("POST /transfers: %d, status %q", code, transfer.Status)
+	}
+	return transfer
+}
+
+// Stock stays at the source while a transfer is pending, leaves it on dispatch and only
+// arrives at the destination on receipt
+func TestTransferMovesStockOnDispatchAndReceive(t *testing.T) {
+	f := newTransferFlow(t)
+	main := f.tenant.Branch.ID
+	transfer := f.create(t, 4)
+	if got := branchQuantity(t, f.product.ID, main); got != 10 {
+		t.Errorf("source holds %d while pending, want 10", got)
+	}
+
+	code, dispatched := f.serve(http.MethodPost, fmt.Sprintf("/api/v1/transfers/%d/dispatch", transfer.ID), f.from, "")
+	if code != http.StatusOK || dispatched.Status != InTransit {
+		t.Fatalf("dispatch: %d, status %q", code, dispatched.Status)
+	}
+	if got := branchQuantity(t, f.product.ID, main); got != 6 {
+		t.Errorf("source holds %d after dispatch, want 6", got)
+	}
+	if got := branchQuantity(t, f.product.ID, f.to.ID); got != 0 {
+		t.Errorf("destination holds %d in transit, want 0", got)
+	}
+
+	code, received := f.serve(http.MethodPost, fmt.Sprintf("/api/v1/transfers/%d/receive", transfer.ID), f.dest, `{}`)
+	if code != http.StatusOK || received.Status != Received {
+		t.Fatalf("receive: %d, status %q", code, received.Status)
+	}
+	if got := branchQuantity(t, f.product.ID, main); got != 6 {
+		t.Errorf("source holds %d after receipt, want 6", got)
+	}
+	if got := branchQuantity(t, f.product.ID, f.to.ID); got != 4 {
+		t.Errorf("destination holds %d after receipt, want 4", got)
+	}
+	product, err := Product.GetProductService().GetProductByID(f.product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Quantity != 10 {
+		t.Errorf("company total = %d, want 10", product.Quantity)
+	}
+}
+
+// Cancelling a transfer in transit returns its stock to the source branch
+func TestCancelReturnsStockToSource(t *testing.T) {
+	f := newTransferFlow(t)
+	transfer := f.create(t, 4)
+	if code, _ := f.serve(http.MethodPost, fmt.Sprintf("/api/v1/transfers/%d/dispatch", transfer.ID), f.from, ""); code != http.StatusOK {
+		t.Fatalf("dispatch: %d", code)
+	}
+
+	code, cancelled := f.serve(http.MethodPost, fmt.Sprintf("/api/v1/transfers/%d/cancel", transfer.ID), f.from, "")
+	if code != http.StatusOK || cancelled.Status != Cancelled {
+		t.Fatalf("cancel: %d, status %q", code, cancelled.Status)
+	}
+	if got := branchQuantity(t, f.product.ID, f.tenant.Branch.ID); got != 10 {
+		t.Errorf("source holds %d after cancelling, want 10", got)
+	}
+	if code, _ := f.serve(http.MethodPost, fmt.Sprintf("/api/v1/transfers/%d/receive", transfer.ID), f.dest, `{}`); code != http.StatusConflict {
+		t.Errorf("receiving a cancelled transfer: %d, want 409", code)
+	}
+}
+
+// Only the destination branch receives a transfer and only the source dispatches it;
+// a branch-limited user of either end cannot act for the other
+func TestBranchLimitedUserCannotActForTheOtherBranch(t *testing.T) {
+	f := newTransferFlow(t)
+	transfer := f.create(t, 4)
+	dispatch := fmt.Sprintf("/api/v1/transfers/%d/dispatch", transfer.ID)
+	receive := fmt.Sprintf("/api/v1/transfers/%d/receive", transfer.ID)
+
+	if code, _ := f.serve(http.MethodPost, dispatch, f.dest, ""); code != http.StatusForbidden {
+		t.Errorf("destination manager dispatching: %d, want 403", code)
+	}
+	if code, _ := f.serve(http.MethodPost, dispatch, f.from, ""); code != http.StatusOK {
+		t.Fatalf("dispatch: %d", code)
+	}
+	if code, _ := f.serve(http.MethodPost, receive, f.from, `{}`); code != http.StatusForbidden {
+		t.Errorf("source manager receiving into the other branch: %d, want 403", code)
+	}
+	if got := branchQuantity(t, f.product.ID, f.to.ID); got != 0 {
+		t.Errorf("destination holds %d after the refused receipt, want 0", got)
+	}
+
+	// A manager of a third branch does not see the transfer at all
+	db := GetTransferService().db
+	third := Testutil.NewBranch(t, db, f.tenant.Company.ID, "a Third")
+	outsider := Testutil.Token(t, Testutil.NewUser(t, db, third, "a-third-manager", User.BranchManager))
+	if code, _ := f.serve(http.MethodPost, receive, outsider, `{}`); code != http.StatusNotFound {
+		t.Errorf("third branch manager receiving: %d, want 404", code)
+	}
+
+	if code, _ := f.serve(http.MethodPost, receive, f.dest, `{}`); code != http.StatusOK {
+		t.Errorf("destination manager receiving: %d, want 200", code)
+	}
+}
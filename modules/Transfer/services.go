@@ -0,0 +1,350 @@
+package Transfer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	Product "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Product"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var transferService *TransferService
+
+var (
+	// ErrTransferNotFound is returned when a transfer does not exist in the caller's company
+	ErrTransferNotFound = errors.New("transfer not found")
+	// ErrSameBranch is returned when a transfer's source and destination are the same branch
+	ErrSameBranch = errors.New("source and destination branch must differ")
+	// ErrBranchNotFound is returned when either branch is not in the caller's company
+	ErrBranchNotFound = errors.New("branch not found")
+	// ErrInvalidQuantity is returned for line quantities that are not positive
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrInvalidReceivedQuantity is returned when a received quantity is negative or above what was sent
+	ErrInvalidReceivedQuantity = errors.New("received quantity must be between zero and the quantity sent")
+	// ErrItemNotFound is returned when a received line is not part of the transfer
+	ErrItemNotFound = errors.New("transfer item not found")
+	// ErrInvalidTransition is returned when a transfer is not in the status an action needs
+	ErrInvalidTransition = errors.New("transfer cannot be changed in its current status")
+)
+
+type TransferService struct {
+	db *gorm.DB
+}
+
+func NewTransferService() *TransferService {
+	return &TransferService{}
+}
+
+// InitializeService initializes the transfer service with a database connection
+func InitializeService(db *gorm.DB) {
+	transferService = &TransferService{db: db}
+}
+
+// GetTransferService returns the initialized transfer service
+func GetTransferService() *TransferService {
+	return transferService
+}
+
+func (s *TransferService) GetTransferByID(id uint, companyID uint) (*Transfer, error) {
+	var transfer Transfer
+	if err := s.db.Preload("Items").Where("company_id = ?", companyID).First(&transfer, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+	s.populateBranches(companyID, &transfer)
+	return &transfer, nil
+}
+
+// ListTransfers returns one page of the company's transfers matching params.
+// The branchId filter matches transfers from or to the branch.
+func (s *TransferService) ListTransfers(companyID uint, params *Query.Params) ([]*Transfer, *Query.Page, error) {
+	query := s.db.Model(&Transfer{}).Where("company_id = ?", companyID)
+	if branchID := params.Uint("branchId"); branchID != nil {
+		query = query.Where("from_branch_id = ? OR to_branch_id = ?", *branchID, *branchID)
+	}
+
+	var transfers []*Transfer
+	page, err := Query.Paginate(query, params, &transfers, "Items")
+	if err != nil {
+		return nil, nil, err
+	}
+	s.populateBranches(companyID, transfers...)
+	return transfers, page, nil
+}
+
+// CreateTransfer records a pending transfer between two branches of the company.
+// With req.Dispatch set, the stock also leaves the source branch in the same transaction.
+func (s *TransferService) CreateTransfer(companyID uint, userID uint, fromBranchID uint, req CreateTransferRequest) (*Transfer, error) {
+	if fromBranchID == req.ToBranchID {
+		return nil, ErrSameBranch
+	}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
+	}
+	branchService := User.GetBranchService()
+	if _, err := branchService.GetBranchByID(fromBranchID, companyID); err != nil {
+		return nil, ErrBranchNotFound
+	}
+	if _, err := branchService.GetBranchByID(req.ToBranchID, companyID); err != nil {
+		return nil, ErrBranchNotFound
+	}
+
+	transfer := &Transfer{
+		CompanyID:    companyID,
+		FromBranchID: fromBranchID,
+		ToBranchID:   req.ToBranchID,
+		Status:       Pending,
+		Notes:        req.Notes,
+		CreatedByID:  userID,
+		Items:        make([]*TransferItem, len(req.Items)),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, item := range req.Items {
+			var product Product.Product
+			if err := tx.Where("company_id = ?", companyID).First(&product, "id = ?", item.ProductID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return Product.ErrProductNotFound
+				}
+				return err
+			}
+			transfer.Items[i] = &TransferItem{
+				ProductID:   product.ID,
+				ProductName: product.Name,
+				Quantity:    item.Quantity,
+			}
+		}
+
+		if err := tx.Create(transfer).Error; err != nil {
+			return err
+		}
+		if req.Dispatch {
+			return s.dispatchTx(tx, transfer, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.populateBranches(companyID, transfer)
+	return transfer, nil
+}
+
+// DispatchTransfer takes the stock of every line from the source branch and marks the transfer in transit
+func (s *TransferService) DispatchTransfer(id uint, companyID uint, userID uint) (*Transfer, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		transfer, err := s.lockTransferTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if transfer.Status != Pending {
+			return ErrInvalidTransition
+		}
+		return s.dispatchTx(tx, transfer, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTransferByID(id, companyID)
+}
+
+// ReceiveTransfer adds the received quantities to the destination branch and records
+// the difference from what was sent on each line
+func (s *TransferService) ReceiveTransfer(id uint, companyID uint, userID uint, req ReceiveTransferRequest) (*Transfer, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		transfer, err := s.lockTransferTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if transfer.Status != InTransit {
+			return ErrInvalidTransition
+		}
+
+		counted := make(map[uint]ReceivedItemRequest, len(req.Items))
+		for _, item := range req.Items {
+			counted[item.ItemID] = item
+		}
+		for itemID := range counted {
+			if !hasItem(transfer, itemID) {
+				return ErrItemNotFound
+			}
+		}
+
+		notes := fmt.Sprintf("Transfer #%d received", transfer.ID)
+		for _, item := range sortedItems(transfer) {
+			received := item.Quantity
+			if count, ok := counted[item.ID]; ok {
+				if count.QuantityReceived < 0 || count.QuantityReceived > item.Quantity {
+					return ErrInvalidReceivedQuantity
+				}
+				received = count.QuantityReceived
+				item.DiscrepancyNote = count.Note
+			}
+			item.QuantityReceived = &received
+			item.Discrepancy = item.Quantity - received
+
+			// The whole line arrives as a transfer and the shortfall leaves as damage, so
+			// the missing units use up cost layers like any other stock written off
+			if _, err := Product.GetProductService().AdjustQuantityTx(tx, item.ProductID, &companyID, item.Quantity, s.stockChange(transfer, userID, transfer.ToBranchID, &notes)); err != nil {
+				return err
+			}
+			if item.Discrepancy > 0 {
+				if err := s.writeOffShortfallTx(tx, transfer, item, userID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		transfer.Status = Received
+		transfer.ReceivedByID = &userID
+		transfer.ReceivedAt = &now
+		return tx.Omit("Items").Save(transfer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTransferByID(id, companyID)
+}
+
+// CancelTransfer cancels a pending or in-transit transfer. Stock already dispatched
+// goes back to the source branch.
+func (s *TransferService) CancelTransfer(id uint, companyID uint, userID uint) (*Transfer, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		transfer, err := s.lockTransferTx(tx, id, companyID)
+		if err != nil {
+			return err
+		}
+		if transfer.Status != Pending && transfer.Status != InTransit {
+			return ErrInvalidTransition
+		}
+
+		if transfer.Status == InTransit {
+			notes := fmt.Sprintf("Transfer #%d cancelled", transfer.ID)
+			for _, item := range sortedItems(transfer) {
+				if _, err := Product.GetProductService().AdjustQuantityTx(tx, item.ProductID, &companyID, item.Quantity, s.stockChange(transfer, userID, transfer.FromBranchID, &notes)); err != nil {
+					return err
+				}
+			}
+		}
+
+		now := time.Now()
+		transfer.Status = Cancelled
+		transfer.CancelledByID = &userID
+		transfer.CancelledAt = &now
+		return tx.Omit("Items").Save(transfer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTransferByID(id, companyID)
+}
+
+// dispatchTx takes every line's stock from the source branch
+func (s *TransferService) dispatchTx(tx *gorm.DB, transfer *Transfer, userID uint) error {
+	notes := fmt.Sprintf("Transfer #%d dispatched", transfer.ID)
+	for _, item := range sortedItems(transfer) {
+		if _, err := Product.GetProductService().AdjustQuantityTx(tx, item.ProductID, &transfer.CompanyID, -item.Quantity, s.stockChange(transfer, userID, transfer.FromBranchID, &notes)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	transfer.Status = InTransit
+	transfer.DispatchedByID = &userID
+	transfer.DispatchedAt = &now
+	return tx.Omit("Items").Save(transfer).Error
+}
+
+// writeOffShortfallTx books the units of item that never arrived as a damage movement
+// at the destination branch
+func (s *TransferService) writeOffShortfallTx(tx *gorm.DB, transfer *Transfer, item *TransferItem, userID uint) error {
+	notes := fmt.Sprintf("Transfer #%d short by %d", transfer.ID, item.Discrepancy)
+	if item.DiscrepancyNote != nil && *item.DiscrepancyNote != "" {
+		notes += ": " + *item.DiscrepancyNote
+	}
+	change := s.stockChange(transfer, userID, transfer.ToBranchID, &notes)
+	change.Reason = Product.MovementDamage
+	_, err := Product.GetProductService().AdjustQuantityTx(tx, item.ProductID, &transfer.CompanyID, -item.Discrepancy, change)
+	return err
+}
+
+func (s *TransferService) lockTransferTx(tx *gorm.DB, id uint, companyID uint) (*Transfer, error) {
+	var transfer Transfer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("company_id = ?", companyID).First(&transfer, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTransferNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Where("transfer_id = ?", transfer.ID).Find(&transfer.Items).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (s *TransferService) stockChange(transfer *Transfer, userID uint, branchID uint, notes *string) Product.StockChange {
+	return Product.StockChange{
+		Reason:      Product.MovementTransfer,
+		ReferenceID: &transfer.ID,
+		UserID:      &userID,
+		BranchID:    &branchID,
+		Notes:       notes,
+	}
+}
+
+// populateBranches populates both branches of companyID's transfers from their FKs with one query
+func (s *TransferService) populateBranches(companyID uint, transfers ...*Transfer) {
+	ids := make([]uint, 0, 2*len(transfers))
+	for _, transfer := range transfers {
+		ids = append(ids, transfer.FromBranchID, transfer.ToBranchID)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var branches []*User.Branch
+	if err := s.db.Scopes(User.CompanyScope("company_id", companyID)).Where("id IN ?", ids).Find(&branches).Error; err != nil {
+		return
+	}
+	responses := make(map[uint]*BranchResponse, len(branches))
+	for _, branch := range branches {
+		responses[branch.ID] = &BranchResponse{ID: branch.ID, Name: branch.Name, AdminUserID: branch.AdminUserID}
+	}
+	for _, transfer := range transfers {
+		transfer.FromBranch = responses[transfer.FromBranchID]
+		transfer.ToBranch = responses[transfer.ToBranchID]
+	}
+}
+
+// sortedItems returns the lines in product ID order so concurrent stock changes lock rows in the same sequence
+func sortedItems(transfer *Transfer) []*TransferItem {
+	items := make([]*TransferItem, len(transfer.Items))
+	copy(items, transfer.Items)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ProductID < items[j].ProductID
+	})
+	return items
+}
+
+func hasItem(transfer *Transfer, itemID uint) bool {
+	for _, item := range transfer.Items {
+		if item.ID == itemID {
+			return true
+		}
+	}
+	return false
+}
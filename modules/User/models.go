@@ -7,8 +7,11 @@ import (
 type UserRole string
 
 const (
-	SuperAdmin UserRole = "super_admin"
-	User       UserRole = "user"
+	SuperAdmin    UserRole = "super_admin" // Company owner - every permission
+	BranchManager UserRole = "branch_manager"
+	Cashier       UserRole = "cashier"
+	Auditor       UserRole = "auditor" // Read-only access to the whole company
+	User          UserRole = "user"    // Legacy role - treated as a cashier
 )
 
 type SyncStatus string
@@ -116,9 +119,17 @@ type CreateBranchRequest struct {
 }
 
 type UpdateBranchRequest struct {
-	CompanyID   *uint   `json:"companyId,omitempty"`
+	CompanyID   *uint   `json:"companyId,omitempty"`   // Ignored - branches cannot move between companies
 	AdminUserID *uint   `json:"adminUserId,omitempty"` // Foreign key to User (company admin)
 	Name        *string `json:"name,omitempty"`
 	Address     *string `json:"address,omitempty"`
 	Phone       *string `json:"phone,omitempty"`
 }
+
+// UserSummary is a user's name and branch, loaded in bulk to label sales and expenses
+type UserSummary struct {
+	ID         uint
+	Name       string
+	BranchID   *uint
+	BranchName *string
+}
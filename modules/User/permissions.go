@@ -0,0 +1,219 @@
+package User
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is an action a role may perform, written as "resource:action"
+type Permission string
+
+const (
+	PermProductsRead  Permission = "products:read"
+	PermProductsWrite Permission = "products:write" // Create, edit, delete and restock products, including prices
+
+	PermSalesRead          Permission = "sales:read"
+	PermSalesCreate        Permission = "sales:create"
+	PermSalesUpdate        Permission = "sales:update"
+	PermSalesVoid          Permission = "sales:void"           // Cancel a sale on the day it was made
+	PermSalesReturn        Permission = "sales:return"         // Take back sold units and refund them
+	PermSalesOverridePrice Permission = "sales:override_price" // Sell off the list price or give discounts
+	PermPaymentsRecord     Permission = "payments:record"
+
+	PermCustomersRead   Permission = "customers:read"
+	PermCustomersWrite  Permission = "customers:write"
+	PermCustomersDelete Permission = "customers:delete"
+
+	PermExpensesRead   Permission = "expenses:read"
+	PermExpensesWrite  Permission = "expenses:write"  // Record expenses
+	PermExpensesManage Permission = "expenses:manage" // Edit and delete recorded expenses
+
+	PermUsersRead   Permission = "users:read"
+	PermUsersManage Permission = "users:manage"
+
+	PermBranchesRead   Permission = "branches:read"
+	PermBranchesManage Permission = "branches:manage"
+
+	PermTransfersRead  Permission = "transfers:read"
+	PermTransfersWrite Permission = "transfers:write" // Create, dispatch, receive and cancel transfers
+
+	PermStockTakesRead    Permission = "stocktakes:read"
+	PermStockTakesCount   Permission = "stocktakes:count"   // Open stock-takes, record counts and submit them
+	PermStockTakesApprove Permission = "stocktakes:approve" // Post a stock-take's variances to stock, or cancel it
+
+	PermPurchasingRead  Permission = "purchasing:read"  // Suppliers and purchase orders
+	PermPurchasingWrite Permission = "purchasing:write" // Manage suppliers, raise and receive purchase orders
+
+	PermReportsRead Permission = "reports:read"
+
+	PermCompanyManage Permission = "company:manage" // Company details and settings such as the costing method; owners only
+)
+
+// rolePermissions is the permission matrix. SuperAdmin (the company owner) is not
+// listed because it holds every permission.
+var rolePermissions = map[UserRole][]Permission{
+	BranchManager: {
+		PermProductsRead, PermProductsWrite,
+		PermSalesRead, PermSalesCreate, PermSalesUpdate, PermSalesVoid, PermSalesReturn, PermSalesOverridePrice, PermPaymentsRecord,
+		PermCustomersRead, PermCustomersWrite, PermCustomersDelete,
+		PermExpensesRead, PermExpensesWrite, PermExpensesManage,
+		PermUsersRead, PermUsersManage,
+		PermBranchesRead,
+		PermTransfersRead, PermTransfersWrite,
+		PermStockTakesRead, PermStockTakesCount, PermStockTakesApprove,
+		PermPurchasingRead, PermPurchasingWrite,
+		PermReportsRead,
+	},
+	Cashier: {
+		PermProductsRead,
+		PermSalesRead, PermSalesCreate, PermPaymentsRecord,
+		PermCustomersRead, PermCustomersWrite,
+		PermExpensesRead, PermExpensesWrite,
+		PermUsersRead,
+		PermBranchesRead,
+		PermTransfersRead,
+		PermStockTakesRead, PermStockTakesCount,
+	},
+	Auditor: {
+		PermProductsRead,
+		PermSalesRead,
+		PermCustomersRead,
+		PermExpensesRead,
+		PermUsersRead,
+		PermBranchesRead,
+		PermTransfersRead,
+		PermStockTakesRead,
+		PermPurchasingRead,
+		PermReportsRead,
+	},
+}
+
+// Normalized maps legacy roles onto the current ones: "user" accounts are cashiers
+func (r UserRole) Normalized() UserRole {
+	if r == User {
+		return Cashier
+	}
+	return r
+}
+
+// ValidRole reports whether role can be assigned to a user
+func ValidRole(role UserRole) bool {
+	switch role {
+	case SuperAdmin, BranchManager, Cashier, Auditor, User:
+		return true
+	}
+	return false
+}
+
+// HasPermission reports whether role grants permission
+func HasPermission(role UserRole, permission Permission) bool {
+	role = role.Normalized()
+	if role == SuperAdmin {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCompanyWideAccess reports whether role sees every branch of the company.
+// Branch managers and cashiers only see their own branch.
+func HasCompanyWideAccess(role UserRole) bool {
+	role = role.Normalized()
+	return role == SuperAdmin || role == Auditor
+}
+
+// CanAssignRole reports whether a user with role actor may create or edit users with role target.
+// Only owners can hand out owner, branch manager or auditor access.
+func CanAssignRole(actor UserRole, target UserRole) bool {
+	if !ValidRole(target) || !HasPermission(actor, PermUsersManage) {
+		return false
+	}
+	if actor.Normalized() == SuperAdmin {
+		return true
+	}
+	return target.Normalized() == Cashier
+}
+
+// RequirePermission aborts with 403 unless the authenticated user's role grants every permission.
+// It must run after AuthMiddleware.
+func RequirePermission(permissions ...Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("role")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+
+		userRole, _ := role.(UserRole)
+		for _, permission := range permissions {
+			if !HasPermission(userRole, permission) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":      "you do not have permission to perform this action",
+					"code":       "PERMISSION_DENIED",
+					"permission": permission,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RoleFromContext returns the role set by AuthMiddleware
+func RoleFromContext(c *gin.Context) UserRole {
+	role, _ := c.Get("role")
+	userRole, _ := role.(UserRole)
+	return userRole
+}
+
+// BranchLimitFromContext returns the only branch the authenticated user may see, or nil
+// when their role has company-wide access. Users without a branch are limited to none.
+func BranchLimitFromContext(c *gin.Context) *uint {
+	if HasCompanyWideAccess(RoleFromContext(c)) {
+		return nil
+	}
+	branchID, _ := c.Get("branch_id")
+	if branchIDPtr, ok := branchID.(*uint); ok && branchIDPtr != nil {
+		return branchIDPtr
+	}
+	none := uint(0)
+	return &none
+}
+
+// CanAccessBranch reports whether the authenticated user may see records of branchID
+func CanAccessBranch(c *gin.Context, branchID uint) bool {
+	limit := BranchLimitFromContext(c)
+	return limit == nil || *limit == branchID
+}
+
+// BranchAccessDenied writes the 403 returned when a branch-limited user asks for another branch
+func BranchAccessDenied(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "you can only access your own branch", "code": "BRANCH_ACCESS_DENIED"})
+}
+
+// CompanyAccessRequired writes the 403 returned when a branch-limited user makes a change
+// that reaches every branch, such as deleting a product or changing its price
+func CompanyAccessRequired(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "this change affects every branch and needs company-wide access", "code": "COMPANY_ACCESS_REQUIRED"})
+}
+
+// RequireCompanyWideAccess aborts with 403 unless the authenticated user's role sees every branch.
+// It must run after AuthMiddleware.
+func RequireCompanyWideAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if BranchLimitFromContext(c) != nil {
+			CompanyAccessRequired(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
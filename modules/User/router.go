@@ -5,6 +5,8 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 )
 
 // GetUserService returns the initialized user service
@@ -22,13 +24,13 @@ func RegisterRoutes(rg *gin.RouterGroup) {
 		protected := users.Group("")
 		protected.Use(AuthMiddleware())
 		{
-			protected.GET("", getAllUsersHandler)
-			protected.GET("/:id", getUserHandler)
-			protected.GET("/branch/:branchId", getUsersByBranchHandler)
-			protected.POST("", createUserHandler)
-			protected.PUT("/:id", updateUserHandler)
+			protected.GET("", RequirePermission(PermUsersRead), getAllUsersHandler)
+			protected.GET("/:id", RequirePermission(PermUsersRead), getUserHandler)
+			protected.GET("/branch/:branchId", RequirePermission(PermUsersRead), getUsersByBranchHandler)
+			protected.POST("", RequirePermission(PermUsersManage), createUserHandler)
+			protected.PUT("/:id", updateUserHandler) // Own profile, or users:manage
 			protected.POST("/:id/change-password", changePasswordHandler)
-			protected.DELETE("/:id", deleteUserHandler)
+			protected.DELETE("/:id", RequirePermission(PermUsersManage), deleteUserHandler)
 			// Notification preferences routes
 			protected.GET("/:id/notification-preferences", getNotificationPreferencesHandler)
 			protected.PUT("/:id/notification-preferences", updateNotificationPreferencesHandler)
@@ -64,55 +66,125 @@ func loginHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// userListSpec is what GET /users and GET /users/branch/:branchId sort and filter by
+var userListSpec = Query.Spec{
+	Sorts: map[string]string{
+		"name":      "name",
+		"username":  "username",
+		"role":      "role",
+		"createdAt": "created_at",
+	},
+	DefaultSort: "name",
+	Filters: map[string]Query.Filter{
+		"branchId": {Column: "branch_id", Kind: Query.UintFilter},
+		"role":     {Column: "role"},
+	},
+	DateColumn: "created_at",
+	Search:     []string{"name", "username", "email", "phone"},
+}
+
 func getAllUsersHandler(c *gin.Context) {
-	users, err := GetUserService().GetAllUsers()
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+	params, ok := Query.FromContext(c, userListSpec)
+	if !ok || !LimitToBranch(c, params) {
+		return
+	}
+
+	listUsers(c, companyID, params)
+}
+
+func listUsers(c *gin.Context, companyID uint, params *Query.Params) {
+	users, page, err := GetUserService().ListUsers(companyID, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		Query.ErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, gin.H{"users": users, "page": page})
 }
 
 func getUserHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
 		return
 	}
-	user, err := GetUserService().GetUserByID(uint(id))
+	user, err := GetUserService().GetCompanyUserByID(uint(id), companyID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	if user.BranchID == nil || !CanAccessBranch(c, *user.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
 
 	c.JSON(http.StatusOK, user)
 }
 
 func getUsersByBranchHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	branchIdParam := c.Param("branchId")
 	branchId, err := strconv.ParseUint(branchIdParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
 		return
 	}
-	users, err := GetUserService().GetUsersByBranch(uint(branchId))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !CanAccessBranch(c, uint(branchId)) {
+		BranchAccessDenied(c)
 		return
 	}
+	params, ok := Query.FromContext(c, userListSpec)
+	if !ok {
+		return
+	}
+	params.Set("branchId", uint(branchId))
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	listUsers(c, companyID, params)
 }
 
 func createUserHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !CanAssignRole(RoleFromContext(c), req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you cannot create users with this role", "code": "ROLE_NOT_ASSIGNABLE"})
+		return
+	}
+
+	// Users can only be created in a branch of the caller's company, and branch managers only in their own branch
+	if req.BranchID != nil {
+		if !CanAccessBranch(c, *req.BranchID) {
+			BranchAccessDenied(c)
+			return
+		}
+		if _, err := GetBranchService().GetBranchByID(*req.BranchID, companyID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	user, err := GetUserService().CreateUser(req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -123,6 +195,11 @@ func createUserHandler(c *gin.Context) {
 }
 
 func updateUserHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
@@ -135,8 +212,36 @@ func updateUserHandler(c *gin.Context) {
 		return
 	}
 
-	user, err := GetUserService().UpdateUser(uint(id), req)
+	// Anyone may edit their own profile; other users, roles and branches need users:manage
+	userID, _ := c.Get("user_id")
+	isSelf := userID == uint(id)
+	role := RoleFromContext(c)
+	if !isSelf || req.Role != nil || req.BranchID != nil {
+		if !HasPermission(role, PermUsersManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to perform this action", "code": "PERMISSION_DENIED", "permission": PermUsersManage})
+			return
+		}
+		target, err := GetUserService().GetCompanyUserByID(uint(id), companyID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if target.BranchID == nil || !CanAccessBranch(c, *target.BranchID) || (req.BranchID != nil && !CanAccessBranch(c, *req.BranchID)) {
+			BranchAccessDenied(c)
+			return
+		}
+		if (!isSelf && !CanAssignRole(role, target.Role)) || (req.Role != nil && !CanAssignRole(role, *req.Role)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you cannot assign or edit users with this role", "code": "ROLE_NOT_ASSIGNABLE"})
+			return
+		}
+	}
+
+	user, err := GetUserService().UpdateUser(uint(id), companyID, req)
 	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -145,6 +250,11 @@ func updateUserHandler(c *gin.Context) {
 }
 
 func changePasswordHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
@@ -165,18 +275,22 @@ func changePasswordHandler(c *gin.Context) {
 		return
 	}
 
-	// Users can only change their own password (unless they're super_admin)
-	// Get user to check role
-	user, err := GetUserService().GetUserByID(userIDUint)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
-		return
-	}
-
-	// Only allow users to change their own password, or super_admin to change any password
-	if user.Role != SuperAdmin && uint(id) != userIDUint {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you can only change your own password"})
-		return
+	// Users can only change their own password, unless they manage users of the target's branch
+	if uint(id) != userIDUint {
+		role := RoleFromContext(c)
+		if !HasPermission(role, PermUsersManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only change your own password"})
+			return
+		}
+		target, err := GetUserService().GetCompanyUserByID(uint(id), companyID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if target.BranchID == nil || !CanAccessBranch(c, *target.BranchID) || !CanAssignRole(role, target.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you can only change your own password"})
+			return
+		}
 	}
 
 	var req ChangePasswordRequest
@@ -185,7 +299,11 @@ func changePasswordHandler(c *gin.Context) {
 		return
 	}
 
-	if err := GetUserService().ChangePassword(uint(id), req); err != nil {
+	if err := GetUserService().ChangePassword(uint(id), companyID, req); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -194,13 +312,32 @@ func changePasswordHandler(c *gin.Context) {
 }
 
 func deleteUserHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
 		return
 	}
-	if err := GetUserService().DeleteUser(uint(id)); err != nil {
+	target, err := GetUserService().GetCompanyUserByID(uint(id), companyID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if target.BranchID == nil || !CanAccessBranch(c, *target.BranchID) {
+		BranchAccessDenied(c)
+		return
+	}
+	if !CanAssignRole(RoleFromContext(c), target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you cannot delete users with this role", "code": "ROLE_NOT_ASSIGNABLE"})
+		return
+	}
+
+	if err := GetUserService().DeleteUser(uint(id), companyID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -215,18 +352,67 @@ func RegisterBranchRoutes(rg *gin.RouterGroup) {
 		// All branch routes require authentication
 		branches.Use(AuthMiddleware())
 		{
-			branches.GET("", getAllBranchesHandler)
-			branches.GET("/:id", getBranchHandler)
-			branches.GET("/company/:companyId", getBranchesByCompanyHandler)
-			branches.POST("", createBranchHandler)
-			branches.PUT("/:id", updateBranchHandler)
-			branches.DELETE("/:id", deleteBranchHandler)
+			branches.GET("", RequirePermission(PermBranchesRead), getAllBranchesHandler)
+			branches.GET("/:id", RequirePermission(PermBranchesRead), getBranchHandler)
+			branches.GET("/company/:companyId", RequirePermission(PermBranchesRead), getBranchesByCompanyHandler)
+			branches.POST("", RequirePermission(PermBranchesManage), createBranchHandler)
+			branches.PUT("/:id", RequirePermission(PermBranchesManage), updateBranchHandler)
+			branches.DELETE("/:id", RequirePermission(PermBranchesManage), deleteBranchHandler)
 		}
 	}
 }
 
+// Company Routes (in the User package because they need the auth middleware and permissions)
+func RegisterCompanyRoutes(rg *gin.RouterGroup) {
+	company := rg.Group("/company")
+	{
+		company.GET("", getCompanyHandler)
+		company.PUT("", RequirePermission(PermCompanyManage), updateCompanyHandler)
+	}
+}
+
+// getCompanyHandler returns the caller's company
+func getCompanyHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	company, err := Company.GetCompanyService().GetCompanyByID(companyID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, company)
+}
+
+func updateCompanyHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	var req Company.UpdateCompanyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	company, err := Company.GetCompanyService().UpdateCompany(companyID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, company)
+}
+
 func getAllBranchesHandler(c *gin.Context) {
-	branches, err := GetBranchService().GetAllBranches()
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	branches, err := GetBranchService().GetBranchesByCompany(companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -236,13 +422,18 @@ func getAllBranchesHandler(c *gin.Context) {
 }
 
 func getBranchHandler(c *gin.Context) {
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch id"})
 		return
 	}
-	branch, err := GetBranchService().GetBranchByID(uint(id))
+	branch, err := GetBranchService().GetBranchByID(uint(id), companyID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -253,19 +444,12 @@ func getBranchHandler(c *gin.Context) {
 
 func getBranchesByCompanyHandler(c *gin.Context) {
 	// Get company ID from middleware context (set by AuthMiddleware) for security
-	companyID, exists := c.Get("company_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "company information not found"})
-		return
-	}
-
-	companyIDPtr, ok := companyID.(*uint)
-	if !ok || companyIDPtr == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid company information"})
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
 		return
 	}
 
-	branches, err := GetBranchService().GetBranchesByCompany(*companyIDPtr)
+	branches, err := GetBranchService().GetBranchesByCompany(companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -282,20 +466,13 @@ func createBranchHandler(c *gin.Context) {
 	}
 
 	// Get company ID from middleware context (set by AuthMiddleware)
-	companyID, exists := c.Get("company_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "company information not found"})
-		return
-	}
-
-	companyIDPtr, ok := companyID.(*uint)
-	if !ok || companyIDPtr == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid company information"})
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
 		return
 	}
 
 	// Override company ID from request with the one from middleware for security
-	req.CompanyID = *companyIDPtr
+	req.CompanyID = companyID
 
 	branch, err := GetBranchService().CreateBranch(req)
 	if err != nil {
@@ -319,28 +496,18 @@ func updateBranchHandler(c *gin.Context) {
 		return
 	}
 
-	// Get company ID from middleware and verify branch belongs to user's company
-	companyID, exists := c.Get("company_id")
-	if exists {
-		companyIDPtr, ok := companyID.(*uint)
-		if ok && companyIDPtr != nil {
-			// Verify branch belongs to user's company
-			branch, err := GetBranchService().GetBranchByID(uint(id))
-			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "branch not found"})
-				return
-			}
-			if branch.CompanyID != *companyIDPtr {
-				c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
-				return
-			}
-			// Prevent changing company ID
-			req.CompanyID = nil
-		}
+	// Branches of other companies are not found
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
 	}
 
-	branch, err := GetBranchService().UpdateBranch(uint(id), req)
+	branch, err := GetBranchService().UpdateBranch(uint(id), companyID, req)
 	if err != nil {
+		if err.Error() == "branch not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -356,24 +523,13 @@ func deleteBranchHandler(c *gin.Context) {
 		return
 	}
 	
-	// Verify branch belongs to user's company
-	companyID, exists := c.Get("company_id")
-	if exists {
-		companyIDPtr, ok := companyID.(*uint)
-		if ok && companyIDPtr != nil {
-			branch, err := GetBranchService().GetBranchByID(uint(id))
-			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "branch not found"})
-				return
-			}
-			if branch.CompanyID != *companyIDPtr {
-				c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
-				return
-			}
-		}
+	// Branches of other companies are not found
+	companyID, ok := CompanyIDFromContext(c)
+	if !ok {
+		return
 	}
 
-	if err := GetBranchService().DeleteBranch(uint(id)); err != nil {
+	if err := GetBranchService().DeleteBranch(uint(id), companyID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -415,6 +571,18 @@ func getNotificationPreferencesHandler(c *gin.Context) {
 		return
 	}
 
+	// super_admin can only reach users of their own company
+	if uint(id) != userIDUint {
+		if user.CompanyID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if _, err := GetUserService().GetCompanyUserByID(uint(id), *user.CompanyID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	prefs, err := GetUserService().GetNotificationPreferences(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -458,6 +626,18 @@ func updateNotificationPreferencesHandler(c *gin.Context) {
 		return
 	}
 
+	// super_admin can only reach users of their own company
+	if uint(id) != userIDUint {
+		if user.CompanyID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if _, err := GetUserService().GetCompanyUserByID(uint(id), *user.CompanyID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	var req UpdateNotificationPreferencesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
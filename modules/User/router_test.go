@@ -0,0 +1,99 @@
+package User_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	Testutil "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Testutil"
+	User "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/User"
+)
+
+// A company's owner can neither see nor change another company's users and branches
+func TestUsersAndBranchesAreScopedToCompany(t *testing.T) {
+	db := Testutil.NewDB(t)
+	a := Testutil.NewTenant(t, db, "a")
+	b := Testutil.NewTenant(t, db, "b")
+	r := Testutil.NewRouter(User.RegisterRoutes, User.RegisterBranchRoutes)
+
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d", b.Owner.ID), ""},
+		{http.MethodPut, fmt.Sprintf("/api/v1/users/%d", b.Owner.ID), `{"name": "taken over"}`},
+		{http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", b.Owner.ID), ""},
+		{http.MethodPost, fmt.Sprintf("/api/v1/users/%d/change-password", b.Owner.ID), `{"oldPassword": "x", "newPassword": "y"}`},
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d/notification-preferences", b.Owner.ID), ""},
+		{http.MethodPut, fmt.Sprintf("/api/v1/users/%d/notification-preferences", b.Owner.ID), `{"salesNotifications": false}`},
+		{http.MethodGet, fmt.Sprintf("/api/v1/branches/%d", b.Branch.ID), ""},
+		{http.MethodPut, fmt.Sprintf("/api/v1/branches/%d", b.Branch.ID), `{"name": "taken over"}`},
+		{http.MethodDelete, fmt.Sprintf("/api/v1/branches/%d", b.Branch.ID), ""},
+	} {
+		w := Testutil.Serve(r, tc.method, tc.path, a.Token, tc.body)
+		if w.Code != http.StatusNotFound && w.Code != http.StatusForbidden {
+			t.Errorf("%s %s as company A: %d %s, want 404 or 403", tc.method, tc.path, w.Code, w.Body)
+		}
+	}
+
+	var owner User.UserModel
+	if err := db.First(&owner, b.Owner.ID).Error; err != nil {
+		t.Fatalf("company B's owner: %v", err)
+	}
+	if owner.Name != b.Owner.Name || owner.Password != b.Owner.Password {
+		t.Errorf("company B's owner changed: %+v", owner)
+	}
+	var branch User.Branch
+	if err := db.First(&branch, b.Branch.ID).Error; err != nil {
+		t.Fatalf("company B's branch: %v", err)
+	}
+	if branch.Name != b.Branch.Name {
+		t.Errorf("company B's branch renamed to %q", branch.Name)
+	}
+
+	for _, path := range []string{
+		"/api/v1/users",
+		fmt.Sprintf("/api/v1/users/branch/%d", b.Branch.ID),
+		fmt.Sprintf("/api/v1/users?branchId=%d", b.Branch.ID),
+	} {
+		w := Testutil.Serve(r, http.MethodGet, path, a.Token)
+		if w.Code == http.StatusNotFound || w.Code == http.StatusForbidden {
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s as company A: %d %s", path, w.Code, w.Body)
+			continue
+		}
+		var body struct{ Users []*User.UserModel }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		for _, user := range body.Users {
+			if user.ID != a.Owner.ID {
+				t.Errorf("GET %s as company A listed user %d of another company", path, user.ID)
+			}
+		}
+		if path == "/api/v1/users" && len(body.Users) != 1 {
+			t.Errorf("GET %s as company A listed %d users, want its own one", path, len(body.Users))
+		}
+	}
+
+	for _, path := range []string{
+		"/api/v1/branches",
+		fmt.Sprintf("/api/v1/branches/company/%d", b.Company.ID),
+	} {
+		w := Testutil.Serve(r, http.MethodGet, path, a.Token)
+		if w.Code == http.StatusNotFound || w.Code == http.StatusForbidden {
+			continue
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s as company A: %d %s", path, w.Code, w.Body)
+			continue
+		}
+		var body struct{ Branches []*User.Branch }
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		if len(body.Branches) != 1 || body.Branches[0].ID != a.Branch.ID {
+			t.Errorf("GET %s as company A listed %d branches, want only its own", path, len(body.Branches))
+		}
+	}
+}
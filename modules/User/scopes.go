@@ -0,0 +1,68 @@
+package User
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
+	"gorm.io/gorm"
+)
+
+// Company scoping. Companies own branches, branches own users, and users own the
+// sales and expenses they record, so every tenant check comes down to one of these
+// subqueries. Records outside the caller's company are simply not found.
+
+// CompanyScope limits a query on a table with its own company_id column (e.g. branches)
+func CompanyScope(column string, companyID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" = ?", companyID)
+	}
+}
+
+// CompanyBranchScope limits a query to rows whose branch column points at one of the company's branches
+func CompanyBranchScope(column string, companyID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN (SELECT id FROM branches WHERE company_id = ?)", companyID)
+	}
+}
+
+// CompanyUserScope limits a query to rows whose user column (e.g. sales.seller_id)
+// points at a user in one of the company's branches
+func CompanyUserScope(column string, companyID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN (SELECT user_models.id FROM user_models JOIN branches ON branches.id = user_models.branch_id WHERE branches.company_id = ?)", companyID)
+	}
+}
+
+// CompanyIDFromContext returns the company set by AuthMiddleware.
+// It writes a 401 response and returns false when the user has no company.
+func CompanyIDFromContext(c *gin.Context) (uint, bool) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "company information not found"})
+		return 0, false
+	}
+
+	companyIDPtr, ok := companyID.(*uint)
+	if !ok || companyIDPtr == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid company information"})
+		return 0, false
+	}
+	return *companyIDPtr, true
+}
+
+// LimitToBranch pins a branch-limited caller's list request to their own branch
+// through its branchId filter. It writes a 403 response and returns false when
+// they asked for another branch.
+func LimitToBranch(c *gin.Context, params *Query.Params) bool {
+	limit := BranchLimitFromContext(c)
+	if limit == nil {
+		return true
+	}
+	if requested := params.Uint("branchId"); requested != nil && *requested != *limit {
+		BranchAccessDenied(c)
+		return false
+	}
+	params.Set("branchId", *limit)
+	return true
+}
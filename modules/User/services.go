@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Company"
+	Query "github.com/kigongo-vincent/inventory-mgmt-be.git/modules/Query"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -75,26 +76,30 @@ func (s *UserService) GetUserByUsername(username string) (*UserModel, error) {
 	return &user, nil
 }
 
-func (s *UserService) GetAllUsers() ([]*UserModel, error) {
-	var users []*UserModel
-	if err := s.db.Find(&users).Error; err != nil {
+// GetCompanyUserByID returns a user only if they belong to one of the company's branches
+func (s *UserService) GetCompanyUserByID(id uint, companyID uint) (*UserModel, error) {
+	var user UserModel
+	if err := s.db.Scopes(CompanyBranchScope("branch_id", companyID)).First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("user not found")
+		}
 		return nil, err
 	}
-	for i := range users {
-		s.populateBranchAndCompany(users[i])
-	}
-	return users, nil
+	s.populateBranchAndCompany(&user)
+	return &user, nil
 }
 
-func (s *UserService) GetUsersByBranch(branchID uint) ([]*UserModel, error) {
+// ListUsers returns one page of the company's users matching params
+func (s *UserService) ListUsers(companyID uint, params *Query.Params) ([]*UserModel, *Query.Page, error) {
+	query := s.db.Model(&UserModel{}).Scopes(CompanyBranchScope("branch_id", companyID))
+
 	var users []*UserModel
-	if err := s.db.Where("branch_id = ?", branchID).Find(&users).Error; err != nil {
-		return nil, err
-	}
-	for i := range users {
-		s.populateBranchAndCompany(users[i])
+	page, err := Query.Paginate(query, params, &users)
+	if err != nil {
+		return nil, nil, err
 	}
-	return users, nil
+	s.populateBranchesAndCompanies(users)
+	return users, page, nil
 }
 
 func (s *UserService) CreateUser(req CreateUserRequest) (*UserModel, error) {
@@ -170,9 +175,9 @@ func (s *UserService) CreateUser(req CreateUserRequest) (*UserModel, error) {
 	return user, nil
 }
 
-func (s *UserService) UpdateUser(id uint, req UpdateUserRequest) (*UserModel, error) {
+func (s *UserService) UpdateUser(id uint, companyID uint, req UpdateUserRequest) (*UserModel, error) {
 	var user UserModel
-	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyBranchScope("branch_id", companyID)).First(&user, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("user not found")
 		}
@@ -205,9 +210,9 @@ func (s *UserService) UpdateUser(id uint, req UpdateUserRequest) (*UserModel, er
 		user.Role = *req.Role
 	}
 	if req.BranchID != nil {
-		// Verify branch exists
+		// Verify branch exists in the user's company
 		var branch Branch
-		if err := s.db.First(&branch, "id = ?", *req.BranchID).Error; err != nil {
+		if err := s.db.Scopes(CompanyScope("company_id", companyID)).First(&branch, "id = ?", *req.BranchID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return nil, errors.New("branch not found")
 			}
@@ -233,9 +238,9 @@ func (s *UserService) UpdateUser(id uint, req UpdateUserRequest) (*UserModel, er
 	return &user, nil
 }
 
-func (s *UserService) ChangePassword(id uint, req ChangePasswordRequest) error {
+func (s *UserService) ChangePassword(id uint, companyID uint, req ChangePasswordRequest) error {
 	var user UserModel
-	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyBranchScope("branch_id", companyID)).First(&user, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return errors.New("user not found")
 		}
@@ -272,9 +277,9 @@ func (s *UserService) ChangePassword(id uint, req ChangePasswordRequest) error {
 	return nil
 }
 
-func (s *UserService) DeleteUser(id uint) error {
+func (s *UserService) DeleteUser(id uint, companyID uint) error {
 	var user UserModel
-	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyBranchScope("branch_id", companyID)).First(&user, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return errors.New("user not found")
 		}
@@ -484,7 +489,7 @@ func (s *UserService) InitializeCompanyAdmin() error {
 			updateReq := UpdateBranchRequest{
 				AdminUserID: &owner.ID,
 			}
-			_, err = branchService.UpdateBranch(mainBranch.ID, updateReq)
+			_, err = branchService.UpdateBranch(mainBranch.ID, company.ID, updateReq)
 			if err != nil {
 				return fmt.Errorf("failed to update branch with admin user ID: %w", err)
 			}
@@ -588,7 +593,7 @@ func (s *UserService) InitializeCompanyAdmin() error {
 		updateReq := UpdateBranchRequest{
 			AdminUserID: &owner.ID,
 		}
-		_, err = branchService.UpdateBranch(mainBranch.ID, updateReq)
+		_, err = branchService.UpdateBranch(mainBranch.ID, company.ID, updateReq)
 		if err != nil {
 			return fmt.Errorf("failed to update branch with admin user ID: %w", err)
 		}
@@ -653,9 +658,9 @@ func GetBranchService() *BranchService {
 	return branchService
 }
 
-func (s *BranchService) GetBranchByID(id uint) (*Branch, error) {
+func (s *BranchService) GetBranchByID(id uint, companyID uint) (*Branch, error) {
 	var branch Branch
-	if err := s.db.First(&branch, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyScope("company_id", companyID)).First(&branch, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("branch not found")
 		}
@@ -664,17 +669,26 @@ func (s *BranchService) GetBranchByID(id uint) (*Branch, error) {
 	return &branch, nil
 }
 
-func (s *BranchService) GetBranchesByCompany(companyID uint) ([]*Branch, error) {
+// GetBranchNames returns the names of the branches of ids in one query, keyed by id
+func (s *BranchService) GetBranchNames(ids []uint) (map[uint]string, error) {
+	names := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
 	var branches []*Branch
-	if err := s.db.Where("company_id = ?", companyID).Find(&branches).Error; err != nil {
+	if err := s.db.Select("id", "name").Where("id IN ?", ids).Find(&branches).Error; err != nil {
 		return nil, err
 	}
-	return branches, nil
+	for _, branch := range branches {
+		names[branch.ID] = branch.Name
+	}
+	return names, nil
 }
 
-func (s *BranchService) GetAllBranches() ([]*Branch, error) {
+func (s *BranchService) GetBranchesByCompany(companyID uint) ([]*Branch, error) {
 	var branches []*Branch
-	if err := s.db.Find(&branches).Error; err != nil {
+	if err := s.db.Where("company_id = ?", companyID).Find(&branches).Error; err != nil {
 		return nil, err
 	}
 	return branches, nil
@@ -696,19 +710,25 @@ func (s *BranchService) CreateBranch(req CreateBranchRequest) (*Branch, error) {
 	return branch, nil
 }
 
-func (s *BranchService) UpdateBranch(id uint, req UpdateBranchRequest) (*Branch, error) {
+// UpdateBranch updates a branch of the company. The branch cannot be moved to another company.
+func (s *BranchService) UpdateBranch(id uint, companyID uint, req UpdateBranchRequest) (*Branch, error) {
 	var branch Branch
-	if err := s.db.First(&branch, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyScope("company_id", companyID)).First(&branch, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("branch not found")
 		}
 		return nil, err
 	}
 
-	if req.CompanyID != nil {
-		branch.CompanyID = *req.CompanyID
-	}
 	if req.AdminUserID != nil {
+		// The branch admin must be a user of the same company
+		var admin UserModel
+		if err := s.db.Scopes(CompanyBranchScope("branch_id", companyID)).First(&admin, "id = ?", *req.AdminUserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, errors.New("admin user not found")
+			}
+			return nil, err
+		}
 		branch.AdminUserID = req.AdminUserID
 	}
 	if req.Name != nil {
@@ -728,9 +748,9 @@ func (s *BranchService) UpdateBranch(id uint, req UpdateBranchRequest) (*Branch,
 	return &branch, nil
 }
 
-func (s *BranchService) DeleteBranch(id uint) error {
+func (s *BranchService) DeleteBranch(id uint, companyID uint) error {
 	var branch Branch
-	if err := s.db.First(&branch, "id = ?", id).Error; err != nil {
+	if err := s.db.Scopes(CompanyScope("company_id", companyID)).First(&branch, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return errors.New("branch not found")
 		}
@@ -768,20 +788,79 @@ func hashPassword(password string) (string, error) {
 }
 
 // populateBranchAndCompany populates the branch and company fields from BranchID
-// Company is always derived from the branch
 func (s *UserService) populateBranchAndCompany(user *UserModel) {
-	if user.BranchID != nil {
-		var branch Branch
-		if err := s.db.First(&branch, "id = ?", *user.BranchID).Error; err == nil {
-			user.Branch = branch.Name
-			// Get company ID and name from branch's company
-			user.CompanyID = &branch.CompanyID
-			var company Company.Company
-			if err := s.db.First(&company, "id = ?", branch.CompanyID).Error; err == nil {
-				user.Company = company.Name
-			}
+	s.populateBranchesAndCompanies([]*UserModel{user})
+}
+
+// populateBranchesAndCompanies populates the branch and company fields of many users with one query
+func (s *UserService) populateBranchesAndCompanies(users []*UserModel) {
+	branchIDs := make([]uint, 0, len(users))
+	seen := make(map[uint]bool)
+	for _, user := range users {
+		if user.BranchID != nil && !seen[*user.BranchID] {
+			seen[*user.BranchID] = true
+			branchIDs = append(branchIDs, *user.BranchID)
 		}
 	}
+	if len(branchIDs) == 0 {
+		return
+	}
+
+	type branchRow struct {
+		ID          uint
+		Name        string
+		CompanyID   uint
+		CompanyName *string
+	}
+	var rows []*branchRow
+	if err := s.db.Table("branches").
+		Select("branches.id, branches.name, branches.company_id, companies.name AS company_name").
+		Joins("LEFT JOIN companies ON companies.id = branches.company_id AND companies.deleted_at IS NULL").
+		Where("branches.id IN ? AND branches.deleted_at IS NULL", branchIDs).
+		Scan(&rows).Error; err != nil {
+		return
+	}
+	branches := make(map[uint]*branchRow, len(rows))
+	for _, row := range rows {
+		branches[row.ID] = row
+	}
+	for _, user := range users {
+		if user.BranchID == nil {
+			continue
+		}
+		row, ok := branches[*user.BranchID]
+		if !ok {
+			continue
+		}
+		companyID := row.CompanyID
+		user.Branch = row.Name
+		user.CompanyID = &companyID
+		if row.CompanyName != nil {
+			user.Company = *row.CompanyName
+		}
+	}
+}
+
+// GetUserSummaries returns the users of ids with their branch names in one query, keyed by id.
+// Deleted users are left out.
+func (s *UserService) GetUserSummaries(ids []uint) (map[uint]*UserSummary, error) {
+	summaries := make(map[uint]*UserSummary, len(ids))
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	var rows []*UserSummary
+	if err := s.db.Table("user_models").
+		Select("user_models.id, user_models.name, branches.id AS branch_id, branches.name AS branch_name").
+		Joins("LEFT JOIN branches ON branches.id = user_models.branch_id AND branches.deleted_at IS NULL").
+		Where("user_models.id IN ? AND user_models.deleted_at IS NULL", ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		summaries[row.ID] = row
+	}
+	return summaries, nil
 }
 
 // GetCompanyIDFromBranch returns the company ID for a given branch ID